@@ -0,0 +1,418 @@
+package bridge
+
+import (
+	"fmt"
+)
+
+/**
+ * Tells if two types are the same type.  Named types (and aliases) are the
+ * same if they have the same name and package and other types are the same
+ * if they are made of the same types in the same way (eg []A and []B are the
+ * same if A and B are).  Type parameters are the same if they are at the
+ * same position in their generic types.
+ *
+ * Aliases are distinct from the types they stand for (see Equivalent).
+ */
+func Identical(a *Type, b *Type) bool {
+	return (&typeComparer{}).equal(a, b)
+}
+
+/**
+ * Tells if two types are the same once aliases (eg "type A = B") are
+ * replaced by the types they stand for.  This is the identity used by Go.
+ */
+func Equivalent(a *Type, b *Type) bool {
+	return (&typeComparer{resolveAliases: true}).equal(a, b)
+}
+
+/**
+ * Tells if two types have the same structure.  Unlike Equivalent, named
+ * types are compared by their definitions (and not their names) so this
+ * can compare different versions of a type (eg from type libraries loaded
+ * from different releases).  Named types that are not declared (eg
+ * unresolved types) are still compared by name.
+ */
+func StructurallyEqual(a *Type, b *Type) bool {
+	return (&typeComparer{resolveAliases: true, structural: true}).equal(a, b)
+}
+
+/**
+ * Tells if a value of a type can be assigned to a variable of another type,
+ * ie (as in Go) if the types are equivalent or:
+ *
+ * 	1. they have the same underlying types and one of them is not named,
+ * 	2. the target is an interface whose methods are in the method set of
+ * 	the value type (see MethodSet, methods with pointer receivers are
+ * 	only in the method sets of pointers),
+ * 	3. the value is a bidirectional channel, the target is a channel of the
+ * 	same element type and one of them is not named.
+ */
+func AssignableTo(value *Type, target *Type) bool {
+	if Equivalent(value, target) {
+		return true
+	}
+	valueUnderlying, targetUnderlying := Underlying(value), Underlying(target)
+	if targetUnderlying.TypeClass == NamedType {
+		// the predeclared any (when it is not declared as interface{})
+		if named := targetUnderlying.AsNamedType(); named.Package == "" && named.Name == "any" {
+			return true
+		}
+	}
+	if !isDefinedType(value) || !isDefinedType(target) {
+		comparer := &typeComparer{resolveAliases: true}
+		if comparer.equalDefinitions(valueUnderlying, targetUnderlying) {
+			return true
+		}
+		if valueUnderlying.TypeClass == ChannelType && targetUnderlying.TypeClass == ChannelType {
+			valueChannel, targetChannel := valueUnderlying.AsChannelType(), targetUnderlying.AsChannelType()
+			if valueChannel.Dir == BothDirs && comparer.equal(valueChannel.ElementType, targetChannel.ElementType) {
+				return true
+			}
+		}
+	}
+	if targetUnderlying.TypeClass == RecordType && targetUnderlying.AsRecordType().IsInterface {
+		methods := MethodSet(value)
+		for name, method := range MethodSet(target) {
+			if other, ok := methods[name]; !ok || !Equivalent(other, method) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+/**
+ * Returns the type a type is defined with, ie the target of aliases and
+ * defined types (eg string for "type ID string").  Records (and all other
+ * types) are their own underlying types.
+ */
+func Underlying(t *Type) *Type {
+	for t.TypeClass == AliasType {
+		t = t.AsAliasType().TargetType
+	}
+	return t
+}
+
+/**
+ * Tells if a type has a name (and is not just an alias of another type).
+ */
+func isDefinedType(t *Type) bool {
+	for t.TypeClass == AliasType && t.AsAliasType().IsAlias {
+		t = t.AsAliasType().TargetType
+	}
+	return namedTypeOf(t) != nil || t.TypeClass == InstanceType
+}
+
+type typeComparer struct {
+	// Whether aliases are replaced by the types they stand for
+	resolveAliases bool
+
+	// Whether named types are compared by their definitions
+	structural bool
+
+	// Pairs of named types being compared (assumed to be equal so that
+	// recursive types can be compared)
+	assumed map[[2]*Type]bool
+}
+
+func (tc *typeComparer) equal(a *Type, b *Type) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	if tc.resolveAliases {
+		for a.TypeClass == AliasType && a.AsAliasType().IsAlias {
+			a = a.AsAliasType().TargetType
+		}
+		for b.TypeClass == AliasType && b.AsAliasType().IsAlias {
+			b = b.AsAliasType().TargetType
+		}
+		if a == b {
+			return true
+		}
+	}
+	aNamed, bNamed := namedTypeOf(a), namedTypeOf(b)
+	if aNamed != nil || bNamed != nil {
+		if aNamed == nil || bNamed == nil {
+			return false
+		}
+		if !tc.structural || a.TypeClass == NamedType || a.TypeClass == UnresolvedType ||
+			b.TypeClass == NamedType || b.TypeClass == UnresolvedType {
+			return aNamed.Name == bNamed.Name && aNamed.Package == bNamed.Package
+		}
+		pair := [2]*Type{a, b}
+		if tc.assumed[pair] {
+			return true
+		}
+		if tc.assumed == nil {
+			tc.assumed = make(map[[2]*Type]bool)
+		}
+		tc.assumed[pair] = true
+	}
+	return tc.equalDefinitions(a, b)
+}
+
+/**
+ * Returns the name of a named type (nil for types without names).
+ */
+func namedTypeOf(t *Type) *NamedTypeData {
+	switch typeData := t.TypeData.(type) {
+	case *NamedTypeData:
+		return typeData
+	case *AliasTypeData:
+		return &typeData.NamedTypeData
+	case *RecordTypeData:
+		if typeData.Name != "" {
+			return &typeData.NamedTypeData
+		}
+	}
+	return nil
+}
+
+/**
+ * Compares the definitions of two types (ignoring their names).
+ */
+func (tc *typeComparer) equalDefinitions(a *Type, b *Type) bool {
+	if a.TypeClass != b.TypeClass {
+		return false
+	}
+	switch aData := a.TypeData.(type) {
+	case *NamedTypeData:
+		bData := b.AsNamedType()
+		return aData.Name == bData.Name && aData.Package == bData.Package
+	case *AliasTypeData:
+		bData := b.AsAliasType()
+		return aData.IsAlias == bData.IsAlias && len(aData.TypeParams) == len(bData.TypeParams) &&
+			tc.equal(aData.TargetType, bData.TargetType)
+	case *ReferenceTypeData:
+		return tc.equal(aData.TargetType, b.AsReferenceType().TargetType)
+	case *ListTypeData:
+		bData := b.AsListType()
+		return aData.IsArray == bData.IsArray && aData.Length == bData.Length && tc.equal(aData.TargetType, bData.TargetType)
+	case *MapTypeData:
+		bData := b.AsMapType()
+		return tc.equal(aData.KeyType, bData.KeyType) && tc.equal(aData.ValueType, bData.ValueType)
+	case *ChannelTypeData:
+		bData := b.AsChannelType()
+		return aData.Dir == bData.Dir && tc.equal(aData.ElementType, bData.ElementType)
+	case *TupleTypeData:
+		return tc.equalLists(aData.SubTypes, b.AsTupleType().SubTypes)
+	case *FunctionTypeData:
+		bData := b.AsFunctionType()
+		return aData.IsVariadic == bData.IsVariadic && tc.equalLists(aData.InputTypes, bData.InputTypes) &&
+			tc.equalLists(aData.OutputTypes, bData.OutputTypes) && tc.equalLists(aData.ExceptionTypes, bData.ExceptionTypes)
+	case *RecordTypeData:
+		bData := b.AsRecordType()
+		if aData.IsInterface != bData.IsInterface || len(aData.TypeParams) != len(bData.TypeParams) ||
+			len(aData.Fields) != len(bData.Fields) {
+			return false
+		}
+		for index, field := range aData.Fields {
+			other := bData.Fields[index]
+			if field.Name != other.Name || field.Tag != other.Tag || !tc.equal(field.Type, other.Type) {
+				return false
+			}
+		}
+		return true
+	case *TypeParamData:
+		return aData.Index == b.AsTypeParamType().Index
+	case *InstanceTypeData:
+		bData := b.AsInstanceType()
+		return tc.equal(aData.GenericType, bData.GenericType) && tc.equalLists(aData.TypeArgs, bData.TypeArgs)
+	case *UnionTypeData:
+		bData := b.AsUnionType()
+		if len(aData.Terms) != len(bData.Terms) {
+			return false
+		}
+		for index, term := range aData.Terms {
+			if term.Tilde != bData.Terms[index].Tilde || !tc.equal(term.Type, bData.Terms[index].Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return a.TypeData == b.TypeData
+}
+
+func (tc *typeComparer) equalLists(a []*Type, b []*Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index, t := range a {
+		if !tc.equal(t, b[index]) {
+			return false
+		}
+	}
+	return true
+}
+
+/**
+ * Kinds of changes between two versions of a type.
+ */
+const (
+	ChangeAdded = iota
+	ChangeRemoved
+	ChangeModified
+)
+
+/**
+ * A change to a field (or operation) of a type or to the type itself (in
+ * which case Name is empty).
+ */
+type TypeChange struct {
+	// One of the change kinds above
+	Kind int
+
+	// Name of the field or operation (embedded fields are named after their
+	// types)
+	Name string
+
+	// The field in the old and new versions (nil if added or removed)
+	Old *Field
+	New *Field
+
+	// Whether existing users of the type (eg clients of a service) would be
+	// broken by the change
+	Breaking bool
+
+	Message string
+}
+
+func (c *TypeChange) String() string {
+	if c.Breaking {
+		return c.Message + " (breaking)"
+	}
+	return c.Message
+}
+
+/**
+ * The changes between two versions of a type.
+ */
+type TypeDiff struct {
+	Old     *Type
+	New     *Type
+	Changes []*TypeChange
+}
+
+func (d *TypeDiff) HasChanges() bool {
+	return len(d.Changes) > 0
+}
+
+/**
+ * Returns the changes that would break existing users of the type.
+ */
+func (d *TypeDiff) Breaking() []*TypeChange {
+	var out []*TypeChange
+	for _, change := range d.Changes {
+		if change.Breaking {
+			out = append(out, change)
+		}
+	}
+	return out
+}
+
+/**
+ * Returns the changes between two versions of a type.  The fields of
+ * structs and the operations of interfaces are matched by name and
+ * reported as added, removed or changed.  Removing (or changing the type
+ * or json name of) a field or operation is breaking while adding one is
+ * not.  Types of other kinds are reported as changed if their definitions
+ * differ.  Named types the type refers to are compared by name (and not by
+ * their definitions as they have diffs of their own).  Signatures in
+ * messages are printed with a SignaturePrinter.
+ */
+func DiffTypes(oldType *Type, newType *Type, printer SignaturePrinter) *TypeDiff {
+	diff := &TypeDiff{Old: oldType, New: newType}
+	addChange := func(kind int, name string, oldField *Field, newField *Field, breaking bool, format string, args ...interface{}) {
+		diff.Changes = append(diff.Changes, &TypeChange{Kind: kind, Name: name, Old: oldField, New: newField,
+			Breaking: breaking, Message: fmt.Sprintf(format, args...)})
+	}
+	if oldType.TypeClass != RecordType || newType.TypeClass != RecordType ||
+		oldType.AsRecordType().IsInterface != newType.AsRecordType().IsInterface {
+		if !(&typeComparer{resolveAliases: true}).equalDefinitions(oldType, newType) {
+			addChange(ChangeModified, "", nil, nil, true, "changed %s from %s to %s",
+				printer.Signature(oldType), typeKind(oldType, printer), typeKind(newType, printer))
+		}
+		return diff
+	}
+
+	oldRecord, newRecord := oldType.AsRecordType(), newType.AsRecordType()
+	member := "field"
+	if oldRecord.IsInterface {
+		member = "operation"
+	}
+	if len(oldRecord.TypeParams) != len(newRecord.TypeParams) {
+		addChange(ChangeModified, "", nil, nil, true, "changed number of type parameters of %s from %d to %d",
+			printer.Signature(oldType), len(oldRecord.TypeParams), len(newRecord.TypeParams))
+	}
+	newFields := make(map[string]*Field)
+	for _, field := range newRecord.Fields {
+		newFields[memberName(field)] = field
+	}
+	oldFields := make(map[string]*Field)
+	for _, oldField := range oldRecord.Fields {
+		name := memberName(oldField)
+		oldFields[name] = oldField
+		newField := newFields[name]
+		if newField == nil {
+			addChange(ChangeRemoved, name, oldField, nil, true, "removed %s %s", member, name)
+			continue
+		}
+		oldJsonName, _ := oldField.JsonName()
+		newJsonName, _ := newField.JsonName()
+		if !Equivalent(oldField.Type, newField.Type) {
+			addChange(ChangeModified, name, oldField, newField, true, "changed type of %s %s from %s to %s",
+				member, name, printer.Signature(oldField.Type), printer.Signature(newField.Type))
+		} else if !oldRecord.IsInterface && oldJsonName != newJsonName {
+			addChange(ChangeModified, name, oldField, newField, true, "changed json name of %s %s from %q to %q",
+				member, name, oldJsonName, newJsonName)
+		} else if oldField.Tag != newField.Tag {
+			addChange(ChangeModified, name, oldField, newField, false, "changed tag of %s %s from %q to %q",
+				member, name, oldField.Tag, newField.Tag)
+		}
+	}
+	for _, newField := range newRecord.Fields {
+		name := memberName(newField)
+		if oldFields[name] == nil {
+			addChange(ChangeAdded, name, nil, newField, false, "added %s %s", member, name)
+		}
+	}
+	return diff
+}
+
+/**
+ * Returns the name a field is matched by (embedded fields are matched by
+ * the names of their types).
+ */
+func memberName(field *Field) string {
+	if field.Name != "" {
+		return field.Name
+	}
+	if leafType := field.Type.LeafType(); leafType != nil {
+		return leafType.Name
+	}
+	return ""
+}
+
+/**
+ * Describes what a type is defined as for messages, eg "struct" or
+ * "alias of string".
+ */
+func typeKind(t *Type, printer SignaturePrinter) string {
+	switch typeData := t.TypeData.(type) {
+	case *RecordTypeData:
+		if typeData.IsInterface {
+			return "interface"
+		}
+		return "struct"
+	case *AliasTypeData:
+		if typeData.IsAlias {
+			return "alias of " + printer.Signature(typeData.TargetType)
+		}
+		return printer.Signature(typeData.TargetType)
+	}
+	return printer.Signature(t)
+}
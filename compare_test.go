@@ -0,0 +1,135 @@
+package bridge
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestIdenticalAndAssignable(c *C) {
+	_, typeLibrary := parseTestSource(c, `package test
+
+type ID string
+
+type IDAlias = ID
+
+type IDs []ID
+
+type Node struct {
+	Id       ID
+	Children []*Node
+}
+
+type Tree struct {
+	Id       IDAlias
+	Children []*Tree
+}
+
+type Closer interface {
+	Close() error
+}
+
+type File struct {
+	Closer
+	Path     string
+	Ids      []ID
+	Updates  chan ID
+	Received <-chan ID
+}
+`)
+	get := func(name string) *Type { return typeLibrary.GetType("example.com/test", name) }
+	file := get("File").AsRecordType()
+	id, idAlias, ids, idList := get("ID"), get("IDAlias"), get("IDs"), file.Fields[2].Type
+
+	c.Assert(Identical(id, id), Equals, true)
+	c.Assert(Identical(id, idAlias), Equals, false)
+	c.Assert(Equivalent(id, idAlias), Equals, true)
+	c.Assert(Equivalent(id, typeLibrary.GetGlobalType("string")), Equals, false)
+	c.Assert(Identical(idList, get("IDs").AsAliasType().TargetType), Equals, true)
+	c.Assert(Equivalent(ids, idList), Equals, false)
+
+	// recursive types with the same structure
+	c.Assert(Equivalent(get("Node"), get("Tree")), Equals, false)
+	c.Assert(StructurallyEqual(get("Node"), get("Tree")), Equals, true)
+
+	c.Assert(AssignableTo(idList, ids), Equals, true)
+	c.Assert(AssignableTo(ids, idList), Equals, true)
+	c.Assert(AssignableTo(typeLibrary.GetGlobalType("string"), id), Equals, false)
+	c.Assert(AssignableTo(get("File"), get("Closer")), Equals, true)
+	c.Assert(AssignableTo(get("Node"), get("Closer")), Equals, false)
+	c.Assert(AssignableTo(get("Node"), typeLibrary.GetGlobalType("any")), Equals, true)
+	anyRef, err := typeLibrary.ParseSignature("*any")
+	c.Assert(err, IsNil)
+	c.Assert(AssignableTo(typeLibrary.GetGlobalType("int"), anyRef), Equals, false)
+	c.Assert(AssignableTo(get("Node"), anyRef), Equals, false)
+	c.Assert(AssignableTo(file.Fields[3].Type, file.Fields[4].Type), Equals, true)
+	c.Assert(AssignableTo(file.Fields[4].Type, file.Fields[3].Type), Equals, false)
+}
+
+func (s *TestSuite) TestDiffTypes(c *C) {
+	_, oldLibrary := parseTestSource(c, `package test
+
+type User struct {
+	Id    string "json:\"id\""
+	Name  string
+	Email string "json:\"email\""
+	Age   int
+}
+
+type Service interface {
+	GetUser(id string) (*User, error)
+	DeleteUser(id string) error
+	ListUsers() ([]*User, error)
+}
+
+type Status string
+`)
+	_, newLibrary := parseTestSource(c, `package test
+
+type User struct {
+	Id    string "json:\"id\""
+	Name  string "json:\"Name,omitempty\""
+	Email string "json:\"mail\""
+	Age   float64
+	Team  string
+}
+
+type Service interface {
+	GetUser(id string) (*User, error)
+	ListUsers(offset int) ([]*User, error)
+	CreateUser(user *User) (*User, error)
+}
+
+type Status int
+`)
+	diff := func(name string) *TypeDiff {
+		return DiffTypes(oldLibrary.GetType("example.com/test", name), newLibrary.GetType("example.com/test", name), oldLibrary)
+	}
+	messages := func(changes []*TypeChange) (out []string) {
+		for _, change := range changes {
+			out = append(out, change.String())
+		}
+		return
+	}
+
+	user := diff("User")
+	c.Assert(messages(user.Changes), DeepEquals, []string{
+		`changed tag of field Name from "" to "json:\"Name,omitempty\""`,
+		`changed json name of field Email from "email" to "mail" (breaking)`,
+		"changed type of field Age from int to float64 (breaking)",
+		"added field Team",
+	})
+	c.Assert(user.Changes[3].Kind, Equals, ChangeAdded)
+	c.Assert(user.Changes[3].New.Name, Equals, "Team")
+
+	service := diff("Service")
+	c.Assert(messages(service.Breaking()), DeepEquals, []string{
+		"removed operation DeleteUser (breaking)",
+		"changed type of operation ListUsers from func() ([]*example.com/test.User, error) to func(int) ([]*example.com/test.User, error) (breaking)",
+	})
+	c.Assert(len(service.Changes), Equals, 3)
+	c.Assert(service.Changes[2].Message, Equals, "added operation CreateUser")
+
+	c.Assert(messages(diff("Status").Changes), DeepEquals, []string{"changed example.com/test.Status from string to int (breaking)"})
+
+	// the same type has no changes
+	c.Assert(DiffTypes(oldLibrary.GetType("example.com/test", "User"), oldLibrary.GetType("example.com/test", "User"), oldLibrary).HasChanges(), Equals, false)
+}
@@ -0,0 +1,172 @@
+package bridge
+
+import (
+	"fmt"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+)
+
+/**
+ * Severities of diagnostics.
+ */
+const (
+	SeverityError = iota
+	SeverityWarning
+	SeverityNote
+)
+
+/**
+ * Codes identifying the kind of problem a diagnostic reports.
+ */
+const (
+	CodeParseError      = "parse-error"
+	CodeTypeCheckError  = "type-check-error"
+	CodeRedefinition    = "redefinition"
+	CodeUnsupportedType = "unsupported-type"
+	CodeUnresolvedType  = "unresolved-type"
+	CodeDotImport       = "dot-import"
+	CodeArrayLength     = "array-length"
+	CodeImportNotFound  = "import-not-found"
+	CodeImportPath      = "import-path"
+	CodeSourceImport    = "source-import"
+)
+
+/**
+ * A problem found while parsing or resolving types.
+ */
+type Diagnostic struct {
+	// Where the problem is (may be invalid if it is not known)
+	Position token.Position
+
+	// One of the severities above
+	Severity int
+
+	// One of the codes above
+	Code string
+
+	Message string
+}
+
+func (d *Diagnostic) SeverityString() string {
+	switch d.Severity {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityNote:
+		return "note"
+	}
+	return ""
+}
+
+/**
+ * Returns the diagnostic in the same format as gcc (and the go tool), eg:
+ *
+ * 	core/service.go:12:2: error: undefined type Request [unresolved-type]
+ */
+func (d *Diagnostic) String() string {
+	out := ""
+	if position := d.Position.String(); position != "-" {
+		out = position + ": "
+	}
+	return out + d.SeverityString() + ": " + d.Message + " [" + d.Code + "]"
+}
+
+func (d *Diagnostic) Error() string {
+	return d.String()
+}
+
+/**
+ * A list of diagnostics.  This is also an error (listing the errors in it)
+ * so it can be returned where only errors are expected.
+ */
+type Diagnostics []*Diagnostic
+
+/**
+ * Adds a diagnostic to the list.
+ */
+func (ds *Diagnostics) Add(position token.Position, severity int, code string, format string, args ...interface{}) *Diagnostic {
+	out := &Diagnostic{Position: position, Severity: severity, Code: code, Message: fmt.Sprintf(format, args...)}
+	*ds = append(*ds, out)
+	return out
+}
+
+func (ds *Diagnostics) AddError(position token.Position, code string, format string, args ...interface{}) *Diagnostic {
+	return ds.Add(position, SeverityError, code, format, args...)
+}
+
+func (ds *Diagnostics) AddWarning(position token.Position, code string, format string, args ...interface{}) *Diagnostic {
+	return ds.Add(position, SeverityWarning, code, format, args...)
+}
+
+/**
+ * Tells if any of the diagnostics is an error.
+ */
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * Returns the diagnostics of a given severity.
+ */
+func (ds Diagnostics) Filter(severity int) Diagnostics {
+	var out Diagnostics
+	for _, d := range ds {
+		if d.Severity == severity {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+/**
+ * Returns the diagnostics as an error if there are errors in them (or nil
+ * otherwise).
+ */
+func (ds Diagnostics) Err() error {
+	if ds.HasErrors() {
+		return ds
+	}
+	return nil
+}
+
+func (ds Diagnostics) Error() string {
+	var lines []string
+	for _, d := range ds.Filter(SeverityError) {
+		lines = append(lines, d.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+/**
+ * Sorts the diagnostics by file and position (diagnostics without a
+ * position come first).
+ */
+func (ds Diagnostics) Sort() {
+	sort.SliceStable(ds, func(i, j int) bool {
+		a, b := ds[i].Position, ds[j].Position
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+/**
+ * Writes the diagnostics (one per line) to a writer.
+ */
+func (ds Diagnostics) Print(writer io.Writer) {
+	for _, d := range ds {
+		fmt.Fprintln(writer, d.String())
+	}
+}
@@ -0,0 +1,120 @@
+package bridge
+
+import (
+	"bytes"
+	"go/token"
+	. "gopkg.in/check.v1"
+	"path/filepath"
+)
+
+func (s *TestSuite) TestDiagnosticsFormat(c *C) {
+	var diagnostics Diagnostics
+	diagnostics.AddWarning(token.Position{Filename: "b.go", Line: 3, Column: 1}, CodeDotImport, "dot import of %s is not supported", "fmt")
+	diagnostics.AddError(token.Position{Filename: "a.go", Line: 10, Column: 2}, CodeUnresolvedType, "undefined type %s", "Request")
+	diagnostics.AddError(token.Position{}, CodeTypeCheckError, "no position")
+	c.Assert(diagnostics.HasErrors(), Equals, true)
+	c.Assert(len(diagnostics.Filter(SeverityWarning)), Equals, 1)
+
+	diagnostics.Sort()
+	buffer := bytes.NewBuffer(nil)
+	diagnostics.Print(buffer)
+	c.Assert(buffer.String(), Equals, "error: no position [type-check-error]\n"+
+		"a.go:10:2: error: undefined type Request [unresolved-type]\n"+
+		"b.go:3:1: warning: dot import of fmt is not supported [dot-import]\n")
+
+	// only errors make up the error
+	c.Assert(diagnostics.Err(), ErrorMatches, "error: no position .*\na.go:10:2: error: undefined type Request .*")
+	c.Assert(diagnostics.Filter(SeverityWarning).Err(), IsNil)
+}
+
+func (s *TestSuite) TestLoaderDiagnostics(c *C) {
+	root := c.MkDir()
+	writeTestFiles(c, root, map[string]string{
+		"go.mod": "module example.com/diag\n",
+		"core/types.go": `package core
+
+import (
+	"example.com/missing/pkg"
+)
+
+type Request struct {
+	Filter  Filter
+	Options pkg.Options
+}
+
+type Request struct{}
+`,
+		"core/broken.go": `package core
+
+type Broken struct {
+`,
+	})
+	loader := NewLoader(NewTypeLibrary())
+	_, err := loader.Load(root + "/core")
+	c.Assert(err, IsNil)
+
+	codes := make(map[string]*Diagnostic)
+	for _, d := range loader.Diagnostics {
+		codes[d.Code] = d
+	}
+	c.Assert(codes[CodeParseError], NotNil)
+	c.Assert(codes[CodeRedefinition].Position.Line, Equals, 12)
+	c.Assert(codes[CodeUnresolvedType].Message, Equals, "undefined type Filter")
+	c.Assert(codes[CodeUnresolvedType].Position.Line, Equals, 8)
+	c.Assert(codes[CodeUnresolvedType].Position.Column, Equals, 10)
+	c.Assert(codes[CodeImportNotFound].Severity, Equals, SeverityWarning)
+	c.Assert(codes[CodeImportNotFound].Position.Line, Equals, 4)
+	c.Assert(loader.Diagnostics.HasErrors(), Equals, true)
+}
+
+func (s *TestSuite) TestImportDiagnostics(c *C) {
+	// packages outside modules (and GOPATH) have no import path
+	root := c.MkDir()
+	writeTestFiles(c, root, map[string]string{
+		"core/types.go": `package core
+
+import (
+	"example.com/missing/pkg"
+)
+
+type Request struct {
+	Options pkg.Options
+}
+`,
+		"other/types.go": `package other
+
+type Request struct{}
+`,
+	})
+	loader := NewLoader(NewTypeLibrary())
+	_, err := loader.Load(filepath.Join(root, "core"), filepath.Join(root, "other"))
+	c.Assert(err, IsNil)
+	c.Assert(loader.Diagnostics[0].Code, Equals, CodeImportPath)
+	c.Assert(loader.Diagnostics[0].Severity, Equals, SeverityWarning)
+	c.Assert(loader.Diagnostics[0].Position.Filename, Equals, filepath.Join(root, "core"))
+
+	// such packages get import paths of their own (so they do not clash)
+	corePath, otherPath := localImportPath(filepath.Join(root, "core")), localImportPath(filepath.Join(root, "other"))
+	c.Assert(loader.Diagnostics.HasErrors(), Equals, false)
+	c.Assert(loader.Packages[corePath].Name, Equals, "core")
+	c.Assert(loader.Packages[otherPath].Name, Equals, "other")
+	c.Assert(loader.TypeLibrary.GetType(corePath, "Request").AsRecordType().Fields[0].Name, Equals, "Options")
+	c.Assert(loader.TypeLibrary.GetType(otherPath, "Request").AsRecordType().Fields, IsNil)
+
+	checker := NewTypeChecker(NewTypeLibrary())
+	pkgs, err := checker.Load(filepath.Join(root, "core"), filepath.Join(root, "other"))
+	c.Assert(err, IsNil)
+	c.Assert(len(pkgs), Equals, 2)
+	c.Assert(pkgs[0].Path(), Equals, corePath)
+	c.Assert(pkgs[1].Path(), Equals, otherPath)
+	c.Assert(checker.Loader.TypeLibrary.GetType(otherPath, "Request").AsRecordType().Fields, IsNil)
+	codes := make(map[string]*Diagnostic)
+	for _, d := range checker.Diagnostics {
+		codes[d.Code] = d
+	}
+	c.Assert(checker.Diagnostics[0].Code, Equals, CodeImportPath)
+	c.Assert(checker.Diagnostics[0].Position.Filename, Equals, filepath.Join(root, "core"))
+	c.Assert(codes[CodeSourceImport].Severity, Equals, SeverityWarning)
+	c.Assert(codes[CodeSourceImport].Position.Filename, Equals, filepath.Join(root, "core"))
+	c.Assert(codes[CodeTypeCheckError], NotNil)
+}
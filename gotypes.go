@@ -0,0 +1,543 @@
+package bridge
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+)
+
+/**
+ * A front end that builds the type library from packages type checked with
+ * go/types instead of from the syntax alone (as ParsedFile does).  Aliases,
+ * embedded types, dot imports and types from other packages are resolved
+ * exactly by the type checker and then mapped onto the Type model.
+ *
+ * Imported packages are loaded with the same resolver and build context as
+ * the Loader.  The standard library (and any package that cannot be found
+ * that way) is imported with the go/importer source importer.
+ */
+type TypeChecker struct {
+	// Used for resolving patterns, import paths and the files in packages
+	Loader *Loader
+
+	Fset *token.FileSet
+
+	// Errors reported by the type checker.  Packages with errors are still
+	// added to the type library.
+	Errors []error
+
+	// Problems found while parsing and type checking (including Errors)
+	Diagnostics Diagnostics
+
+	// Packages type checked so far (and their files) indexed by import path
+	packages map[string]*types.Package
+	files    map[string][]*ast.File
+
+	// Doc comments of the types, fields and methods in the type checked
+	// files indexed by the position of their names
+	docs map[token.Pos]string
+
+	fallbackImporter types.ImporterFrom
+
+	// Library types created for each named type and type parameter
+	types      map[*types.TypeName]*Type
+	typeParams map[*types.TypeParam]*Type
+}
+
+func NewTypeChecker(typeLibrary ITypeLibrary) *TypeChecker {
+	fset := token.NewFileSet()
+	return &TypeChecker{
+		Loader:           NewLoader(typeLibrary),
+		Fset:             fset,
+		packages:         make(map[string]*types.Package),
+		files:            make(map[string][]*ast.File),
+		docs:             make(map[token.Pos]string),
+		fallbackImporter: importer.ForCompiler(fset, "source", nil).(types.ImporterFrom),
+		types:            make(map[*types.TypeName]*Type),
+		typeParams:       make(map[*types.TypeParam]*Type),
+	}
+}
+
+/**
+ * Type checks the packages matching the patterns (see Loader for the
+ * format) and adds all the types declared in them to the type library.
+ * Types from other packages are added as they are referenced.
+ */
+func (tc *TypeChecker) Load(patterns ...string) ([]*types.Package, error) {
+	var out []*types.Package
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		dirs, recursive, err := tc.Loader.expandPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			importPath, err := tc.Loader.Resolver.ImportPath(dir)
+			if err != nil {
+				importPath = localImportPath(dir)
+				tc.Diagnostics.AddWarning(token.Position{Filename: dir}, CodeImportPath,
+					"cannot resolve the import path of the package, using %s", importPath)
+			}
+			pkg, err := tc.checkDir(dir, importPath)
+			if _, ok := err.(*build.NoGoError); ok && recursive {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			tc.AddPackage(pkg)
+			out = append(out, pkg)
+		}
+	}
+	return out, nil
+}
+
+/**
+ * Parses and type checks the package in a folder.
+ */
+func (tc *TypeChecker) checkDir(dir string, importPath string) (*types.Package, error) {
+	if pkg, ok := tc.packages[importPath]; ok {
+		return pkg, nil
+	}
+	buildPkg, err := tc.Loader.Context.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	var files []*ast.File
+	for _, fileName := range append(buildPkg.GoFiles, buildPkg.CgoFiles...) {
+		file, err := parser.ParseFile(tc.Fset, filepath.Join(dir, fileName), nil, parser.ParseComments)
+		if errorList, ok := err.(scanner.ErrorList); ok {
+			for _, parseError := range errorList {
+				tc.Diagnostics.AddError(parseError.Pos, CodeParseError, "%s", parseError.Msg)
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		tc.addDocs(file)
+	}
+	config := &types.Config{
+		Importer:    tc,
+		FakeImportC: true,
+		Error: func(err error) {
+			tc.Errors = append(tc.Errors, err)
+			if typeError, ok := err.(types.Error); ok {
+				tc.Diagnostics.AddError(typeError.Fset.Position(typeError.Pos), CodeTypeCheckError, "%s", typeError.Msg)
+			} else {
+				tc.Diagnostics.AddError(token.Position{}, CodeTypeCheckError, "%s", err)
+			}
+		},
+	}
+	// errors are collected above so only fail if there is no package at all
+	pkg, _ := config.Check(importPath, tc.Fset, files, nil)
+	if pkg == nil {
+		return nil, fmt.Errorf("Cannot type check package in %s", dir)
+	}
+	tc.packages[importPath] = pkg
+	tc.files[importPath] = files
+	return pkg, nil
+}
+
+/**
+ * Indexes the doc comments of the type and method declarations (and of
+ * the fields and methods of structs and interfaces) in a file.  Embedded fields are indexed by the position of the
+ * name of their type as that is where go/types declares them.
+ */
+func (tc *TypeChecker) addDocs(file *ast.File) {
+	for _, decl := range file.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Recv != nil {
+			tc.docs[funcDecl.Name.Pos()] = funcDecl.Doc.Text()
+			continue
+		}
+		gendecl, ok := decl.(*ast.GenDecl)
+		if !ok || gendecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gendecl.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			tc.docs[typeSpec.Name.Pos()] = declDoc(gendecl, typeSpec)
+		}
+	}
+	ast.Inspect(file, func(node ast.Node) bool {
+		var fields *ast.FieldList
+		switch typeExpr := node.(type) {
+		case *ast.StructType:
+			fields = typeExpr.Fields
+		case *ast.InterfaceType:
+			fields = typeExpr.Methods
+		default:
+			return true
+		}
+		for _, field := range fields.List {
+			doc := fieldDoc(field)
+			for _, name := range field.Names {
+				tc.docs[name.Pos()] = doc
+			}
+			if len(field.Names) == 0 {
+				tc.docs[embeddedNamePos(field.Type)] = doc
+			}
+		}
+		return true
+	})
+}
+
+func embeddedNamePos(expr ast.Expr) token.Pos {
+	switch typeExpr := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedNamePos(typeExpr.X)
+	case *ast.SelectorExpr:
+		return typeExpr.Sel.Pos()
+	case *ast.IndexExpr:
+		return embeddedNamePos(typeExpr.X)
+	case *ast.IndexListExpr:
+		return embeddedNamePos(typeExpr.X)
+	}
+	return expr.Pos()
+}
+
+/**
+ * Returns the declaration of a type in a type checked package (or nil if
+ * it is not found or the package was imported from the standard library).
+ */
+func (tc *TypeChecker) LookupDecl(pkg string, name string) *DeclInfo {
+	for _, file := range tc.files[pkg] {
+		if out := findDeclInfo(tc.Fset, file, pkg, name); out != nil {
+			return out
+		}
+	}
+	return nil
+}
+
+func (tc *TypeChecker) Import(importPath string) (*types.Package, error) {
+	return tc.ImportFrom(importPath, "", 0)
+}
+
+/**
+ * Imports a package (for the type checker) as seen from the folder of the
+ * importing package.
+ */
+func (tc *TypeChecker) ImportFrom(importPath string, dir string, mode types.ImportMode) (*types.Package, error) {
+	if importPath == "unsafe" {
+		return types.Unsafe, nil
+	}
+	if pkg, ok := tc.packages[importPath]; ok {
+		return pkg, nil
+	}
+	if !IsStandardImportPath(importPath) {
+		pkgDir, err := tc.Loader.Resolver.FindDir(importPath, dir)
+		if err == nil {
+			var pkg *types.Package
+			if pkg, err = tc.checkDir(pkgDir, importPath); err == nil {
+				return pkg, nil
+			}
+		}
+		tc.Diagnostics.AddWarning(token.Position{Filename: dir}, CodeSourceImport,
+			"importing %s with the source importer: %s", importPath, err)
+	}
+	pkg, err := tc.fallbackImporter.ImportFrom(importPath, dir, mode)
+	if err == nil {
+		tc.packages[importPath] = pkg
+	}
+	return pkg, err
+}
+
+/**
+ * Adds all the types declared in a package to the type library.  Aliases
+ * are added as AliasTypes but references to them elsewhere refer directly
+ * to the type they alias.  Placeholders for aliases (referred to before the
+ * package was loaded) are filled in and other types already in the library
+ * under the name of an alias are reported.
+ */
+func (tc *TypeChecker) AddPackage(pkg *types.Package) {
+	typeLibrary := tc.Loader.TypeLibrary
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		typeName, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		t := tc.TypeFor(typeName.Type())
+		if typeName.IsAlias() {
+			aliasData := &AliasTypeData{NamedTypeData: NamedTypeData{Name: name, Package: pkg.Path()}, TargetType: t, IsAlias: true}
+			out := typeLibrary.AddType(pkg.Path(), name, &Type{TypeClass: AliasType, TypeData: aliasData})
+			if out.TypeClass == NullType || out.TypeClass == UnresolvedType || out.TypeClass == NamedType {
+				out.TypeClass, out.TypeData = AliasType, aliasData
+			} else if existing, ok := out.TypeData.(*AliasTypeData); !ok || !existing.IsAlias || existing.TargetType != t {
+				tc.Diagnostics.AddError(tc.Fset.Position(typeName.Pos()), CodeRedefinition,
+					"%s redeclared in package %s", name, pkg.Path())
+			}
+		}
+	}
+}
+
+/**
+ * Returns the library type for a go/types type, adding named types to the
+ * library as they are encountered.
+ */
+func (tc *TypeChecker) TypeFor(t types.Type) *Type {
+	typeLibrary := tc.Loader.TypeLibrary
+	switch t := types.Unalias(t).(type) {
+	case *types.Basic:
+		if t.Kind() == types.UnsafePointer {
+			return tc.namedType("unsafe", "Pointer")
+		}
+		if out := typeLibrary.GetGlobalType(t.Name()); out != nil {
+			return out
+		}
+		return typeLibrary.AddGlobalType(t.Name())
+	case *types.Pointer:
+		return &Type{TypeClass: ReferenceType, TypeData: &ReferenceTypeData{TargetType: tc.TypeFor(t.Elem())}}
+	case *types.Slice:
+		return &Type{TypeClass: ListType, TypeData: &ListTypeData{TargetType: tc.TypeFor(t.Elem())}}
+	case *types.Array:
+		listData := &ListTypeData{TargetType: tc.TypeFor(t.Elem()), IsArray: true, Length: int(t.Len())}
+		return &Type{TypeClass: ListType, TypeData: listData}
+	case *types.Chan:
+		channelData := &ChannelTypeData{ElementType: tc.TypeFor(t.Elem())}
+		switch t.Dir() {
+		case types.SendOnly:
+			channelData.Dir = SendOnly
+		case types.RecvOnly:
+			channelData.Dir = RecvOnly
+		}
+		return &Type{TypeClass: ChannelType, TypeData: channelData}
+	case *types.Map:
+		return &Type{TypeClass: MapType, TypeData: &MapTypeData{KeyType: tc.TypeFor(t.Key()), ValueType: tc.TypeFor(t.Elem())}}
+	case *types.Signature:
+		functionType := &FunctionTypeData{IsVariadic: t.Variadic()}
+		functionType.InputTypes, functionType.InputNames = tc.tupleTypes(t.Params())
+		functionType.OutputTypes, functionType.OutputNames = tc.tupleTypes(t.Results())
+		return &Type{TypeClass: FunctionType, TypeData: functionType}
+	case *types.Struct:
+		recordData := &RecordTypeData{}
+		tc.addStructFields(recordData, t)
+		return &Type{TypeClass: RecordType, TypeData: recordData}
+	case *types.Interface:
+		recordData := &RecordTypeData{IsInterface: true}
+		tc.addInterfaceMethods(recordData, t)
+		return &Type{TypeClass: RecordType, TypeData: recordData}
+	case *types.Named:
+		return tc.namedTypeFor(t)
+	case *types.TypeParam:
+		return tc.typeParamFor(t)
+	case *types.Union:
+		unionData := &UnionTypeData{}
+		for i := 0; i < t.Len(); i++ {
+			unionData.Terms = append(unionData.Terms, &UnionTerm{Tilde: t.Term(i).Tilde(), Type: tc.TypeFor(t.Term(i).Type())})
+		}
+		return &Type{TypeClass: UnionType, TypeData: unionData}
+	}
+	tc.Diagnostics.AddWarning(token.Position{}, CodeUnsupportedType, "unsupported type %s", t)
+	return &Type{TypeClass: NullType}
+}
+
+/**
+ * Returns the library type for a named type.  Named structs and interfaces
+ * become records while other named types (eg "type ID string") become
+ * AliasTypes wrapping their underlying type.
+ */
+func (tc *TypeChecker) namedTypeFor(named *types.Named) *Type {
+	if named.TypeArgs().Len() > 0 {
+		instanceData := &InstanceTypeData{GenericType: tc.namedTypeFor(named.Origin())}
+		for i := 0; i < named.TypeArgs().Len(); i++ {
+			instanceData.TypeArgs = append(instanceData.TypeArgs, tc.TypeFor(named.TypeArgs().At(i)))
+		}
+		return &Type{TypeClass: InstanceType, TypeData: instanceData}
+	}
+
+	typeName := named.Origin().Obj()
+	if out, ok := tc.types[typeName]; ok {
+		return out
+	}
+	typeLibrary := tc.Loader.TypeLibrary
+	if typeName.Pkg() == nil {
+		// predeclared types like error
+		if out := typeLibrary.GetGlobalType(typeName.Name()); out != nil {
+			return out
+		}
+		return typeLibrary.AddGlobalType(typeName.Name())
+	}
+
+	// Reuse any placeholder already in the library so existing references
+	// to it are resolved.  The type is registered before its definition is
+	// mapped so recursive types refer back to it.
+	namedData := NamedTypeData{Name: typeName.Name(), Package: typeName.Pkg().Path()}
+	out := typeLibrary.GetType(namedData.Package, namedData.Name)
+	if out == nil {
+		out = typeLibrary.AddType(namedData.Package, namedData.Name, &Type{})
+	}
+	tc.types[typeName] = out
+	var typeParams []*Type
+	for i := 0; i < named.TypeParams().Len(); i++ {
+		typeParams = append(typeParams, tc.typeParamFor(named.TypeParams().At(i)))
+	}
+	doc, position := tc.docs[typeName.Pos()], tc.Fset.Position(typeName.Pos())
+	switch underlying := named.Origin().Underlying().(type) {
+	case *types.Struct:
+		recordData := &RecordTypeData{NamedTypeData: namedData, TypeParams: typeParams, Doc: doc, Position: position}
+		out.TypeClass, out.TypeData = RecordType, recordData
+		tc.addStructFields(recordData, underlying)
+	case *types.Interface:
+		recordData := &RecordTypeData{NamedTypeData: namedData, TypeParams: typeParams, IsInterface: true, Doc: doc, Position: position}
+		out.TypeClass, out.TypeData = RecordType, recordData
+		tc.addInterfaceMethods(recordData, underlying)
+	default:
+		aliasData := &AliasTypeData{NamedTypeData: namedData, TypeParams: typeParams}
+		out.TypeClass, out.TypeData = AliasType, aliasData
+		aliasData.TargetType = tc.TypeFor(underlying)
+		if functionData, ok := aliasData.TargetType.TypeData.(*FunctionTypeData); ok {
+			functionData.Doc, functionData.Position = doc, position
+		}
+	}
+	if out.TypeClass != RecordType || !out.AsRecordType().IsInterface {
+		tc.addMethods(out, named.Origin())
+	}
+	return out
+}
+
+/**
+ * Adds the methods declared on a named (non interface) type in the order
+ * they are declared.  The type parameters named by the receivers of the
+ * methods of generic types are those of the type.
+ */
+func (tc *TypeChecker) addMethods(t *Type, named *types.Named) {
+	methods := make([]*types.Func, named.NumMethods())
+	for i := range methods {
+		methods[i] = named.Method(i)
+	}
+	sort.SliceStable(methods, func(i, j int) bool { return methods[i].Pos() < methods[j].Pos() })
+	typeParams := t.TypeParams()
+	for _, method := range methods {
+		signature := method.Type().(*types.Signature)
+		for i := 0; i < signature.RecvTypeParams().Len() && i < len(typeParams); i++ {
+			tc.typeParams[signature.RecvTypeParams().At(i)] = typeParams[i]
+		}
+		_, pointerReceiver := signature.Recv().Type().(*types.Pointer)
+		out := &Method{Name: method.Name(), Type: tc.TypeFor(signature), PointerReceiver: pointerReceiver,
+			Doc: tc.docs[method.Pos()], Position: tc.Fset.Position(method.Pos())}
+		functionData := out.Type.AsFunctionType()
+		functionData.Doc, functionData.Position = out.Doc, out.Position
+		t.AddMethod(out)
+	}
+}
+
+/**
+ * Returns the types and names of the variables in a parameter/result tuple.
+ * The names are nil if the variables are unnamed.
+ */
+func (tc *TypeChecker) tupleTypes(tuple *types.Tuple) ([]*Type, []string) {
+	var outTypes []*Type
+	names := make([]string, tuple.Len())
+	named := false
+	for i := 0; i < tuple.Len(); i++ {
+		outTypes = append(outTypes, tc.TypeFor(tuple.At(i).Type()))
+		names[i] = tuple.At(i).Name()
+		named = named || names[i] != ""
+	}
+	if !named {
+		names = nil
+	}
+	return outTypes, names
+}
+
+/**
+ * Returns the library type for a type parameter (along with its
+ * constraint).  Constraints that are just a union (eg ~int | ~string) are
+ * mapped to the union and the empty interface is mapped to any.
+ */
+func (tc *TypeChecker) typeParamFor(typeParam *types.TypeParam) *Type {
+	if out, ok := tc.typeParams[typeParam]; ok {
+		return out
+	}
+	paramData := &TypeParamData{Name: typeParam.Obj().Name(), Index: typeParam.Index()}
+	out := &Type{TypeClass: TypeParamType, TypeData: paramData}
+	tc.typeParams[typeParam] = out
+
+	constraint := typeParam.Constraint()
+	if iface, ok := constraint.Underlying().(*types.Interface); ok && types.Unalias(constraint) == constraint.Underlying() {
+		if iface.Empty() {
+			constraint = types.Universe.Lookup("any").Type()
+		} else if iface.IsImplicit() && iface.NumEmbeddeds() == 1 {
+			constraint = iface.EmbeddedType(0)
+		}
+	}
+	if constraint.String() == "any" {
+		paramData.Constraint = tc.globalType("any")
+	} else {
+		paramData.Constraint = tc.TypeFor(constraint)
+	}
+	return out
+}
+
+func (tc *TypeChecker) globalType(name string) *Type {
+	typeLibrary := tc.Loader.TypeLibrary
+	if out := typeLibrary.GetGlobalType(name); out != nil {
+		return out
+	}
+	return typeLibrary.AddGlobalType(name)
+}
+
+/**
+ * Returns the named type (with no definition) for a name in a package.
+ */
+func (tc *TypeChecker) namedType(pkgPath string, name string) *Type {
+	typeLibrary := tc.Loader.TypeLibrary
+	if out := typeLibrary.GetType(pkgPath, name); out != nil {
+		return out
+	}
+	return typeLibrary.AddType(pkgPath, name, &Type{TypeClass: NamedType, TypeData: &NamedTypeData{Name: name, Package: pkgPath}})
+}
+
+/**
+ * Adds the fields of a struct to a record.  Embedded fields are added as
+ * unnamed fields and also added to the bases of the record.
+ */
+func (tc *TypeChecker) addStructFields(recordData *RecordTypeData, structType *types.Struct) {
+	for i := 0; i < structType.NumFields(); i++ {
+		field := structType.Field(i)
+		fieldType := tc.TypeFor(field.Type())
+		name := field.Name()
+		if field.Embedded() {
+			name = ""
+			recordData.Bases = append(recordData.Bases, fieldType)
+		}
+		recordData.Fields = append(recordData.Fields, &Field{Name: name, Type: fieldType, Tag: structType.Tag(i),
+			Doc: tc.docs[field.Pos()], Position: tc.Fset.Position(field.Pos())})
+	}
+}
+
+/**
+ * Adds the methods of an interface to a record.  Embedded interfaces are
+ * added as unnamed fields and also added to the bases of the record.
+ */
+func (tc *TypeChecker) addInterfaceMethods(recordData *RecordTypeData, interfaceType *types.Interface) {
+	for i := 0; i < interfaceType.NumEmbeddeds(); i++ {
+		embeddedType := tc.TypeFor(interfaceType.EmbeddedType(i))
+		recordData.Bases = append(recordData.Bases, embeddedType)
+		recordData.Fields = append(recordData.Fields, &Field{Type: embeddedType})
+	}
+	// go/types sorts methods by name so restore the declaration order
+	methods := make([]*types.Func, interfaceType.NumExplicitMethods())
+	for i := range methods {
+		methods[i] = interfaceType.ExplicitMethod(i)
+	}
+	sort.SliceStable(methods, func(i, j int) bool { return methods[i].Pos() < methods[j].Pos() })
+	for _, method := range methods {
+		field := &Field{Name: method.Name(), Type: tc.TypeFor(method.Type()),
+			Doc: tc.docs[method.Pos()], Position: tc.Fset.Position(method.Pos())}
+		functionData := field.Type.AsFunctionType()
+		functionData.Doc, functionData.Position = field.Doc, field.Position
+		recordData.Fields = append(recordData.Fields, field)
+	}
+}
@@ -0,0 +1,225 @@
+package bridge
+
+import (
+	. "gopkg.in/check.v1"
+	"path/filepath"
+)
+
+var testTypedModuleFiles = map[string]string{
+	"go.mod": "module example.com/typed\n",
+	"core/service.go": `package core
+
+import (
+	. "example.com/typed/models"
+	"time"
+)
+
+type UserAlias = User
+
+type ID string
+
+type Audited struct {
+	CreatedAt time.Time
+}
+
+// An account owned by a user
+type Account struct {
+	Audited
+	Id    ID "json:\"id\""
+	Owner *UserAlias
+	Teams []Team
+}
+
+type IService interface {
+	// Returns an account by id
+	GetAccount(id ID) (*Account, error)
+	Close() error
+	Watch(ids ...ID) <-chan [2]ID
+}
+`,
+	"models/models.go": `package models
+
+type User struct {
+	Name string
+}
+
+type Team struct {
+	Members map[string]*User
+}
+
+func (u User) String() string {
+	return u.Name
+}
+
+// Adds a member to the team
+func (t *Team) Add(user *User) {
+	t.Members[user.Name] = user
+}
+`,
+}
+
+func (s *TestSuite) TestTypeCheckerLoad(c *C) {
+	root := c.MkDir()
+	writeTestFiles(c, root, testTypedModuleFiles)
+	typeLibrary := NewTypeLibrary()
+	checker := NewTypeChecker(typeLibrary)
+	pkgs, err := checker.Load(filepath.Join(root, "core"))
+	c.Assert(err, IsNil)
+	c.Assert(checker.Errors, IsNil)
+	c.Assert(len(pkgs), Equals, 1)
+	c.Assert(pkgs[0].Path(), Equals, "example.com/typed/core")
+
+	account := typeLibrary.GetType("example.com/typed/core", "Account")
+	c.Assert(account.TypeClass, Equals, RecordType)
+	record := account.AsRecordType()
+	c.Assert(len(record.Fields), Equals, 4)
+	c.Assert(record.Doc, Equals, "An account owned by a user\n")
+	c.Assert(record.Fields[1].Tag, Equals, `json:"id"`)
+
+	// embedded fields are unnamed and are bases
+	audited := typeLibrary.GetType("example.com/typed/core", "Audited")
+	c.Assert(record.Fields[0].Name, Equals, "")
+	c.Assert(record.Fields[0].Type, Equals, audited)
+	c.Assert(record.Bases, DeepEquals, []*Type{audited})
+
+	// defined non struct types wrap their underlying types
+	id := record.Fields[1].Type.AsAliasType()
+	c.Assert(id.NamedTypeData, Equals, NamedTypeData{"ID", "example.com/typed/core"})
+	c.Assert(id.TargetType, Equals, typeLibrary.GetGlobalType("string"))
+	c.Assert(id.IsAlias, Equals, false)
+
+	// aliases and dot imports resolve to the types in the other package
+	user := typeLibrary.GetType("example.com/typed/models", "User")
+	c.Assert(user.TypeClass, Equals, RecordType)
+	c.Assert(record.Fields[2].Type.AsReferenceType().TargetType, Equals, user)
+	userAlias := typeLibrary.GetType("example.com/typed/core", "UserAlias").AsAliasType()
+	c.Assert(userAlias.IsAlias, Equals, true)
+	c.Assert(userAlias.TargetType, Equals, user)
+	team := record.Fields[3].Type.AsListType().TargetType
+	c.Assert(team, Equals, typeLibrary.GetType("example.com/typed/models", "Team"))
+	c.Assert(team.AsRecordType().Fields[0].Type.AsMapType().ValueType.AsReferenceType().TargetType, Equals, user)
+
+	// types from the standard library
+	createdAt := audited.AsRecordType().Fields[0].Type
+	c.Assert(createdAt.TypeClass, Equals, RecordType)
+	c.Assert(createdAt.AsRecordType().NamedTypeData, Equals, NamedTypeData{"Time", "time"})
+
+	// interface methods are in declaration order
+	service := typeLibrary.GetType("example.com/typed/core", "IService").AsRecordType()
+	c.Assert(service.Fields[0].Name, Equals, "GetAccount")
+	c.Assert(service.Fields[1].Name, Equals, "Close")
+	getAccount := service.Fields[0].Type.AsFunctionType()
+	c.Assert(getAccount.OutputTypes[1], Equals, typeLibrary.GetGlobalType("error"))
+	c.Assert(getAccount.Doc, Equals, "Returns an account by id\n")
+	c.Assert(service.Fields[0].Position.Line, Equals, 26)
+	c.Assert(getAccount.InputNames, DeepEquals, []string{"id"})
+	c.Assert(getAccount.OutputNames, IsNil)
+	watch := service.Fields[2].Type.AsFunctionType()
+	c.Assert(watch.IsVariadic, Equals, true)
+	c.Assert(watch.IsStreaming(), Equals, true)
+	c.Assert(typeLibrary.Signature(watch.OutputTypes[0]), Equals, "<-chan [2]example.com/typed/core.ID")
+
+	// methods declared on concrete types
+	c.Assert(len(user.Methods()), Equals, 1)
+	c.Assert(user.Methods()[0].PointerReceiver, Equals, false)
+	c.Assert(typeLibrary.Signature(user.Methods()[0].Type), Equals, "func() string")
+	add := team.Methods()[0]
+	c.Assert(add.Name, Equals, "Add")
+	c.Assert(add.PointerReceiver, Equals, true)
+	c.Assert(add.Doc, Equals, "Adds a member to the team\n")
+	c.Assert(add.Type.AsFunctionType().InputTypes[0].AsReferenceType().TargetType, Equals, user)
+
+	decl := checker.LookupDecl("example.com/typed/models", "Team")
+	c.Assert(decl.Position.Line, Equals, 7)
+	c.Assert(checker.LookupDecl("time", "Time"), IsNil)
+}
+
+func (s *TestSuite) TestTypeCheckerGenerics(c *C) {
+	root := c.MkDir()
+	writeTestFiles(c, root, map[string]string{
+		"go.mod": "module example.com/generic\n",
+		"core/page.go": `package core
+
+type Key interface {
+	~int | ~string
+}
+
+type Page[T any] struct {
+	Items []T
+}
+
+type Index[K Key, V comparable] map[K]V
+
+type Feed struct {
+	Current Page[string]
+}
+`,
+	})
+	typeLibrary := NewTypeLibrary()
+	checker := NewTypeChecker(typeLibrary)
+	_, err := checker.Load(filepath.Join(root, "core"))
+	c.Assert(err, IsNil)
+	c.Assert(checker.Errors, IsNil)
+
+	page := typeLibrary.GetType("example.com/generic/core", "Page")
+	params := page.TypeParams()
+	c.Assert(len(params), Equals, 1)
+	c.Assert(page.AsRecordType().Fields[0].Type.AsListType().TargetType, Equals, params[0])
+	c.Assert(typeLibrary.TypeParamsSignature(page), Equals, "[T any]")
+
+	index := typeLibrary.GetType("example.com/generic/core", "Index")
+	c.Assert(typeLibrary.TypeParamsSignature(index), Equals, "[K example.com/generic/core.Key, V comparable]")
+	key := typeLibrary.GetType("example.com/generic/core", "Key").AsRecordType()
+	c.Assert(typeLibrary.Signature(key.Bases[0]), Equals, "~int | ~string")
+
+	current := typeLibrary.GetType("example.com/generic/core", "Feed").AsRecordType().Fields[0].Type
+	c.Assert(current.AsInstanceType().GenericType, Equals, page)
+	c.Assert(typeLibrary.Signature(current), Equals, "example.com/generic/core.Page[string]")
+}
+
+func (s *TestSuite) TestTypeCheckerDiagnostics(c *C) {
+	root := c.MkDir()
+	writeTestFiles(c, root, map[string]string{
+		"go.mod": "module example.com/broken\n",
+		"core/types.go": `package core
+
+type Request struct {
+	Filter Filter
+}
+`,
+	})
+	checker := NewTypeChecker(NewTypeLibrary())
+	_, err := checker.Load(filepath.Join(root, "core"))
+	c.Assert(err, IsNil)
+	c.Assert(len(checker.Errors), Equals, 1)
+	c.Assert(len(checker.Diagnostics), Equals, 1)
+	c.Assert(checker.Diagnostics[0].Code, Equals, CodeTypeCheckError)
+	c.Assert(checker.Diagnostics[0].Position.Line, Equals, 4)
+	c.Assert(checker.Diagnostics[0].Message, Equals, "undefined: Filter")
+}
+
+func (s *TestSuite) TestTypeCheckerAliasPlaceholders(c *C) {
+	root := c.MkDir()
+	writeTestFiles(c, root, testTypedModuleFiles)
+	typeLibrary := NewTypeLibrary()
+
+	// placeholders for aliases referred to before their package is loaded
+	// are filled in and other types under their names are reported
+	placeholder := typeLibrary.AddType("example.com/typed/core", "UserAlias", &Type{TypeClass: NamedType, TypeData: &NamedTypeData{"UserAlias", "example.com/typed/core"}})
+	typeLibrary.AddType("example.com/typed/models", "Renamed", &Type{TypeClass: RecordType, TypeData: &RecordTypeData{NamedTypeData: NamedTypeData{"Renamed", "example.com/typed/models"}}})
+	writeTestFiles(c, root, map[string]string{"models/alias.go": "package models\n\ntype Renamed = Team\n"})
+	checker := NewTypeChecker(typeLibrary)
+	_, err := checker.Load(filepath.Join(root, "core"), filepath.Join(root, "models"))
+	c.Assert(err, IsNil)
+
+	c.Assert(typeLibrary.GetType("example.com/typed/core", "UserAlias"), Equals, placeholder)
+	c.Assert(placeholder.TypeClass, Equals, AliasType)
+	c.Assert(placeholder.AsAliasType().IsAlias, Equals, true)
+	c.Assert(placeholder.AsAliasType().TargetType, Equals, typeLibrary.GetType("example.com/typed/models", "User"))
+
+	c.Assert(checker.Diagnostics.HasErrors(), Equals, true)
+	c.Assert(len(checker.Diagnostics), Equals, 1)
+	c.Assert(checker.Diagnostics[0].Code, Equals, CodeRedefinition)
+	c.Assert(checker.Diagnostics[0].Position.Filename, Equals, filepath.Join(root, "models", "alias.go"))
+	c.Assert(typeLibrary.GetType("example.com/typed/models", "Renamed").TypeClass, Equals, RecordType)
+}
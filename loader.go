@@ -0,0 +1,403 @@
+package bridge
+
+import (
+	"fmt"
+	"go/build"
+	"go/scanner"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+ * A package loaded by a Loader.
+ */
+type Package struct {
+	Name       string
+	ImportPath string
+	Dir        string
+	Files      []*ParsedFile
+
+	// How many imports away this package is from the packages that were
+	// asked to be loaded (0 for those packages)
+	Depth int
+
+	// Whether the unresolved types in the package have been resolved (or
+	// reported)
+	resolved bool
+}
+
+/**
+ * Loads whole packages (instead of individual files) into a type library so
+ * that types declared in sibling files are resolved.  Packages are
+ * specified with patterns that can be:
+ *
+ * 	- folders (eg ./core),
+ * 	- folders with all their sub folders (eg ./... or ./core/...),
+ * 	- import paths (eg github.com/theuser/repo/core or
+ * 	github.com/theuser/repo/...),
+ * 	- go files, which load the package containing them.
+ *
+ * Only the files matching the build context (GOOS, GOARCH and build tags)
+ * are parsed and test files are skipped.  Imported packages are loaded on
+ * demand, ie only when types from them are referenced.
+ */
+type Loader struct {
+	TypeLibrary ITypeLibrary
+	Resolver    *PackageResolver
+
+	// Build context used to select the files in each package
+	Context build.Context
+
+	// How many levels of imports are followed to load referenced types (0
+	// disables loading imported packages)
+	ImportDepth int
+
+	// Whether types from the standard library are loaded.  These are
+	// usually opaque and have their own readers/writers.
+	IncludeStdlib bool
+
+	// All packages loaded so far indexed by import path
+	Packages map[string]*Package
+
+	// Problems found in the packages loaded so far.  Files that cannot be
+	// parsed are reported here (and skipped) instead of failing the load.
+	Diagnostics Diagnostics
+
+	// Types that could not be resolved in the packages loaded so far
+	Unresolved []*UnresolvedRef
+
+	// The package that first imported each import path
+	importedBy map[string]*Package
+
+	// Import paths that could not be loaded
+	failed map[string]error
+}
+
+func NewLoader(typeLibrary ITypeLibrary) *Loader {
+	return &Loader{
+		TypeLibrary: typeLibrary,
+		Resolver:    defaultResolver,
+		Context:     build.Default,
+		ImportDepth: 1,
+		Packages:    make(map[string]*Package),
+		importedBy:  make(map[string]*Package),
+		failed:      make(map[string]error),
+	}
+}
+
+/**
+ * Loads the packages matching the patterns (along with the packages they
+ * import that are referenced) and returns the packages that matched.
+ * Errors are only returned if packages cannot be found or read, problems in
+ * the code of the packages are added to Diagnostics.
+ */
+func (l *Loader) Load(patterns ...string) ([]*Package, error) {
+	var out []*Package
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		dirs, recursive, err := l.expandPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			pkg, err := l.LoadDir(dir, "", 0)
+			if _, ok := err.(*build.NoGoError); ok && recursive {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			out = append(out, pkg)
+		}
+	}
+	if err := l.FollowImports(); err != nil {
+		return nil, err
+	}
+	l.resolveTypes()
+	return out, nil
+}
+
+/**
+ * Resolves the types that are still unresolved in the packages loaded
+ * (that have not been resolved yet) and reports those that cannot be.
+ */
+func (l *Loader) resolveTypes() *ResolutionReport {
+	importPaths := make([]string, 0, len(l.Packages))
+	for importPath := range l.Packages {
+		importPaths = append(importPaths, importPath)
+	}
+	sort.Strings(importPaths)
+	var files []*ParsedFile
+	for _, importPath := range importPaths {
+		pkg := l.Packages[importPath]
+		if pkg.resolved {
+			continue
+		}
+		pkg.resolved = true
+		files = append(files, pkg.Files...)
+	}
+	report := resolveTypes(l.TypeLibrary, files, func(importPath string) bool {
+		_, loaded := l.Packages[importPath]
+		return loaded
+	})
+	l.Unresolved = append(l.Unresolved, report.Unresolved...)
+	l.Diagnostics = append(l.Diagnostics, report.Diagnostics...)
+	return report
+}
+
+/**
+ * Returns the folders matched by a pattern and whether the pattern was
+ * recursive (in which case folders without go files are to be skipped).
+ */
+func (l *Loader) expandPattern(pattern string) ([]string, bool, error) {
+	recursive := pattern == "..." || strings.HasSuffix(pattern, "/...")
+	root := strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+	if recursive && root == "" {
+		root = "."
+	}
+
+	var dir string
+	if info, err := os.Stat(root); err == nil {
+		dir = root
+		if !info.IsDir() {
+			if !strings.HasSuffix(root, ".go") || recursive {
+				return nil, false, fmt.Errorf("Invalid package pattern: %s", pattern)
+			}
+			dir = filepath.Dir(root)
+		}
+	} else if isLocalPath(root) {
+		return nil, false, err
+	} else {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, false, err
+		}
+		if dir, err = l.Resolver.FindDir(root, cwd); err != nil {
+			return nil, false, err
+		}
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, false, err
+	}
+	if !recursive {
+		return []string{dir}, false, nil
+	}
+
+	var out []string
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != dir {
+			// same rules as the go tool: skip vendor, testdata, hidden
+			// folders and nested modules
+			name := info.Name()
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+		out = append(out, path)
+		return nil
+	})
+	return out, true, err
+}
+
+func isLocalPath(pattern string) bool {
+	return filepath.IsAbs(pattern) || pattern == "." || pattern == ".." ||
+		strings.HasPrefix(pattern, "./") || strings.HasPrefix(pattern, "../")
+}
+
+/**
+ * Loads the package in a folder.  If the import path is empty then it is
+ * resolved from the folder.  Packages are only loaded once.
+ */
+func (l *Loader) LoadDir(dir string, importPath string, depth int) (*Package, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if importPath == "" {
+		importPath, err = l.Resolver.ImportPath(dir)
+		if err != nil {
+			importPath = localImportPath(dir)
+			l.Diagnostics.AddWarning(token.Position{Filename: dir}, CodeImportPath,
+				"cannot resolve the import path of the package, using %s", importPath)
+		}
+	}
+	if pkg, ok := l.Packages[importPath]; ok && pkg.Dir == dir {
+		if depth < pkg.Depth {
+			pkg.Depth = depth
+		}
+		return pkg, nil
+	}
+
+	buildPkg, err := l.Context.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	pkg := &Package{Name: buildPkg.Name, ImportPath: importPath, Dir: dir, Depth: depth}
+	for _, fileName := range append(buildPkg.GoFiles, buildPkg.CgoFiles...) {
+		parsedFile, err := NewParsedFileInPackage(filepath.Join(dir, fileName), importPath)
+		if errorList, ok := err.(scanner.ErrorList); ok {
+			for _, parseError := range errorList {
+				l.Diagnostics.AddError(parseError.Pos, CodeParseError, "%s", parseError.Msg)
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		pkg.Files = append(pkg.Files, parsedFile)
+		for name, path := range parsedFile.Imports {
+			if name != parsedFile.Package && l.importedBy[path] == nil {
+				l.importedBy[path] = pkg
+			}
+		}
+		for _, path := range parsedFile.DotImports {
+			if l.importedBy[path] == nil {
+				l.importedBy[path] = pkg
+			}
+		}
+	}
+	l.Packages[importPath] = pkg
+
+	for _, parsedFile := range pkg.Files {
+		parsedFile.ProcessNode(l.TypeLibrary)
+	}
+	// methods can be declared in other files than their receiver types
+	for _, parsedFile := range pkg.Files {
+		l.Diagnostics = append(l.Diagnostics, parsedFile.ProcessMethods(l.TypeLibrary)...)
+	}
+	return pkg, nil
+}
+
+/**
+ * Loads the imported packages whose types are referenced (but not yet
+ * defined) in the type library till there are no more packages to load.
+ * Packages that cannot be found are skipped and their types are left as
+ * they are.
+ */
+func (l *Loader) FollowImports() error {
+	for {
+		pending := l.pendingImports()
+		if len(pending) == 0 {
+			return nil
+		}
+		for _, importPath := range pending {
+			importer := l.importedBy[importPath]
+			dir, err := l.Resolver.FindDir(importPath, importer.Dir)
+			if err == nil {
+				_, err = l.LoadDir(dir, importPath, importer.Depth+1)
+			}
+			if err != nil {
+				l.Diagnostics.AddWarning(importPosition(importer, importPath), CodeImportNotFound,
+					"cannot load imported package %s: %s", importPath, err)
+				l.failed[importPath] = err
+			}
+		}
+	}
+}
+
+/**
+ * Returns the (sorted) import paths of packages to be loaded because types
+ * in them are referenced.  Packages that are dot imported are loaded
+ * regardless of the import depth as there is no telling which types are
+ * referred to from them.
+ */
+func (l *Loader) pendingImports() []string {
+	pending := make(map[string]bool)
+	for _, pkg := range l.Packages {
+		for _, parsedFile := range pkg.Files {
+			for _, importPath := range parsedFile.DotImports {
+				_, loaded := l.Packages[importPath]
+				if loaded || l.failed[importPath] != nil {
+					continue
+				}
+				if l.IncludeStdlib || !IsStandardImportPath(importPath) {
+					pending[importPath] = true
+				}
+			}
+		}
+	}
+	l.TypeLibrary.ForEach(func(key string, t *Type, stop *bool) {
+		if t.TypeClass != NamedType {
+			return
+		}
+		importPath := t.AsNamedType().Package
+		if importPath == "" || pending[importPath] || l.failed[importPath] != nil {
+			return
+		}
+		if _, loaded := l.Packages[importPath]; loaded {
+			return
+		}
+		importer := l.importedBy[importPath]
+		if importer == nil || importer.Depth >= l.ImportDepth {
+			return
+		}
+		if !l.IncludeStdlib && IsStandardImportPath(importPath) {
+			return
+		}
+		pending[importPath] = true
+	})
+	out := make([]string, 0, len(pending))
+	for importPath := range pending {
+		out = append(out, importPath)
+	}
+	sort.Strings(out)
+	return out
+}
+
+/**
+ * Returns the position of the (first) import of an import path in a
+ * package.
+ */
+func importPosition(pkg *Package, importPath string) token.Position {
+	for _, parsedFile := range pkg.Files {
+		for _, importSpec := range parsedFile.FileNode.Imports {
+			if path, err := strconv.Unquote(importSpec.Path.Value); err == nil && path == importPath {
+				return parsedFile.Position(importSpec.Pos())
+			}
+		}
+	}
+	return token.Position{Filename: pkg.Dir}
+}
+
+/**
+ * Tells if an import path is of a package in the standard library (ie its
+ * first element is not a domain name).
+ */
+func IsStandardImportPath(importPath string) bool {
+	first := importPath
+	if index := strings.Index(importPath, "/"); index >= 0 {
+		first = importPath[:index]
+	}
+	return !strings.Contains(first, ".")
+}
+
+/**
+ * Returns the declaration of a type in a loaded package (or nil if it is
+ * not found).
+ */
+func (l *Loader) LookupDecl(pkg string, name string) *DeclInfo {
+	if loaded, ok := l.Packages[pkg]; ok {
+		for _, parsedFile := range loaded.Files {
+			if out := parsedFile.DeclInfo(name); out != nil {
+				return out
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package bridge
+
+import (
+	. "gopkg.in/check.v1"
+	"path/filepath"
+)
+
+var testModuleFiles = map[string]string{
+	"go.mod": "module example.com/app\n",
+	"core/service.go": `package core
+
+import "example.com/app/models"
+
+type IService interface {
+	GetUser(request *GetUserRequest) (*models.User, error)
+}
+`,
+	"core/requests.go": `package core
+
+type GetUserRequest struct {
+	Id string
+}
+`,
+	"core/excluded.go": `//go:build sometag
+
+package core
+
+type Excluded struct {}
+`,
+	"core/service_test.go": `package core
+
+type OnlyInTests struct {}
+`,
+	"models/user.go": `package models
+
+type User struct {
+	Name string
+}
+`,
+	"docs/README": "no go files here\n",
+}
+
+func (s *TestSuite) TestLoaderLoadsWholePackage(c *C) {
+	root := c.MkDir()
+	writeTestFiles(c, root, testModuleFiles)
+	typeLibrary := NewTypeLibrary()
+	loader := NewLoader(typeLibrary)
+	loader.ImportDepth = 0
+	pkgs, err := loader.Load(filepath.Join(root, "core", "service.go"))
+	c.Assert(err, IsNil)
+	c.Assert(len(pkgs), Equals, 1)
+	c.Assert(pkgs[0].Name, Equals, "core")
+	c.Assert(pkgs[0].ImportPath, Equals, "example.com/app/core")
+	c.Assert(len(pkgs[0].Files), Equals, 2)
+
+	request := typeLibrary.GetType("example.com/app/core", "GetUserRequest")
+	c.Assert(request, NotNil)
+	c.Assert(request.TypeClass, Equals, RecordType)
+	c.Assert(typeLibrary.GetType("example.com/app/core", "Excluded"), IsNil)
+	c.Assert(typeLibrary.GetType("example.com/app/core", "OnlyInTests"), IsNil)
+
+	// imports are not followed
+	user := typeLibrary.GetType("example.com/app/models", "User")
+	c.Assert(user.TypeClass, Equals, NamedType)
+
+	decl := loader.LookupDecl("example.com/app/core", "GetUserRequest")
+	c.Assert(decl, NotNil)
+	c.Assert(filepath.Base(decl.Position.Filename), Equals, "requests.go")
+	c.Assert(loader.LookupDecl("example.com/app/models", "User"), IsNil)
+}
+
+func (s *TestSuite) TestLoaderBuildTags(c *C) {
+	root := c.MkDir()
+	writeTestFiles(c, root, testModuleFiles)
+	typeLibrary := NewTypeLibrary()
+	loader := NewLoader(typeLibrary)
+	loader.Context.BuildTags = []string{"sometag"}
+	_, err := loader.Load(filepath.Join(root, "core"))
+	c.Assert(err, IsNil)
+	c.Assert(typeLibrary.GetType("example.com/app/core", "Excluded"), NotNil)
+}
+
+func (s *TestSuite) TestLoaderFollowsImports(c *C) {
+	root := c.MkDir()
+	writeTestFiles(c, root, testModuleFiles)
+	typeLibrary := NewTypeLibrary()
+	loader := NewLoader(typeLibrary)
+	pkgs, err := loader.Load(filepath.Join(root, "core"))
+	c.Assert(err, IsNil)
+	c.Assert(len(pkgs), Equals, 1)
+
+	models := loader.Packages["example.com/app/models"]
+	c.Assert(models, NotNil)
+	c.Assert(models.Depth, Equals, 1)
+	user := typeLibrary.GetType("example.com/app/models", "User")
+	c.Assert(user.TypeClass, Equals, RecordType)
+	c.Assert(user.AsRecordType().Fields[0].Name, Equals, "Name")
+}
+
+func (s *TestSuite) TestLoaderRecursivePattern(c *C) {
+	root := c.MkDir()
+	writeTestFiles(c, root, testModuleFiles)
+	loader := NewLoader(NewTypeLibrary())
+	pkgs, err := loader.Load(root + "/...")
+	c.Assert(err, IsNil)
+	var importPaths []string
+	for _, pkg := range pkgs {
+		importPaths = append(importPaths, pkg.ImportPath)
+	}
+	c.Assert(importPaths, DeepEquals, []string{"example.com/app/core", "example.com/app/models"})
+}
+
+func (s *TestSuite) TestImportName(c *C) {
+	c.Assert(ImportName("fmt"), Equals, "fmt")
+	c.Assert(ImportName("net/http"), Equals, "http")
+	c.Assert(ImportName("example.com/lib/v2"), Equals, "lib")
+	c.Assert(ImportName("gopkg.in/yaml.v3"), Equals, "yaml")
+}
@@ -2,13 +2,19 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/panyam/bridge"
 	"github.com/panyam/bridge/rest"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io"
 	"log"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
 )
 
@@ -32,54 +38,151 @@ func NewGoTypeLibrary() bridge.ITypeLibrary {
 	typeLibrary.AddGlobalType("uint16")
 	typeLibrary.AddGlobalType("uint32")
 	typeLibrary.AddGlobalType("uint64")
+	typeLibrary.AddGlobalType("rune")
+	typeLibrary.AddGlobalType("any")
+	typeLibrary.AddGlobalType("comparable")
+	return typeLibrary
 }
 
 func main() {
-	var serviceName, operation string
+	var specPath, serviceName, servicePackage, operation, templatesDir, dumpTypesPath string
+	var typeCheck bool
+	flag.StringVar(&specPath, "spec", "", "Spec file (YAML or JSON) listing the files to parse, the service, its bindings and where the output is to be written.  When provided the remaining flags are ignored")
 	flag.StringVar(&serviceName, "service", "", "The service whose methods are to be extracted and for whome binding code is to be generated")
+	flag.StringVar(&servicePackage, "package", "core", "The package the service is defined in")
+	flag.StringVar(&templatesDir, "templates", "", "Folder with templates overriding the built in templates")
+	flag.BoolVar(&typeCheck, "typecheck", false, "Resolve types with the go type checker instead of from the syntax alone")
+	flag.StringVar(&dumpTypesPath, "dumptypes", "", "File the loaded type library is written to (as json) for use by other tools")
 	flag.StringVar(&operation, "operation", "", "The operation within the service to be generated code for.  If this is empty or not provided then ALL operations in the service will code generated for them")
 
 	flag.Parse()
 
-	if serviceName == "" {
-		log.Println("Service required")
+	spec, err := SpecFromFlags(specPath, serviceName, servicePackage, templatesDir, flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	// TODO: Get files to parse from some spec file
-	_, typeLibrary := ParseFiles(flag.Args())
+	spec.TypeCheck = spec.TypeCheck || typeCheck
+	patterns, err := spec.PackagePatterns()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	typeLibrary, err := NewSpecTypeLibrary(spec)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	diagnostics, err := LoadPackages(typeLibrary, patterns, spec.TypeCheck)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	diagnostics.Sort()
+	diagnostics.Print(os.Stderr)
+	if diagnostics.HasErrors() {
+		os.Exit(1)
+	}
+	if dumpTypesPath != "" {
+		if err := DumpTypes(typeLibrary, dumpTypesPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
 
-	// TODO: Get service package from spec file
-	serviceType := typeLibrary.GetType("core", serviceName)
-	CreateClientForType(typeLibrary, serviceType)
+	serviceType := typeLibrary.GetType(spec.Service.Package, spec.Service.Name)
+	if serviceType == nil {
+		fmt.Fprintf(os.Stderr, "Service %s not found in package %s\n", spec.Service.Name, spec.Service.Package)
+		os.Exit(1)
+	}
+	if err := CreateClientForType(typeLibrary, serviceType, spec, operation); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
-func ParseFiles(fileNames []string) (map[string]*bridge.ParsedFile, bridge.ITypeLibrary) {
+/**
+ * Loads the spec file if one was provided otherwise creates a spec out of
+ * the command line flags.
+ */
+func SpecFromFlags(specPath string, serviceName string, servicePackage string, templatesDir string, files []string) (*Spec, error) {
+	if specPath != "" {
+		return LoadSpec(specPath)
+	}
+	spec := &Spec{Path: "<flags>", Files: files, Templates: templatesDir}
+	spec.Service.Name = serviceName
+	spec.Service.Package = servicePackage
+	if errs := spec.Validate(); errs != nil {
+		return nil, errs
+	}
+	return spec, nil
+}
+
+/**
+ * Creates the type library for a spec.  Names used in the generated code
+ * are reserved so packages are not imported as them and the names pinned
+ * (by the spec) for packages are set up before any package is added.
+ */
+func NewSpecTypeLibrary(spec *Spec) (bridge.ITypeLibrary, error) {
 	typeLibrary := NewGoTypeLibrary()
-	parsedFiles := make(map[string]*bridge.ParsedFile)
-	for _, srcFile := range fileNames {
-		pf, err := bridge.NewParsedFile(srcFile)
-		if err != nil {
-			log.Println("Parsing error: ", err)
-			panic(err)
+	clientPackageName := spec.Output.Package
+	if clientPackageName == "" {
+		clientPackageName = "restclient"
+	}
+	typeLibrary.ReserveShortNames(rest.ReservedNames(clientPackageName)...)
+	for _, pkg := range sortedKeys(spec.Imports) {
+		if err := typeLibrary.SetShortName(pkg, spec.Imports[pkg]); err != nil {
+			return nil, err
 		}
-		parsedFiles[pf.FullPath] = pf
 	}
+	return typeLibrary, nil
+}
 
-	// parse all files now that we have the imports kind of resolved
-	// At this point in each of the file, the Import map should have a local
-	// name as well as a path ("." imports are ignored for now)
-	for path, parsedFile := range parsedFiles {
-		log.Println("Processing Src: ", path)
-		parsedFile.ProcessNode(typeLibrary)
+/**
+ * Loads the packages matching the patterns (folders, import paths or go
+ * files) into a type library.  If typeCheck is set then the packages
+ * are type checked and types are taken from the type checker.  Problems in
+ * the code are returned as diagnostics (errors are only returned if the
+ * packages could not be loaded at all).
+ */
+func LoadPackages(typeLibrary bridge.ITypeLibrary, patterns []string, typeCheck bool) (bridge.Diagnostics, error) {
+	if typeCheck {
+		checker := bridge.NewTypeChecker(typeLibrary)
+		if _, err := checker.Load(patterns...); err != nil {
+			return nil, err
+		}
+		return checker.Diagnostics, nil
+	}
+	loader := bridge.NewLoader(typeLibrary)
+	if _, err := loader.Load(patterns...); err != nil {
+		return nil, err
 	}
+	return loader.Diagnostics, nil
+}
 
-	// Report unresolved types
-	typeLibrary.ForEach(func(name string, t *bridge.Type, stop *bool) {
-		if t.TypeClass == bridge.UnresolvedType {
-			log.Println("Unresolved Type: ", name, t.TypeData)
-		}
-	})
-	return parsedFiles, typeLibrary
+/**
+ * Writes a type library (as json) to a file.
+ */
+func DumpTypes(typeLibrary bridge.ITypeLibrary, path string) error {
+	data, err := json.MarshalIndent(typeLibrary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+/**
+ * Returns the canonical form of a type signature given in the spec (or the
+ * signature as it is if it does not refer to known types).
+ */
+func canonicalSignature(typeLibrary bridge.SignaturePrinter, sig string) string {
+	t, err := typeLibrary.ParseSignature(sig)
+	if err != nil {
+		log.Println("Cannot parse signature: ", err)
+		return sig
+	}
+	return typeLibrary.Signature(t)
 }
 
 func OpenFile(path string) *os.File {
@@ -91,16 +194,29 @@ func OpenFile(path string) *os.File {
 	return out
 }
 
-func CreateClientForType(typeLibrary bridge.ITypeLibrary, serviceType *bridge.Type) {
+func CreateClientForType(typeLibrary bridge.ITypeLibrary, serviceType *bridge.Type, spec *Spec, operation string) error {
+	bindings, err := spec.Bindings()
+	if err != nil {
+		return err
+	}
+	templatesDir := spec.ResolvePath(spec.Templates)
+	outputDir := spec.ResolvePath(spec.Output.Dir)
+	if outputDir == "" {
+		outputDir = "./restclient"
+	}
+
 	// Create the generator
-	// TODO: Get templates and existing readers/writers from spec file
-	generator := rest.NewGenerator(nil, typeLibrary, "../rest/templates/")
+	generator := rest.NewGenerator(bindings, typeLibrary, templatesDir)
+	if spec.Output.Package != "" {
+		generator.ClientPackageName = spec.Output.Package
+	}
 	generator.ExistingWriters = map[string]string{
 		"time.Time": "restclient.Write_time_Time",
 		"string":    "restclient.Write_string",
 		"int":       "restclient.Write_int",
 		"int64":     "restclient.Write_int64",
 		"bool":      "restclient.Write_bool",
+		"error":     "restclient.Write_error",
 	}
 	generator.ExistingReaders = map[string]string{
 		"time.Time": "restclient.Read_time_Time",
@@ -108,58 +224,73 @@ func CreateClientForType(typeLibrary bridge.ITypeLibrary, serviceType *bridge.Ty
 		"int":       "restclient.Read_int",
 		"int64":     "restclient.Read_int64",
 		"bool":      "restclient.Read_bool",
+		"error":     "restclient.Read_error",
+	}
+	for sig, writer := range spec.Writers {
+		generator.ExistingWriters[canonicalSignature(typeLibrary, sig)] = writer
+	}
+	for sig, reader := range spec.Readers {
+		generator.ExistingReaders[canonicalSignature(typeLibrary, sig)] = reader
 	}
 
+	// Marked types are collected once (by signature) without descending
+	// into them as the writers and readers mark the types they need
+	var marked *bridge.TypeWalker
 	sigVisited := make(map[string]bool)
-	typeVisited := make(map[*bridge.Type]bool)
 	uniqueTypes := make([]*bridge.Type, 0, 100)
 	resetTypes := func() {
+		marked = bridge.NewTypeWalker()
 		sigVisited = make(map[string]bool)
-		typeVisited = make(map[*bridge.Type]bool)
 		uniqueTypes = make([]*bridge.Type, 0, 100)
 	}
+	collector := &bridge.TypeHooks{
+		EnterAny: func(t *bridge.Type, walker *bridge.TypeWalker) bool {
+			sig := typeLibrary.Signature(t)
+			if !sigVisited[sig] {
+				sigVisited[sig] = true
+				uniqueTypes = append(uniqueTypes, t)
+			}
+			return false
+		},
+	}
 	generator.TypeMarker = func(types ...*bridge.Type) {
 		for _, t := range types {
-			if !typeVisited[t] {
-				typeVisited[t] = true
-				sig := typeLibrary.Signature(t)
-				if !sigVisited[sig] {
-					sigVisited[sig] = true
-					uniqueTypes = append(uniqueTypes, t)
-				}
-			}
+			marked.Walk(t, collector)
 		}
 	}
 
 	// Generate the interface declartion
 	resetTypes()
 	clientBuff := bytes.NewBuffer(nil)
-	err := generator.EmitClientClass(clientBuff, serviceType)
+	err = generator.EmitClientClass(clientBuff, serviceType)
 	if err != nil {
-		log.Println("Class emitting error: ", err)
-		return
+		return err
 	}
-	client_file := OpenFile("./restclient/client.go")
-	EmitFileHeader(client_file, generator.ClientPackageName, uniqueTypes, typeLibrary, "net/http")
-	client_file.Write(clientBuff.Bytes())
-	client_file.Close()
+	WriteGoFile(filepath.Join(outputDir, "client.go"), generator.ClientPackageName, clientBuff.Bytes(), uniqueTypes, typeLibrary, "net/http")
 
 	// Generate code for each of the service operation methods
 	resetTypes()
 	opsBuff := bytes.NewBuffer(nil)
 	serviceTypeData := generator.ServiceTypeData()
 	for _, field := range serviceTypeData.Fields {
+		if operation != "" && field.Name != operation {
+			continue
+		}
 		switch optype := field.Type.TypeData.(type) {
 		case *bridge.FunctionTypeData:
+			if optype.IsStreaming() {
+				// results streamed over channels cannot be sent over http
+				log.Println("Skipping streaming operation: ", field.Name)
+				continue
+			}
 			// get the type info and ensure the packages referred by this type
 			// are imported
-			generator.EmitServiceCallMethod(opsBuff, field.Name, optype, "arg")
+			if err := generator.EmitServiceCallMethod(opsBuff, field.Name, optype, "arg"); err != nil {
+				return err
+			}
 		}
 	}
-	ops_file := OpenFile("./restclient/ops.go")
-	EmitFileHeader(ops_file, generator.ClientPackageName, uniqueTypes, typeLibrary, "net/http", "bytes", "bufio")
-	ops_file.Write(opsBuff.Bytes())
-	ops_file.Close()
+	WriteGoFile(filepath.Join(outputDir, "ops.go"), generator.ClientPackageName, opsBuff.Bytes(), uniqueTypes, typeLibrary, "net/http", "net/url", "bytes", "bufio", "fmt", "io", "strings")
 
 	// Write the writers for each of the unique types and any other unique type
 	// those ones surface
@@ -174,8 +305,12 @@ func CreateClientForType(typeLibrary bridge.ITypeLibrary, serviceType *bridge.Ty
 			if _, ok := generator.ExistingWriters[typeLibrary.Signature(t)]; ok {
 				log.Println("Wont generate as Type Already Exists: ", typeLibrary.Signature(t))
 			} else {
-				generator.EmitTypeWriter(writersBuff, t)
-				generator.EmitTypeReader(readersBuff, t)
+				if err := generator.EmitTypeWriter(writersBuff, t); err != nil {
+					return err
+				}
+				if err := generator.EmitTypeReader(readersBuff, t); err != nil {
+					return err
+				}
 			}
 		}
 	}
@@ -183,35 +318,44 @@ func CreateClientForType(typeLibrary bridge.ITypeLibrary, serviceType *bridge.Ty
 	for _, t := range allUniqueTypes {
 		log.Println("Wrote: ", t, typeLibrary.Signature(t))
 	}
-	writers_file := OpenFile("./restclient/writers.go")
-	EmitFileHeader(writers_file, generator.ClientPackageName, allUniqueTypes, typeLibrary, "io")
-	writers_file.Write(writersBuff.Bytes())
-	writers_file.Close()
+	WriteGoFile(filepath.Join(outputDir, "writers.go"), generator.ClientPackageName, writersBuff.Bytes(), allUniqueTypes, typeLibrary, "io")
+	WriteGoFile(filepath.Join(outputDir, "readers.go"), generator.ClientPackageName, readersBuff.Bytes(), allUniqueTypes, typeLibrary, "bufio", "errors")
+	return nil
+}
 
-	readers_file := OpenFile("./restclient/readers.go")
-	EmitFileHeader(readers_file, generator.ClientPackageName, allUniqueTypes, typeLibrary, "bufio", "errors")
-	readers_file.Write(readersBuff.Bytes())
-	readers_file.Close()
+/**
+ * Writes a go file with the generated body preceded by the package header.
+ */
+func WriteGoFile(path string, packageName string, body []byte, types []*bridge.Type, typeLib bridge.PackageRegistry, extraPackages ...string) {
+	out := OpenFile(path)
+	defer out.Close()
+	EmitFileHeader(out, packageName, body, types, typeLib, extraPackages...)
+	out.Write(body)
 }
 
 /**
  * Writes the package header containing the package name and the imports of the
- * unique types to the output.
+ * unique types to the output.  Only the packages the body refers to are
+ * imported (as unused imports do not compile).
  */
-func EmitFileHeader(writer io.Writer, packageName string, types []*bridge.Type, typeLib bridge.ITypeLibrary, extraPackages ...string) error {
+func EmitFileHeader(writer io.Writer, packageName string, body []byte, types []*bridge.Type, typeLib bridge.PackageRegistry, extraPackages ...string) error {
 	writer.Write([]byte("package " + packageName + "\n\n"))
 
-	writer.Write([]byte("import (\n"))
-
+	used := UsedPackageNames(body)
+	var imports []string
 	pkgVisited := make(map[string]bool)
 	for _, pkg := range extraPackages {
 		pkgs := strings.Split(pkg, " ")
 		if len(pkgs) == 1 {
 			pkgVisited[pkgs[0]] = true
-			writer.Write([]byte(fmt.Sprintf("	\"%s\"\n", pkgs[0])))
+			if used == nil || used[path.Base(pkgs[0])] {
+				imports = append(imports, fmt.Sprintf("	\"%s\"\n", pkgs[0]))
+			}
 		} else {
 			pkgVisited[pkgs[1]] = true
-			writer.Write([]byte(fmt.Sprintf("	%s \"%s\"\n", pkgs[0], pkgs[1])))
+			if used == nil || used[pkgs[0]] {
+				imports = append(imports, fmt.Sprintf("	%s \"%s\"\n", pkgs[0], pkgs[1]))
+			}
 		}
 	}
 
@@ -221,10 +365,37 @@ func EmitFileHeader(writer io.Writer, packageName string, types []*bridge.Type,
 			pkg := leafType.Package
 			if pkg != "" && !pkgVisited[pkg] {
 				pkgVisited[pkg] = true
-				writer.Write([]byte(fmt.Sprintf("	%s \"%s\"\n", typeLib.ShortNameForPackage(pkg), pkg)))
+				shortName := typeLib.ShortNameForPackage(pkg)
+				if used == nil || used[shortName] {
+					imports = append(imports, fmt.Sprintf("	%s \"%s\"\n", shortName, pkg))
+				}
 			}
 		}
 	}
-	writer.Write([]byte(")\n"))
+	if len(imports) > 0 {
+		writer.Write([]byte("import (\n" + strings.Join(imports, "") + ")\n"))
+	}
 	return nil
 }
+
+/**
+ * Returns the names the body of a go file refers to packages by (ie the
+ * unresolved X in X.Sel expressions).  If the body cannot be parsed then nil
+ * is returned and all packages are to be treated as used.
+ */
+func UsedPackageNames(body []byte) map[string]bool {
+	file, err := parser.ParseFile(token.NewFileSet(), "", "package body\n"+string(body), 0)
+	if err != nil {
+		return nil
+	}
+	used := make(map[string]bool)
+	ast.Inspect(file, func(node ast.Node) bool {
+		if selector, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := selector.X.(*ast.Ident); ok && ident.Obj == nil {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+	return used
+}
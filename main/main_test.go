@@ -0,0 +1,307 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	. "gopkg.in/check.v1"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func (s *TestSuite) TestGetOnlyClient(c *C) {
+	root := c.MkDir()
+	files := map[string]string{
+		"go.mod": "module example.com/getonly\n",
+		"core/service.go": `package core
+
+type User struct {
+	Id   string
+	Name string
+}
+
+type IUserService interface {
+	GetUser(id string) (*User, error)
+	ListUsers() ([]*User, error)
+}
+`,
+		"bridge.yaml": `files: [core/service.go]
+service:
+  package: example.com/getonly/core
+  name: IUserService
+operations:
+  - name: GetUser
+    method: GET
+    url: /users/{id:Arg0}
+  - name: ListUsers
+    method: GET
+    url: /users/
+output:
+  dir: ./out
+`,
+	}
+	for name, contents := range files {
+		c.Assert(os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755), IsNil)
+		c.Assert(os.WriteFile(filepath.Join(root, name), []byte(contents), 0644), IsNil)
+	}
+	c.Assert(os.Mkdir(filepath.Join(root, "out"), 0755), IsNil)
+
+	spec, err := LoadSpec(filepath.Join(root, "bridge.yaml"))
+	c.Assert(err, IsNil)
+	patterns, err := spec.PackagePatterns()
+	c.Assert(err, IsNil)
+	typeLibrary, err := NewSpecTypeLibrary(spec)
+	c.Assert(err, IsNil)
+	diagnostics, err := LoadPackages(typeLibrary, patterns, false)
+	c.Assert(err, IsNil)
+	c.Assert(diagnostics.HasErrors(), Equals, false)
+	serviceType := typeLibrary.GetType(spec.Service.Package, spec.Service.Name)
+	c.Assert(serviceType, NotNil)
+	c.Assert(CreateClientForType(typeLibrary, serviceType, spec, ""), IsNil)
+	assertImportsUsed(c, filepath.Join(root, "out"))
+
+	// even when there are no operations
+	c.Assert(CreateClientForType(typeLibrary, serviceType, spec, "NoSuchOperation"), IsNil)
+	assertImportsUsed(c, filepath.Join(root, "out"))
+}
+
+/**
+ * Asserts that every package imported by the go files in a folder is used.
+ */
+func assertImportsUsed(c *C, dir string) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	c.Assert(err, IsNil)
+	c.Assert(len(paths) > 0, Equals, true)
+	for _, path := range paths {
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+		c.Assert(err, IsNil, Commentf("%s", path))
+		used := make(map[string]bool)
+		ast.Inspect(file, func(node ast.Node) bool {
+			if selector, ok := node.(*ast.SelectorExpr); ok {
+				if ident, ok := selector.X.(*ast.Ident); ok {
+					used[ident.Name] = true
+				}
+			}
+			return true
+		})
+		for _, spec := range file.Imports {
+			importPath, _ := strconv.Unquote(spec.Path.Value)
+			name := filepath.Base(importPath)
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			c.Assert(used[name], Equals, true, Commentf("%s: %s imported and not used", path, importPath))
+		}
+	}
+}
+
+/**
+ * Generates a client for a service, serves the service with the
+ * HttpInputBinder and checks (by running a program against both) that the
+ * client and the server understand each other.  This needs the go
+ * toolchain and the module this package is in so it is skipped in short
+ * mode or outside of a module.
+ */
+func (s *TestSuite) TestClientAgainstServer(c *C) {
+	if testing.Short() {
+		c.Skip("needs the go toolchain")
+	}
+	gomod, err := exec.Command("go", "env", "GOMOD").Output()
+	moduleFile := strings.TrimSpace(string(gomod))
+	if err != nil || moduleFile == "" || moduleFile == os.DevNull {
+		c.Skip("not in a module")
+	}
+	modulePath, err := exec.Command("go", "list", "-m").Output()
+	c.Assert(err, IsNil)
+	moduleDir := filepath.Dir(moduleFile)
+
+	root := c.MkDir()
+	files := map[string]string{
+		"go.mod": "module example.com/clienttest\n\ngo 1.22\n\nrequire " + strings.TrimSpace(string(modulePath)) + " v0.0.0\n\nreplace " + strings.TrimSpace(string(modulePath)) + " => " + moduleDir + "\n",
+		"core/service.go": `package core
+
+type Base struct {
+	Version int
+}
+
+type Audit struct {
+	By string
+}
+
+type User struct {
+	Base
+	*Audit
+	Id   string
+	Name string
+	Tags []string
+}
+
+type IUserService interface {
+	GetUser(id string) (*User, error)
+	ListUsers() ([]*User, error)
+	SaveUser(user *User) (*User, error)
+	DeleteUser(id string) error
+}
+`,
+		"bridge.yaml": `files: [core/service.go]
+service:
+  package: example.com/clienttest/core
+  name: IUserService
+operations:
+  - name: GetUser
+    method: GET
+    url: /users/{id:Arg0}
+  - name: ListUsers
+    method: GET
+    url: /users/
+  - name: SaveUser
+    method: PUT
+    url: /users/
+  - name: DeleteUser
+    method: DELETE
+    url: /users/{id:Arg0}
+output:
+  dir: ./client
+`,
+		"main.go": `package main
+
+import (
+	"encoding/json"
+	"errors"
+	"example.com/clienttest/client"
+	"example.com/clienttest/core"
+	"fmt"
+	"github.com/panyam/bridge/rest"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+)
+
+type UserService struct {
+	users map[string]*core.User
+}
+
+func (s *UserService) GetUser(id string) (*core.User, error) {
+	if user, ok := s.users[id]; ok {
+		return user, nil
+	}
+	return nil, errors.New("no such user")
+}
+
+func (s *UserService) ListUsers() ([]*core.User, error) {
+	out := []*core.User{}
+	for _, user := range s.users {
+		out = append(out, user)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Id < out[j].Id })
+	return out, nil
+}
+
+func (s *UserService) SaveUser(user *core.User) (*core.User, error) {
+	s.users[user.Id] = user
+	return user, nil
+}
+
+func (s *UserService) DeleteUser(id string) error {
+	delete(s.users, id)
+	return nil
+}
+
+func check(what string, got interface{}, expected interface{}) {
+	if !reflect.DeepEqual(got, expected) {
+		gotJson, _ := json.Marshal(got)
+		expectedJson, _ := json.Marshal(expected)
+		fmt.Printf("%s: got %s, expected %s\n", what, gotJson, expectedJson)
+		os.Exit(1)
+	}
+}
+
+func main() {
+	service := &UserService{users: make(map[string]*core.User)}
+	binder := &rest.HttpInputBinder{}
+	for _, binding := range []struct{ url, method, operation string }{
+		{"/users/{id:Arg0}", "GET", "GetUser"},
+		{"/users/", "GET", "ListUsers"},
+		{"/users/", "PUT", "SaveUser"},
+		{"/users/{id:Arg0}", "DELETE", "DeleteUser"},
+	} {
+		httpBinding, err := rest.NewHttpBinding(binding.url, []string{binding.method}, service, binding.operation)
+		check("binding "+binding.operation, err, nil)
+		check("adding "+binding.operation, binder.AddBinding(httpBinding), nil)
+	}
+	server := httptest.NewServer(binder)
+	defer server.Close()
+	svc := restclient.NewIUserServiceClient(server.URL)
+
+	users, err, transErr := svc.ListUsers()
+	check("empty list", []interface{}{users, err, transErr}, []interface{}{[]*core.User{}, nil, nil})
+
+	bob := &core.User{Base: core.Base{Version: 2}, Audit: &core.Audit{By: "admin"}, Id: "u 1/2", Name: "Bob", Tags: []string{"a", "b"}}
+	saved, err, transErr := svc.SaveUser(bob)
+	check("save", []interface{}{saved, err, transErr}, []interface{}{bob, nil, nil})
+	alice := &core.User{Id: "u1", Name: "Alice", Tags: []string{}}
+	_, _, transErr = svc.SaveUser(alice)
+	check("save", transErr, nil)
+
+	user, err, transErr := svc.GetUser("u 1/2")
+	check("get", []interface{}{user, err, transErr}, []interface{}{bob, nil, nil})
+	users, err, transErr = svc.ListUsers()
+	check("list", []interface{}{users, err, transErr}, []interface{}{[]*core.User{bob, alice}, nil, nil})
+
+	err, transErr = svc.DeleteUser("u 1/2")
+	check("delete", []interface{}{err, transErr}, []interface{}{nil, nil})
+	users, _, transErr = svc.ListUsers()
+	check("list after delete", []interface{}{users, transErr}, []interface{}{[]*core.User{alice}, nil})
+
+	// failures are sent back as errors with the status code
+	user, err, transErr = svc.GetUser("u 1/2")
+	responseError, _ := transErr.(*restclient.ResponseError)
+	check("get deleted", []interface{}{user, err, responseError}, []interface{}{(*core.User)(nil), nil, &restclient.ResponseError{StatusCode: 500, Message: "no such user"}})
+
+	// nothing listens on port 0 so there is no response to parse
+	user, err, transErr = restclient.NewIUserServiceClient("http://127.0.0.1:0").GetUser("u1")
+	check("unreachable", []interface{}{user, err, transErr != nil}, []interface{}{(*core.User)(nil), nil, true})
+}
+`,
+	}
+	for name, contents := range files {
+		c.Assert(os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755), IsNil)
+		c.Assert(os.WriteFile(filepath.Join(root, name), []byte(contents), 0644), IsNil)
+	}
+	if sums, err := os.ReadFile(filepath.Join(moduleDir, "go.sum")); err == nil {
+		c.Assert(os.WriteFile(filepath.Join(root, "go.sum"), sums, 0644), IsNil)
+	}
+	// the generated code calls the helpers in restclient
+	c.Assert(os.Mkdir(filepath.Join(root, "client"), 0755), IsNil)
+	helpers, err := filepath.Glob(filepath.Join("restclient", "*.go"))
+	c.Assert(err, IsNil)
+	for _, helper := range helpers {
+		contents, err := os.ReadFile(helper)
+		c.Assert(err, IsNil)
+		c.Assert(os.WriteFile(filepath.Join(root, "client", filepath.Base(helper)), contents, 0644), IsNil)
+	}
+
+	spec, err := LoadSpec(filepath.Join(root, "bridge.yaml"))
+	c.Assert(err, IsNil)
+	patterns, err := spec.PackagePatterns()
+	c.Assert(err, IsNil)
+	typeLibrary, err := NewSpecTypeLibrary(spec)
+	c.Assert(err, IsNil)
+	diagnostics, err := LoadPackages(typeLibrary, patterns, false)
+	c.Assert(err, IsNil)
+	c.Assert(diagnostics.HasErrors(), Equals, false)
+	serviceType := typeLibrary.GetType(spec.Service.Package, spec.Service.Name)
+	c.Assert(serviceType, NotNil)
+	c.Assert(CreateClientForType(typeLibrary, serviceType, spec, ""), IsNil)
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", output))
+}
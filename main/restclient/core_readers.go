@@ -3,12 +3,45 @@ package restclient
 import (
 	"bufio"
 	"errors"
+	"io"
+	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
+/**
+ * Error for responses whose status is not a 2xx.  The message is the body of
+ * the response (as written by the server when an operation fails).
+ */
+type ResponseError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ResponseError) Error() string {
+	if e.Message == "" {
+		return http.StatusText(e.StatusCode)
+	}
+	return e.Message
+}
+
+/**
+ * Returns a ResponseError for a response if its status is not a 2xx.
+ */
+func CheckResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return &ResponseError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+}
+
 func SkipSpaces(reader *bufio.Reader) error {
-	return SkipWhile(reader, func(b byte) bool { return b != ' ' && b != '\n' && b != '\t' && b != '\r' })
+	return SkipWhile(reader, func(b byte) bool { return b == ' ' || b == '\n' || b == '\t' || b == '\r' })
 }
 
 func SkipTill(reader *bufio.Reader, val byte) error {
@@ -28,7 +61,6 @@ func NextIf(reader *bufio.Reader, value byte) bool {
 }
 
 func SkipWhile(reader *bufio.Reader, filter func(byte) bool) error {
-	var bytes [1]byte
 	for {
 		bytes, err := reader.Peek(1)
 		if err != nil {
@@ -49,60 +81,65 @@ func SkipWhile(reader *bufio.Reader, filter func(byte) bool) error {
  * Reads a string while a match succeeds.
  */
 func ReadWhile(reader *bufio.Reader, matcher func(byte) bool) ([]byte, error) {
-	var nextByte [1]byte
 	var bytes []byte
 	for {
 		nextByte, err := reader.Peek(1)
-		if err != nil {
+		if err == io.EOF && bytes != nil {
+			return bytes, nil
+		} else if err != nil {
 			return nil, err
 		}
 		if !matcher(nextByte[0]) {
 			return bytes, nil
-		} else {
-			bytes = append(bytes, nextByte[0])
 		}
+		bytes = append(bytes, nextByte[0])
+		reader.ReadByte()
 	}
-	return nil, nil
 }
 
-func EnsureOSq(reader *bufio.Reader) error {
-	if err := SkipTill(reader, '['); err != nil {
-		return err
+/**
+ * Consumes a null (after any spaces) and tells if there was one.
+ */
+func NextNull(reader *bufio.Reader) bool {
+	SkipSpaces(reader)
+	bytes, err := reader.Peek(4)
+	if err != nil || string(bytes) != "null" {
+		return false
 	}
-	if err := SkipSpaces(reader); err != nil {
-		return err
+	reader.Discard(len(bytes))
+	return true
+}
+
+/**
+ * Consumes a character (after any spaces) and fails if it is not the
+ * next one.
+ */
+func Ensure(reader *bufio.Reader, value byte) error {
+	SkipSpaces(reader)
+	if !NextIf(reader, value) {
+		return errors.New("Expected '" + string(value) + "'")
 	}
 	return nil
 }
 
+func EnsureOSq(reader *bufio.Reader) error {
+	return Ensure(reader, '[')
+}
+
 func EnsureCSq(reader *bufio.Reader) error {
-	if err := SkipSpaces(reader); err != nil {
-		return err
-	}
-	if err := SkipTill(reader, ']'); err != nil {
-		return err
-	}
-	return nil
+	return Ensure(reader, ']')
 }
 
 func EnsureOCurly(reader *bufio.Reader) error {
-	if err := SkipTill(reader, '{'); err != nil {
-		return err
-	}
-	if err := SkipSpaces(reader); err != nil {
-		return err
-	}
-	return nil
+	return Ensure(reader, '{')
 }
 
 func EnsureCCurly(reader *bufio.Reader) error {
-	if err := SkipSpaces(reader); err != nil {
-		return err
-	}
-	if err := SkipTill(reader, '}'); err != nil {
-		return err
-	}
-	return nil
+	return Ensure(reader, '}')
+}
+
+func EnsureComma(reader *bufio.Reader) error {
+	return Ensure(reader, ',')
 }
 
 func Read_string(reader *bufio.Reader, arg *string) error {
@@ -159,7 +196,20 @@ func Read_int64(reader *bufio.Reader, arg *int64) error {
 	return err
 }
 
+/**
+ * Reads an error.  Nil errors are written as nulls (or not written at all
+ * when they are the only output of an operation).
+ */
 func Read_error(reader *bufio.Reader, err *error) error {
+	if SkipSpaces(reader) == io.EOF || NextNull(reader) {
+		*err = nil
+		return nil
+	}
+	var message string
+	if readErr := Read_string(reader, &message); readErr != nil {
+		return readErr
+	}
+	*err = errors.New(message)
 	return nil
 }
 
@@ -36,6 +36,17 @@ func Write_int64(writer io.Writer, arg int64) error {
 	return err
 }
 
+/**
+ * Writes an error as its message (or null if there is no error).
+ */
+func Write_error(writer io.Writer, arg error) error {
+	if arg == nil {
+		_, err := writer.Write([]byte("null"))
+		return err
+	}
+	return Write_string(writer, arg.Error())
+}
+
 func Write_time_Time(writer io.Writer, time time.Time) error {
 	bytes, err := time.MarshalJSON()
 	if err != nil {
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/panyam/bridge/rest"
+	"go/token"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/**
+ * Specifies what the bridge CLI is to generate.  Specs are written in YAML
+ * (or JSON), eg:
+ *
+ * 	packages:
+ * 	  - ../core/...
+ * 	service:
+ * 	  package: github.com/theuser/repo/core
+ * 	  name: IUserService
+ * 	operations:
+ * 	  - name: GetUser
+ * 	    method: GET
+ * 	    url: /users/{id:Request.UserId}
+ * 	    params:
+ * 	      detail: Request.Detail
+ * 	output:
+ * 	  package: restclient
+ * 	  dir: ./restclient
+ * 	typecheck: true
+ * 	templates: ./templates
+ * 	writers:
+ * 	  time.Time: restclient.Write_time_Time
+ * 	readers:
+ * 	  time.Time: restclient.Read_time_Time
+ *
+ * Relative paths are relative to the folder containing the spec file.
+ */
+type Spec struct {
+	// Path of the spec file (if any)
+	Path string `yaml:"-"`
+
+	// Source files (or globs) to be parsed.  The whole package containing
+	// each file is loaded.
+	Files []string `yaml:"files"`
+
+	// Package patterns (folders, import paths or either ending in /...) to
+	// be loaded
+	Packages []string `yaml:"packages"`
+
+	// The service for which the client is to be generated
+	Service ServiceSpec `yaml:"service"`
+
+	// Http bindings for the operations of the service
+	Operations []*OperationSpec `yaml:"operations"`
+
+	// Where the generated code is to be written
+	Output OutputSpec `yaml:"output"`
+
+	// Whether types are resolved with the go/types type checker instead of
+	// from the syntax alone
+	TypeCheck bool `yaml:"typecheck"`
+
+	// Folder with templates overriding the default templates
+	Templates string `yaml:"templates"`
+
+	// Existing writers and readers (by type signature) for which code will
+	// not be generated
+	Writers map[string]string `yaml:"writers"`
+	Readers map[string]string `yaml:"readers"`
+
+	// Names (by import path) that packages are imported as in the
+	// generated code
+	Imports map[string]string `yaml:"imports"`
+
+	Line int `yaml:"-"`
+
+	// Lines of the entries in files and (by import path) in imports
+	fileLines   []int
+	importLines map[string]int
+}
+
+type ServiceSpec struct {
+	// Package (full path or name) the service is defined in
+	Package string `yaml:"package"`
+	Name    string `yaml:"name"`
+	Line    int    `yaml:"-"`
+}
+
+type OperationSpec struct {
+	Name string `yaml:"name"`
+
+	// The http method (or methods) for the operation
+	Method  string   `yaml:"method"`
+	Methods []string `yaml:"methods"`
+
+	Url string `yaml:"url"`
+
+	// Mappings from query/form params to keys in the request
+	Params map[string]StringList `yaml:"params"`
+
+	Line int `yaml:"-"`
+}
+
+type OutputSpec struct {
+	Package string `yaml:"package"`
+	Dir     string `yaml:"dir"`
+	Line    int    `yaml:"-"`
+}
+
+/**
+ * A list of strings that can also be specified as a single string.
+ */
+type StringList []string
+
+func (l *StringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = StringList{node.Value}
+		return nil
+	}
+	return node.Decode((*[]string)(l))
+}
+
+/**
+ * Records the lines at which the parts of the spec were declared so that
+ * validation errors can point to them.
+ */
+func (s *Spec) setLines(root *yaml.Node) {
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	s.Line = root.Line
+	if node := mappingValue(root, "service"); node != nil {
+		s.Service.Line = node.Line
+	}
+	if node := mappingValue(root, "output"); node != nil {
+		s.Output.Line = node.Line
+	}
+	if node := mappingValue(root, "operations"); node != nil {
+		for index, opNode := range node.Content {
+			if index < len(s.Operations) && s.Operations[index] != nil {
+				s.Operations[index].Line = opNode.Line
+			}
+		}
+	}
+	if node := mappingValue(root, "files"); node != nil {
+		for _, fileNode := range node.Content {
+			s.fileLines = append(s.fileLines, fileNode.Line)
+		}
+	}
+	if node := mappingValue(root, "imports"); node != nil && node.Kind == yaml.MappingNode {
+		s.importLines = make(map[string]int)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			s.importLines[node.Content[i].Value] = node.Content[i].Line
+		}
+	}
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+/**
+ * An error in a spec file.
+ */
+type SpecError struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (e *SpecError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+/**
+ * All the errors found in a spec file.
+ */
+type SpecErrors []*SpecError
+
+func (errs SpecErrors) Error() string {
+	messages := make([]string, len(errs))
+	for index, err := range errs {
+		messages[index] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+/**
+ * Loads and validates a spec file.
+ */
+func LoadSpec(path string) (*Spec, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadSpec(path, file)
+}
+
+/**
+ * Reads and validates a spec from a reader.  The path is only used for
+ * resolving relative paths and reporting errors.
+ */
+func ReadSpec(path string, reader io.Reader) (*Spec, error) {
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	spec := &Spec{Path: path}
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(spec); err != nil && err != io.EOF {
+		return nil, yamlErrors(path, err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(contents, &root); err == nil {
+		spec.setLines(&root)
+	}
+	if errs := spec.Validate(); errs != nil {
+		return nil, errs
+	}
+	return spec, nil
+}
+
+/**
+ * Converts yaml errors (which look like "yaml: line 3: ...") into SpecErrors.
+ */
+func yamlErrors(path string, err error) error {
+	var out SpecErrors
+	var messages []string
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+	for _, message := range messages {
+		specErr := &SpecError{Path: path, Message: message}
+		if n, _ := fmt.Sscanf(message, "line %d:", &specErr.Line); n == 1 {
+			specErr.Message = strings.TrimSpace(message[strings.Index(message, ":")+1:])
+		}
+		out = append(out, specErr)
+	}
+	return out
+}
+
+var httpMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "OPTIONS": true, "CONNECT": true, "TRACE": true,
+}
+
+/**
+ * Validates the spec and returns all the errors found.
+ */
+func (s *Spec) Validate() SpecErrors {
+	var errs SpecErrors
+	addError := func(line int, format string, args ...interface{}) {
+		errs = append(errs, &SpecError{Path: s.Path, Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+	if len(s.Files) == 0 && len(s.Packages) == 0 {
+		addError(s.Line, "no source files or packages specified")
+	}
+	if s.Service.Name == "" {
+		addError(s.Service.Line, "service name is required")
+	}
+	if s.Output.Package != "" && !token.IsIdentifier(s.Output.Package) {
+		addError(s.Output.Line, "invalid output package '%s'", s.Output.Package)
+	}
+
+	aliases := make(map[string]string)
+	for _, pkg := range sortedKeys(s.Imports) {
+		alias := s.Imports[pkg]
+		if !token.IsIdentifier(alias) || alias == "_" {
+			addError(s.importLines[pkg], "invalid import name '%s' for package '%s'", alias, pkg)
+		} else if other, ok := aliases[alias]; ok {
+			addError(s.importLines[pkg], "import name '%s' used for both '%s' and '%s'", alias, other, pkg)
+		} else {
+			aliases[alias] = pkg
+		}
+	}
+
+	opLines := make(map[string]int)
+	for _, op := range s.Operations {
+		if op == nil {
+			addError(s.Line, "empty operation")
+			continue
+		}
+		if op.Name == "" {
+			addError(op.Line, "operation name is required")
+		} else if line, ok := opLines[op.Name]; ok {
+			addError(op.Line, "operation '%s' already specified on line %d", op.Name, line)
+		} else {
+			opLines[op.Name] = op.Line
+		}
+		if op.Method != "" && op.Methods != nil {
+			addError(op.Line, "only one of method or methods can be specified")
+		}
+		for _, method := range op.HttpMethods() {
+			if !httpMethods[method] {
+				addError(op.Line, "invalid http method '%s'", method)
+			}
+		}
+		if op.Url == "" {
+			addError(op.Line, "url is required for operation '%s'", op.Name)
+		} else if _, err := rest.ParseUrlTemplate(op.Url); err != nil {
+			addError(op.Line, "%s", err)
+		}
+		for _, param := range sortedParams(op.Params) {
+			if len(op.Params[param]) == 0 {
+				addError(op.Line, "no keys specified for param '%s'", param)
+			}
+		}
+	}
+	return errs
+}
+
+func sortedParams(params map[string]StringList) []string {
+	out := make([]string, 0, len(params))
+	for param := range params {
+		out = append(out, param)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func sortedKeys(values map[string]string) []string {
+	out := make([]string, 0, len(values))
+	for key := range values {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+/**
+ * Returns the http methods of the operation in upper case.
+ */
+func (op *OperationSpec) HttpMethods() []string {
+	methods := op.Methods
+	if op.Method != "" {
+		methods = []string{op.Method}
+	}
+	var out []string
+	for _, method := range methods {
+		out = append(out, strings.ToUpper(method))
+	}
+	return out
+}
+
+/**
+ * Creates the http bindings for the operations in the spec.
+ */
+func (s *Spec) Bindings() (map[string]*rest.HttpBinding, error) {
+	out := make(map[string]*rest.HttpBinding)
+	for _, op := range s.Operations {
+		binding := &rest.HttpBinding{Url: op.Url, Methods: op.HttpMethods(), Operation: op.Name}
+		segments, err := rest.ParseUrlTemplate(op.Url)
+		if err != nil {
+			return nil, err
+		}
+		for _, segment := range segments {
+			if segment.Mapping != "" {
+				binding.AddVarMapping(segment.Name, segment.Mapping)
+			}
+		}
+		if op.Params != nil {
+			binding.ParamMappings = make(map[string][]string)
+			for param, keys := range op.Params {
+				binding.ParamMappings[param] = keys
+			}
+		}
+		out[op.Name] = binding
+	}
+	return out, nil
+}
+
+/**
+ * Resolves a path relative to the folder containing the spec.
+ */
+func (s *Spec) ResolvePath(path string) string {
+	if path == "" || filepath.IsAbs(path) || s.Path == "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(s.Path), path)
+}
+
+/**
+ * Returns the source files in the spec with globs expanded.
+ */
+func (s *Spec) SourceFiles() ([]string, error) {
+	var out []string
+	for index, pattern := range s.Files {
+		line := 0
+		if index < len(s.fileLines) {
+			line = s.fileLines[index]
+		}
+		matches, err := filepath.Glob(s.ResolvePath(pattern))
+		if err != nil {
+			return nil, &SpecError{Path: s.Path, Line: line, Message: err.Error()}
+		}
+		if matches == nil {
+			return nil, &SpecError{Path: s.Path, Line: line, Message: "no files match " + pattern}
+		}
+		out = append(out, matches...)
+	}
+	return out, nil
+}
+
+/**
+ * Returns the patterns of the packages to be loaded.  These are the
+ * packages in the spec (with local paths resolved) followed by the source
+ * files.
+ */
+func (s *Spec) PackagePatterns() ([]string, error) {
+	var out []string
+	for _, pattern := range s.Packages {
+		if filepath.IsAbs(pattern) || strings.HasPrefix(pattern, ".") {
+			pattern = s.ResolvePath(pattern)
+			if !strings.HasPrefix(pattern, ".") && !filepath.IsAbs(pattern) {
+				// keep the pattern local so it is not taken to be an import path
+				pattern = "." + string(filepath.Separator) + pattern
+			}
+		}
+		out = append(out, pattern)
+	}
+	files, err := s.SourceFiles()
+	if err != nil {
+		return nil, err
+	}
+	return append(out, files...), nil
+}
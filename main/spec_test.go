@@ -0,0 +1,140 @@
+package main
+
+import (
+	. "gopkg.in/check.v1"
+	"os"
+	"strings"
+	"testing"
+)
+
+type TestSuite struct {
+}
+
+var _ = Suite(&TestSuite{})
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+const testSpec = `
+files:
+  - ../core/*.go
+service:
+  package: github.com/theuser/repo/core
+  name: IUserService
+operations:
+  - name: GetUser
+    method: get
+    url: /users/{id:Request.UserId}
+    params:
+      detail: Request.Detail
+      tag: [Request.Tags, Request.Filter.Tags]
+  - name: CreateTeam
+    methods: [POST, PUT]
+    url: /teams/
+output:
+  package: restclient
+  dir: ./out
+`
+
+func (s *TestSuite) TestReadSpec(c *C) {
+	spec, err := ReadSpec("specs/bridge.yaml", strings.NewReader(testSpec))
+	c.Assert(err, IsNil)
+	c.Assert(spec.Files, DeepEquals, []string{"../core/*.go"})
+	c.Assert(spec.Service.Name, Equals, "IUserService")
+	c.Assert(len(spec.Operations), Equals, 2)
+	c.Assert(spec.Operations[1].Line, Equals, 14)
+	c.Assert(spec.ResolvePath(spec.Output.Dir), Equals, "specs/out")
+
+	bindings, err := spec.Bindings()
+	c.Assert(err, IsNil)
+	c.Assert(bindings["GetUser"].Methods, DeepEquals, []string{"GET"})
+	c.Assert(bindings["GetUser"].VarMappings["id"], DeepEquals, []string{"Request.UserId"})
+	c.Assert(bindings["GetUser"].ParamMappings["tag"], DeepEquals, []string{"Request.Tags", "Request.Filter.Tags"})
+	c.Assert(bindings["CreateTeam"].Methods, DeepEquals, []string{"POST", "PUT"})
+}
+
+func (s *TestSuite) TestReadJsonSpec(c *C) {
+	spec, err := ReadSpec("bridge.json", strings.NewReader(`{
+		"files": ["a.go"],
+		"service": {"name": "IUserService"},
+		"operations": [{"name": "GetUser", "url": "/users/{id}"}]
+	}`))
+	c.Assert(err, IsNil)
+	c.Assert(spec.Operations[0].Url, Equals, "/users/{id}")
+}
+
+func (s *TestSuite) TestPackagePatterns(c *C) {
+	spec, err := ReadSpec("specs/bridge.yaml", strings.NewReader(`
+packages: [../core/..., ./models, github.com/theuser/repo/api]
+service:
+  name: IUserService
+`))
+	c.Assert(err, IsNil)
+	patterns, err := spec.PackagePatterns()
+	c.Assert(err, IsNil)
+	c.Assert(patterns, DeepEquals, []string{"./core/...", "./specs/models", "github.com/theuser/repo/api"})
+
+	// bad files are reported at their lines
+	dir := c.MkDir()
+	c.Assert(os.WriteFile(dir+"/a.go", []byte("package a\n"), 0644), IsNil)
+	for source, message := range map[string]string{
+		"files:\n  - \"*.proto\"\n":        "bridge.yaml:2: no files match \\*.proto",
+		"files:\n  - a.go\n  - \"[.go\"\n": "bridge.yaml:3: syntax error in pattern",
+	} {
+		spec, err = ReadSpec(dir+"/bridge.yaml", strings.NewReader(source+"service:\n  name: IUserService\n"))
+		c.Assert(err, IsNil)
+		_, err = spec.PackagePatterns()
+		c.Assert(err, ErrorMatches, ".*"+message)
+	}
+}
+
+func (s *TestSuite) TestSpecErrors(c *C) {
+	_, err := ReadSpec("bridge.yaml", strings.NewReader(`
+files: [a.go]
+service:
+  name: IUserService
+operations:
+  - name: GetUser
+    method: FETCH
+    url: /users/{}
+  - name: GetUser
+    url: /users/
+`))
+	c.Assert(err, ErrorMatches, "bridge.yaml:6: invalid http method 'FETCH'\n"+
+		"bridge.yaml:6: Variable without a name in url '/users/{}'\n"+
+		"bridge.yaml:9: operation 'GetUser' already specified on line 6")
+
+	_, err = ReadSpec("bridge.yaml", strings.NewReader("files: [a.go]\nservice:\n  nme: IUserService\n"))
+	c.Assert(err, ErrorMatches, "bridge.yaml:3: field nme not found in type main.ServiceSpec")
+}
+
+func (s *TestSuite) TestSpecImports(c *C) {
+	spec, err := ReadSpec("bridge.yaml", strings.NewReader(`
+files: [a.go]
+service:
+  name: IUserService
+imports:
+  example.com/app/models: appmodels
+  example.com/lib/models: libmodels
+`))
+	c.Assert(err, IsNil)
+	typeLibrary, err := NewSpecTypeLibrary(spec)
+	c.Assert(err, IsNil)
+	c.Assert(typeLibrary.AddPackage("example.com/lib/models"), Equals, "libmodels")
+	c.Assert(typeLibrary.AddPackage("example.com/other/models"), Equals, "models")
+	c.Assert(typeLibrary.AddPackage("example.com/other/http"), Equals, "otherhttp")
+
+	_, err = ReadSpec("bridge.yaml", strings.NewReader(`
+files: [a.go]
+service:
+  name: IUserService
+imports:
+  example.com/a: models
+  example.com/b: models
+  example.com/c: 1c
+`))
+	c.Assert(err, ErrorMatches, "bridge.yaml:7: import name 'models' used for both 'example.com/a' and 'example.com/b'\n"+
+		"bridge.yaml:8: invalid import name '1c' for package 'example.com/c'")
+}
@@ -0,0 +1,51 @@
+package bridge
+
+import (
+	"reflect"
+)
+
+/**
+ * A service operation along with the values it is to be invoked with.
+ * Input binders extract these out of transport level requests (eg http
+ * requests) so that the actual invocation is independant of the transport.
+ */
+type ServiceOperation struct {
+	/**
+	 * The method (bound to the service) to be invoked.
+	 */
+	Method reflect.Value
+
+	/**
+	 * The request object the method is to be invoked with.
+	 */
+	RequestParam reflect.Value
+
+	/**
+	 * All the parameters the method is to be invoked with (including any
+	 * context and the request param).  If this is nil then the method is
+	 * invoked with only the RequestParam.
+	 */
+	Params []reflect.Value
+}
+
+/**
+ * Invokes the operation and returns the values returned by the underlying
+ * service method.
+ */
+func (op *ServiceOperation) Invoke() []reflect.Value {
+	if op.Params != nil {
+		return op.Method.Call(op.Params)
+	}
+	return op.Method.Call([]reflect.Value{op.RequestParam})
+}
+
+/**
+ * Extracts service operations out of transport level requests.
+ */
+type InputBinder interface {
+	/**
+	 * Returns the operation to be invoked for a transport request.  If no
+	 * operation is bound to the request then a nil operation is returned.
+	 */
+	ExtractInput(transportRequest interface{}) (*ServiceOperation, error)
+}
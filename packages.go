@@ -0,0 +1,390 @@
+package bridge
+
+import (
+	"bufio"
+	"fmt"
+	"go/build"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/**
+ * The parts of a go.mod file needed to resolve import paths.
+ */
+type ModuleInfo struct {
+	// Folder containing the go.mod file
+	Dir string
+
+	// The module path
+	Path string
+
+	Replaces []*ModuleReplace
+}
+
+/**
+ * A replace directive in a go.mod file, eg:
+ *
+ * 	replace example.com/lib v1.2.0 => ../lib
+ */
+type ModuleReplace struct {
+	OldPath    string
+	OldVersion string
+	NewPath    string
+	NewVersion string
+
+	// Absolute path of the replacement if it is a local folder ("" otherwise)
+	Dir string
+}
+
+/**
+ * Parses the module path and replace directives from a go.mod file.
+ */
+func ParseModFile(modFile string) (*ModuleInfo, error) {
+	file, err := os.Open(modFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	out := &ModuleInfo{Dir: filepath.Dir(modFile)}
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	block := ""
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if index := strings.Index(line, "//"); index >= 0 {
+			line = line[:index]
+		}
+		fields, err := modFileFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", modFile, lineNum, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			fields = append([]string{block}, fields...)
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+
+		switch fields[0] {
+		case "module":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("%s:%d: invalid module directive", modFile, lineNum)
+			}
+			out.Path = fields[1]
+		case "replace":
+			replace, err := parseReplace(out.Dir, fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %s", modFile, lineNum, err)
+			}
+			out.Replaces = append(out.Replaces, replace)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if out.Path == "" {
+		return nil, fmt.Errorf("%s: no module directive", modFile)
+	}
+	return out, nil
+}
+
+/**
+ * Splits a line in a go.mod file into its fields (unquoting quoted fields).
+ */
+func modFileFields(line string) ([]string, error) {
+	var out []string
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+		if line[0] == '"' || line[0] == '`' {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil, err
+			}
+			value, _ := strconv.Unquote(quoted)
+			out = append(out, value)
+			line = line[len(quoted):]
+		} else {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			out = append(out, line[:end])
+			line = line[end:]
+		}
+	}
+	return out, nil
+}
+
+func parseReplace(modDir string, fields []string) (*ModuleReplace, error) {
+	arrow := -1
+	for index, field := range fields {
+		if field == "=>" {
+			arrow = index
+		}
+	}
+	if arrow < 1 || arrow > 2 || len(fields)-arrow-1 < 1 || len(fields)-arrow-1 > 2 {
+		return nil, fmt.Errorf("invalid replace directive")
+	}
+	out := &ModuleReplace{OldPath: fields[0], NewPath: fields[arrow+1]}
+	if arrow == 2 {
+		out.OldVersion = fields[1]
+	}
+	if len(fields) == arrow+3 {
+		out.NewVersion = fields[arrow+2]
+	} else if strings.HasPrefix(out.NewPath, "./") || strings.HasPrefix(out.NewPath, "../") ||
+		filepath.IsAbs(out.NewPath) || out.NewPath == "." || out.NewPath == ".." {
+		// only replacements without versions can be local folders
+		out.Dir = out.NewPath
+		if !filepath.IsAbs(out.Dir) {
+			out.Dir = filepath.Join(modDir, out.Dir)
+		}
+	}
+	return out, nil
+}
+
+/**
+ * Resolves the import paths of folders containing go source.  Import paths
+ * are resolved (in order of precedence) from:
+ *
+ * 	1. vendor folders,
+ * 	2. local folders that replace modules (via replace directives in any
+ * 	go.mod file seen so far or added with AddModule),
+ * 	3. the nearest go.mod file in the folder or its parents (so nested
+ * 	modules are handled),
+ * 	4. the src folders in GOPATH and GOROOT.
+ *
+ * Parsed go.mod files are cached and resolvers are safe to be used from
+ * multiple go routines.
+ */
+type PackageResolver struct {
+	// Folders searched for GOPATH style packages (the "src" folder within
+	// each of these is searched)
+	GoPaths []string
+
+	mutex sync.Mutex
+
+	// go.mod files parsed so far indexed by the folder they are in (or nil
+	// if a folder has no go.mod file)
+	modules map[string]*ModuleInfo
+
+	// import paths of local folders that replace modules
+	replaceDirs map[string]string
+}
+
+func NewPackageResolver() *PackageResolver {
+	out := &PackageResolver{
+		modules:     make(map[string]*ModuleInfo),
+		replaceDirs: make(map[string]string),
+	}
+	out.GoPaths = append([]string{runtime.GOROOT()}, filepath.SplitList(build.Default.GOPATH)...)
+	return out
+}
+
+var defaultResolver = NewPackageResolver()
+
+/**
+ * Registers the replace directives of a module.  Modules containing
+ * resolved folders are added automatically but the main module should be
+ * added before resolving folders that it replaces.
+ */
+func (r *PackageResolver) AddModule(dir string) (*ModuleInfo, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	module, err := r.moduleIn(dir)
+	if err == nil && module == nil {
+		err = fmt.Errorf("No go.mod file in %s", dir)
+	}
+	return module, err
+}
+
+/**
+ * Returns the module in a folder (or nil if there is no go.mod file in it).
+ * Must be called with the mutex held.
+ */
+func (r *PackageResolver) moduleIn(dir string) (*ModuleInfo, error) {
+	if module, ok := r.modules[dir]; ok {
+		return module, nil
+	}
+	modFile := filepath.Join(dir, "go.mod")
+	if _, err := os.Stat(modFile); err != nil {
+		r.modules[dir] = nil
+		return nil, nil
+	}
+	module, err := ParseModFile(modFile)
+	if err != nil {
+		return nil, err
+	}
+	r.modules[dir] = module
+	for _, replace := range module.Replaces {
+		if replace.Dir != "" {
+			r.replaceDirs[replace.Dir] = replace.OldPath
+		}
+	}
+	return module, nil
+}
+
+/**
+ * Returns the module containing a folder (if any).
+ */
+func (r *PackageResolver) ModuleFor(dir string) (*ModuleInfo, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for curr := dir; ; curr = filepath.Dir(curr) {
+		module, err := r.moduleIn(curr)
+		if module != nil || err != nil {
+			return module, err
+		}
+		if filepath.Dir(curr) == curr {
+			return nil, nil
+		}
+	}
+}
+
+/**
+ * Returns the import path of the package in a folder.
+ */
+func (r *PackageResolver) ImportPath(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	// Case 1: Vendored packages
+	slashDir := filepath.ToSlash(dir)
+	if index := strings.LastIndex(slashDir, "/vendor/"); index >= 0 {
+		return slashDir[index+len("/vendor/"):], nil
+	}
+
+	// Case 2 and 3: Folders in a module (or that replace one)
+	module, err := r.ModuleFor(dir)
+	if err != nil {
+		return "", err
+	}
+	if importPath, ok := r.replacedImportPath(dir); ok {
+		return importPath, nil
+	}
+	if module != nil {
+		return joinImportPath(module.Path, module.Dir, dir), nil
+	}
+
+	// Case 4: GOPATH/GOROOT
+	for _, folder := range r.GoPaths {
+		if folder == "" {
+			continue
+		}
+		src := filepath.Join(folder, "src")
+		if rel, err := filepath.Rel(src, dir); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel), nil
+		}
+	}
+	return "", fmt.Errorf("Cannot resolve import path for %s", dir)
+}
+
+/**
+ * Returns the import path used for the package in a folder whose import
+ * path cannot be resolved.  As with the go tool this is the folder prefixed
+ * with "_" (eg "_/home/user/scripts") so packages in different folders do
+ * not clash.
+ */
+func localImportPath(dir string) string {
+	return "_" + filepath.ToSlash(dir)
+}
+
+/**
+ * Returns the import path of a folder within (or equal to) a local folder
+ * that replaces a module.  The deepest such folder is used.
+ */
+func (r *PackageResolver) replacedImportPath(dir string) (string, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var replaceDirs []string
+	for replaceDir := range r.replaceDirs {
+		replaceDirs = append(replaceDirs, replaceDir)
+	}
+	sort.Slice(replaceDirs, func(i, j int) bool { return len(replaceDirs[i]) > len(replaceDirs[j]) })
+	for _, replaceDir := range replaceDirs {
+		if dir == replaceDir || strings.HasPrefix(dir, replaceDir+string(filepath.Separator)) {
+			return joinImportPath(r.replaceDirs[replaceDir], replaceDir, dir), true
+		}
+	}
+	return "", false
+}
+
+func joinImportPath(rootPath string, rootDir string, dir string) string {
+	rel, err := filepath.Rel(rootDir, dir)
+	if err != nil || rel == "." {
+		return rootPath
+	}
+	return path.Join(rootPath, filepath.ToSlash(rel))
+}
+
+/**
+ * Returns the folder containing the package with the given import path as
+ * seen from a folder importing it.  The importing module's vendor folder,
+ * replace directives and the module itself are searched before falling back
+ * to the go tool (for the standard library and the module cache).
+ */
+func (r *PackageResolver) FindDir(importPath string, fromDir string) (string, error) {
+	module, err := r.ModuleFor(fromDir)
+	if err != nil {
+		return "", err
+	}
+	if module != nil {
+		vendorDir := filepath.Join(module.Dir, "vendor", filepath.FromSlash(importPath))
+		if info, err := os.Stat(vendorDir); err == nil && info.IsDir() {
+			return vendorDir, nil
+		}
+		for _, replace := range module.Replaces {
+			if replace.Dir == "" {
+				continue
+			}
+			if rel, ok := relImportPath(replace.OldPath, importPath); ok {
+				return filepath.Join(replace.Dir, filepath.FromSlash(rel)), nil
+			}
+		}
+		if rel, ok := relImportPath(module.Path, importPath); ok {
+			return filepath.Join(module.Dir, filepath.FromSlash(rel)), nil
+		}
+	}
+	pkg, err := build.Import(importPath, fromDir, build.FindOnly)
+	if err != nil {
+		return "", err
+	}
+	return pkg.Dir, nil
+}
+
+/**
+ * Returns the path of an import path relative to a root import path (if it
+ * is within it).
+ */
+func relImportPath(rootPath string, importPath string) (string, bool) {
+	if importPath == rootPath {
+		return "", true
+	}
+	if strings.HasPrefix(importPath, rootPath+"/") {
+		return importPath[len(rootPath)+1:], true
+	}
+	return "", false
+}
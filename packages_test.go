@@ -0,0 +1,107 @@
+package bridge
+
+import (
+	. "gopkg.in/check.v1"
+	"os"
+	"path/filepath"
+)
+
+/**
+ * Creates the given files (with their contents) under a root folder.
+ */
+func writeTestFiles(c *C, root string, files map[string]string) {
+	for path, contents := range files {
+		fullPath := filepath.Join(root, path)
+		c.Assert(os.MkdirAll(filepath.Dir(fullPath), 0755), IsNil)
+		c.Assert(os.WriteFile(fullPath, []byte(contents), 0644), IsNil)
+	}
+}
+
+func (s *TestSuite) TestParseModFile(c *C) {
+	root := c.MkDir()
+	writeTestFiles(c, root, map[string]string{
+		"app/go.mod": `module "example.com/app" // the app
+
+go 1.21
+
+require example.com/lib v1.0.0
+
+replace example.com/lib v1.0.0 => ../lib
+
+replace (
+	example.com/other => example.com/fork v1.2.3
+	example.com/local => ./local
+)
+`,
+	})
+	module, err := ParseModFile(filepath.Join(root, "app", "go.mod"))
+	c.Assert(err, IsNil)
+	c.Assert(module.Path, Equals, "example.com/app")
+	c.Assert(module.Dir, Equals, filepath.Join(root, "app"))
+	c.Assert(len(module.Replaces), Equals, 3)
+	c.Assert(*module.Replaces[0], Equals, ModuleReplace{
+		OldPath: "example.com/lib", OldVersion: "v1.0.0", NewPath: "../lib", Dir: filepath.Join(root, "lib"),
+	})
+	c.Assert(*module.Replaces[1], Equals, ModuleReplace{
+		OldPath: "example.com/other", NewPath: "example.com/fork", NewVersion: "v1.2.3",
+	})
+	c.Assert(module.Replaces[2].Dir, Equals, filepath.Join(root, "app", "local"))
+}
+
+func (s *TestSuite) TestParseModFileWithoutModule(c *C) {
+	root := c.MkDir()
+	writeTestFiles(c, root, map[string]string{"go.mod": "go 1.21\n"})
+	_, err := ParseModFile(filepath.Join(root, "go.mod"))
+	c.Assert(err, ErrorMatches, ".*no module directive")
+}
+
+func (s *TestSuite) TestImportPathInModules(c *C) {
+	root := c.MkDir()
+	writeTestFiles(c, root, map[string]string{
+		"app/go.mod":            "module example.com/app\n\nreplace example.com/lib => ../lib\n",
+		"app/core/a.go":         "package core\n",
+		"app/nested/go.mod":     "module example.com/nested/v2\n",
+		"app/nested/api/a.go":   "package api\n",
+		"app/vendor/x.org/y/a":  "package y\n",
+		"lib/go.mod":            "module example.com/actual-lib\n",
+		"lib/models/a.go":       "package models\n",
+		"unrelated/pkg/main.go": "package main\n",
+	})
+	resolver := NewPackageResolver()
+	resolver.GoPaths = nil
+	_, err := resolver.AddModule(filepath.Join(root, "app"))
+	c.Assert(err, IsNil)
+
+	tests := map[string]string{
+		"app":                "example.com/app",
+		"app/core":           "example.com/app/core",
+		"app/nested":         "example.com/nested/v2",
+		"app/nested/api":     "example.com/nested/v2/api",
+		"app/vendor/x.org/y": "x.org/y",
+		"lib":                "example.com/lib",
+		"lib/models":         "example.com/lib/models",
+	}
+	for dir, expected := range tests {
+		importPath, err := resolver.ImportPath(filepath.Join(root, dir))
+		c.Assert(err, IsNil)
+		c.Assert(importPath, Equals, expected, Commentf("Dir: %s", dir))
+	}
+	_, err = resolver.ImportPath(filepath.Join(root, "unrelated", "pkg"))
+	c.Assert(err, NotNil)
+}
+
+func (s *TestSuite) TestImportPathInGoPath(c *C) {
+	root := c.MkDir()
+	writeTestFiles(c, root, map[string]string{
+		"gopath1/src/github.com/a/b/a.go": "package b\n",
+		"gopath2/src/github.com/c/d/a.go": "package d\n",
+	})
+	resolver := NewPackageResolver()
+	resolver.GoPaths = []string{filepath.Join(root, "gopath1"), filepath.Join(root, "gopath2")}
+	importPath, err := resolver.ImportPath(filepath.Join(root, "gopath1/src/github.com/a/b"))
+	c.Assert(err, IsNil)
+	c.Assert(importPath, Equals, "github.com/a/b")
+	importPath, err = resolver.ImportPath(filepath.Join(root, "gopath2/src/github.com/c/d"))
+	c.Assert(err, IsNil)
+	c.Assert(importPath, Equals, "github.com/c/d")
+}
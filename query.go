@@ -0,0 +1,253 @@
+package bridge
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+/**
+ * Returns the packages that have been added to the library or that have
+ * types in it (sorted by import path).
+ */
+func (tl *TypeLibrary) Packages() []string {
+	seen := make(map[string]bool)
+	tl.mutex.RLock()
+	for pkg := range tl.shortNamesForPkg {
+		seen[pkg] = true
+	}
+	for key := range tl.types {
+		seen[key[:strings.LastIndex(key, ".")]] = true
+	}
+	tl.mutex.RUnlock()
+	out := make([]string, 0, len(seen))
+	for pkg := range seen {
+		if pkg != "" {
+			out = append(out, pkg)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+/**
+ * Returns the types declared in a package (ordered by name).  The global
+ * types are those in the "" package.
+ */
+func (tl *TypeLibrary) TypesInPackage(pkg string) []*Type {
+	return tl.FindTypes(func(key string, t *Type) bool {
+		return key[:strings.LastIndex(key, ".")] == pkg
+	})
+}
+
+/**
+ * Returns the types in the library (ordered by package and then by name)
+ * for which a predicate is true.  The predicate is called with the key of
+ * each type ("pkg.Name").
+ */
+func (tl *TypeLibrary) FindTypes(predicate func(key string, t *Type) bool) []*Type {
+	var out []*Type
+	tl.ForEach(func(key string, t *Type, stop *bool) {
+		if predicate(key, t) {
+			out = append(out, t)
+		}
+	})
+	return out
+}
+
+/**
+ * Returns the types whose names match a glob pattern (as in path.Match).
+ * Patterns without a "." only match the names of types (in any package),
+ * eg "*Request".  Otherwise the pattern is matched against both the import
+ * path and the short name of the package of a type, eg:
+ *
+ * 	example.com/app/*.User
+ * 	core.*
+ */
+func (tl *TypeLibrary) MatchTypes(pattern string) ([]*Type, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	nameOnly := !strings.Contains(pattern, ".")
+	return tl.FindTypes(func(key string, t *Type) bool {
+		index := strings.LastIndex(key, ".")
+		pkg, name := key[:index], key[index+1:]
+		if nameOnly {
+			matched, _ := path.Match(pattern, name)
+			return matched
+		}
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+		shortName := tl.ShortNameForPackage(pkg)
+		if shortName == "" {
+			return false
+		}
+		matched, _ := path.Match(pattern, shortName+"."+name)
+		return matched
+	}), nil
+}
+
+/**
+ * Returns the interfaces that have methods (and are candidates for being
+ * exposed as services).
+ */
+func (tl *TypeLibrary) ServiceTypes() []*Type {
+	return tl.FindTypes(func(key string, t *Type) bool {
+		if t.TypeClass != RecordType || !t.AsRecordType().IsInterface {
+			return false
+		}
+		return len(MethodSet(t)) > 0
+	})
+}
+
+/**
+ * Returns the types in the library (other than t itself) that refer to a
+ * type in their definitions, eg for User:
+ *
+ * 	type Team struct { Members []*User }
+ *
+ * With transitive set the types that refer to these types (and so on) are
+ * also returned.
+ */
+func (tl *TypeLibrary) ReferencesTo(t *Type, transitive bool) []*Type {
+	declared := make(map[*Type]bool)
+	tl.ForEach(func(key string, libType *Type, stop *bool) {
+		declared[libType] = true
+	})
+	declared[t] = true
+
+	// the declared types (and t) each type refers to without going through
+	// another declared type
+	referrers := make(map[*Type][]*Type)
+	for libType := range declared {
+		referrer := libType
+		WalkType(libType, &TypeHooks{
+			EnterAny: func(child *Type, walker *TypeWalker) bool {
+				if walker.Depth() > 0 && declared[child] {
+					referrers[child] = append(referrers[child], referrer)
+					return false
+				}
+				return true
+			},
+		})
+	}
+
+	found := make(map[*Type]bool)
+	queue := []*Type{t}
+	for len(queue) > 0 {
+		curr := queue[0]
+		queue = queue[1:]
+		for _, referrer := range referrers[curr] {
+			if !found[referrer] {
+				found[referrer] = true
+				if transitive {
+					queue = append(queue, referrer)
+				}
+			}
+		}
+	}
+	return tl.FindTypes(func(key string, libType *Type) bool {
+		return found[libType] && libType != t
+	})
+}
+
+/**
+ * Returns the types in the library that implement an interface, ie the
+ * types whose method sets (or the method sets of pointers to them) include
+ * all the methods of the interface with the same signatures.
+ */
+func (tl *TypeLibrary) Implementations(iface *Type) []*Type {
+	if iface.TypeClass != RecordType || !iface.AsRecordType().IsInterface {
+		return nil
+	}
+	required := MethodSet(iface)
+	implements := func(t *Type) bool {
+		methods := MethodSet(t)
+		for name, method := range required {
+			if other, ok := methods[name]; !ok || tl.Signature(other) != tl.Signature(method) {
+				return false
+			}
+		}
+		return true
+	}
+	return tl.FindTypes(func(key string, t *Type) bool {
+		if t == iface {
+			return false
+		}
+		switch t.TypeClass {
+		case RecordType:
+		case AliasType:
+			if t.AsAliasType().IsAlias {
+				return false
+			}
+		default:
+			return false
+		}
+		return implements(t) || implements(&Type{TypeClass: ReferenceType, TypeData: &ReferenceTypeData{TargetType: t}})
+	})
+}
+
+/**
+ * Returns the methods (by name) in the method set of a type.  For an
+ * interface these are its methods including those of the interfaces it
+ * embeds.  For other types these are the methods declared on the type and
+ * those promoted from embedded fields.  Methods with pointer receivers are
+ * only in the method sets of pointers, eg for:
+ *
+ * 	func (u User) Name() string
+ * 	func (u *User) SetName(name string)
+ *
+ * the method set of User only has Name while that of *User has both.
+ */
+func MethodSet(t *Type) map[string]*Type {
+	type visit struct {
+		t       *Type
+		pointer bool
+	}
+	out := make(map[string]*Type)
+	visited := make(map[visit]bool)
+	addMethods := func(t *Type, pointer bool) {
+		for _, method := range t.Methods() {
+			if (pointer || !method.PointerReceiver) && out[method.Name] == nil {
+				out[method.Name] = method.Type
+			}
+		}
+	}
+	// declared is false for the targets of named types (eg type A B) as
+	// they do not get the methods declared on their targets
+	var visitType func(t *Type, pointer bool, declared bool)
+	visitType = func(t *Type, pointer bool, declared bool) {
+		if t == nil || visited[visit{t, pointer}] {
+			return
+		}
+		visited[visit{t, pointer}] = true
+		switch typeData := t.TypeData.(type) {
+		case *ReferenceTypeData:
+			visitType(typeData.TargetType, true, declared)
+		case *AliasTypeData:
+			if declared && !typeData.IsAlias {
+				addMethods(t, pointer)
+			}
+			visitType(typeData.TargetType, pointer, declared && typeData.IsAlias)
+		case *InstanceTypeData:
+			visitType(t.Expand(), pointer, declared)
+		case *RecordTypeData:
+			if declared {
+				addMethods(t, pointer)
+			}
+			if typeData.IsInterface {
+				for _, field := range typeData.Fields {
+					if field.Name != "" && out[field.Name] == nil {
+						out[field.Name] = field.Type
+					}
+				}
+			}
+			for _, base := range typeData.Bases {
+				visitType(base, pointer, true)
+			}
+		}
+	}
+	visitType(t, false, true)
+	return out
+}
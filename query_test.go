@@ -0,0 +1,153 @@
+package bridge
+
+import (
+	. "gopkg.in/check.v1"
+	"sort"
+)
+
+func (s *TestSuite) TestQueries(c *C) {
+	_, typeLibrary := parseTestSource(c, `package test
+
+type User struct {
+	Name string
+}
+
+type Team struct {
+	Members []*User
+}
+
+type League map[string]Team
+
+type Reader interface {
+	Read(id string) (*User, error)
+}
+
+type Writer interface {
+	Write(user *User) error
+}
+
+type ReadWriter interface {
+	Reader
+	Writer
+}
+
+type Store struct {
+	ReadWriter
+	Path string
+}
+
+type Number interface {
+	~int | ~float64
+}
+`)
+	names := func(types []*Type) (out []string) {
+		for _, t := range types {
+			out = append(out, t.LeafType().Name)
+		}
+		return
+	}
+	get := func(name string) *Type { return typeLibrary.GetType("example.com/test", name) }
+
+	c.Assert(typeLibrary.Packages(), DeepEquals, []string{"example.com/test"})
+	c.Assert(names(typeLibrary.TypesInPackage("example.com/test")), DeepEquals,
+		[]string{"League", "Number", "ReadWriter", "Reader", "Store", "Team", "User", "Writer"})
+	c.Assert(names(typeLibrary.ServiceTypes()), DeepEquals, []string{"ReadWriter", "Reader", "Writer"})
+
+	// reverse dependencies
+	c.Assert(names(typeLibrary.ReferencesTo(get("User"), false)), DeepEquals, []string{"Reader", "Team", "Writer"})
+	c.Assert(names(typeLibrary.ReferencesTo(get("User"), true)), DeepEquals,
+		[]string{"League", "ReadWriter", "Reader", "Store", "Team", "Writer"})
+
+	// implementations (via embedding)
+	c.Assert(names(typeLibrary.Implementations(get("Reader"))), DeepEquals, []string{"ReadWriter", "Store"})
+	c.Assert(typeLibrary.Implementations(get("User")), IsNil)
+
+	// predicates and globs
+	c.Assert(names(typeLibrary.FindTypes(func(key string, t *Type) bool {
+		return t.IsRecordType() && !t.AsRecordType().IsInterface
+	})), DeepEquals, []string{"Store", "Team", "User"})
+	matched, err := typeLibrary.MatchTypes("*er")
+	c.Assert(err, IsNil)
+	c.Assert(names(matched), DeepEquals, []string{"Number", "ReadWriter", "Reader", "User", "Writer"})
+	matched, err = typeLibrary.MatchTypes("test.T*")
+	c.Assert(err, IsNil)
+	c.Assert(names(matched), DeepEquals, []string{"Team"})
+	matched, err = typeLibrary.MatchTypes("example.com/*.S*")
+	c.Assert(err, IsNil)
+	c.Assert(names(matched), DeepEquals, []string{"Store"})
+	_, err = typeLibrary.MatchTypes("[")
+	c.Assert(err, NotNil)
+}
+
+func (s *TestSuite) TestMethodSets(c *C) {
+	_, typeLibrary := parseTestSource(c, `package test
+
+type Reader interface {
+	Read(id string) (string, error)
+}
+
+type File struct {
+	Path string
+}
+
+func (f File) Read(id string) (string, error) {
+	return f.Path + id, nil
+}
+
+type Cache struct{}
+
+func (c *Cache) Read(id string) (string, error) {
+	return id, nil
+}
+
+type Files []File
+
+func (f Files) Len() int {
+	return len(f)
+}
+
+type CachedFile struct {
+	*Cache
+	Name string
+}
+
+type OtherFile File
+`)
+	methodNames := func(methods map[string]*Type) (out []string) {
+		for name := range methods {
+			out = append(out, name)
+		}
+		sort.Strings(out)
+		return
+	}
+	get := func(name string) *Type { return typeLibrary.GetType("example.com/test", name) }
+	pointerTo := func(t *Type) *Type {
+		return &Type{TypeClass: ReferenceType, TypeData: &ReferenceTypeData{TargetType: t}}
+	}
+	reader, cache := get("Reader"), get("Cache")
+
+	c.Assert(methodNames(MethodSet(get("File"))), DeepEquals, []string{"Read"})
+	c.Assert(methodNames(MethodSet(get("Files"))), DeepEquals, []string{"Len"})
+	c.Assert(typeLibrary.Signature(MethodSet(get("Files"))["Len"]), Equals, "func() int")
+
+	// methods with pointer receivers are only in the method sets of pointers
+	c.Assert(cache.Methods()[0].PointerReceiver, Equals, true)
+	c.Assert(methodNames(MethodSet(cache)), IsNil)
+	c.Assert(methodNames(MethodSet(pointerTo(cache))), DeepEquals, []string{"Read"})
+	c.Assert(AssignableTo(get("File"), reader), Equals, true)
+	c.Assert(AssignableTo(cache, reader), Equals, false)
+	c.Assert(AssignableTo(pointerTo(cache), reader), Equals, true)
+
+	// methods are promoted from embedded fields but not inherited by types
+	// defined with other named types
+	c.Assert(methodNames(MethodSet(get("CachedFile"))), DeepEquals, []string{"Read"})
+	c.Assert(methodNames(MethodSet(get("OtherFile"))), IsNil)
+
+	typeNames := func(types []*Type) (out []string) {
+		for _, t := range types {
+			out = append(out, t.LeafType().Name)
+		}
+		return
+	}
+	c.Assert(typeNames(typeLibrary.Implementations(reader)), DeepEquals, []string{"Cache", "CachedFile", "File"})
+}
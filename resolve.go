@@ -0,0 +1,212 @@
+package bridge
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+/**
+ * A type that could not be resolved along with everywhere it is used.
+ */
+type UnresolvedRef struct {
+	Name    string
+	Package string
+
+	// The placeholder standing in for the type
+	Type *Type
+
+	// Positions of all references to the type (in file order)
+	Uses []token.Position
+}
+
+/**
+ * The outcome of resolving the types that were referred to but not
+ * declared in a set of files.
+ */
+type ResolutionReport struct {
+	// Placeholders that were resolved and the types they resolved to
+	Resolved map[*Type]*Type
+
+	// Types that could not be resolved (sorted by package and name)
+	Unresolved []*UnresolvedRef
+
+	// An error for each use of an unresolved type
+	Diagnostics Diagnostics
+}
+
+/**
+ * Resolves the placeholders left behind once all the files (of the packages
+ * they belong to) have been processed.  Each placeholder is looked up in:
+ *
+ * 	1. its imported package - references (eg pkg.Name) to packages that
+ * 	were loaded but do not declare the type are unresolved,
+ * 	2. the packages dot imported by the files referring to it (it is an
+ * 	error for more than one of them to declare it),
+ * 	3. the universe (predeclared types such as error or any).
+ *
+ * Resolved placeholders are removed from the type library and references to
+ * them are replaced with the types they resolved to.  Everything else is
+ * reported with all its use sites.  Types from packages that are not among
+ * the files (eg the standard library) are left as they are.
+ */
+func ResolveTypes(typeLibrary ITypeLibrary, files []*ParsedFile) *ResolutionReport {
+	loaded := make(map[string]bool)
+	for _, parsedFile := range files {
+		loaded[parsedFile.PackagePath] = true
+	}
+	return resolveTypes(typeLibrary, files, func(importPath string) bool {
+		return loaded[importPath]
+	})
+}
+
+/**
+ * Resolves the types referred to in the files given a way to tell which
+ * packages have been loaded.
+ */
+func resolveTypes(typeLibrary ITypeLibrary, files []*ParsedFile, isLoaded func(importPath string) bool) *ResolutionReport {
+	report := &ResolutionReport{Resolved: make(map[*Type]*Type)}
+
+	// all the uses (and the files using them) of each pending type
+	uses := make(map[*Type][]token.Position)
+	usedIn := make(map[*Type][]*ParsedFile)
+	var pending []*Type
+	for _, parsedFile := range files {
+		for t, positions := range parsedFile.pendingUses {
+			if t.TypeClass != UnresolvedType && t.TypeClass != NamedType {
+				// declared since it was referred to
+				continue
+			}
+			if _, ok := uses[t]; !ok {
+				pending = append(pending, t)
+			}
+			for _, pos := range positions {
+				uses[t] = append(uses[t], parsedFile.Position(pos))
+			}
+			usedIn[t] = append(usedIn[t], parsedFile)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		a, b := pending[i].AsNamedType(), pending[j].AsNamedType()
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return a.Name < b.Name
+	})
+
+	for _, t := range pending {
+		data := t.AsNamedType()
+		var resolved *Type
+		switch t.TypeClass {
+		case NamedType:
+			if !isLoaded(data.Package) {
+				// opaque type from a package that was not loaded
+				continue
+			}
+		case UnresolvedType:
+			if ast.IsExported(data.Name) {
+				declaredIn, opaque := dotImportsDeclaring(typeLibrary, data.Name, usedIn[t], isLoaded)
+				if len(declaredIn) == 1 {
+					resolved = typeLibrary.GetType(declaredIn[0], data.Name)
+				} else if len(declaredIn) > 1 {
+					for _, position := range uses[t] {
+						report.Diagnostics.AddError(position, CodeDotImport, "ambiguous type %s (declared in %s)",
+							data.Name, strings.Join(declaredIn, " and "))
+					}
+					continue
+				} else if opaque {
+					// may be from a dot imported package that was not loaded
+					continue
+				}
+			} else if object, ok := types.Universe.Lookup(data.Name).(*types.TypeName); ok {
+				resolved = typeLibrary.GetGlobalType(object.Name())
+				if resolved == nil {
+					resolved = typeLibrary.AddGlobalType(object.Name())
+				}
+			}
+		}
+
+		if resolved == nil {
+			ref := &UnresolvedRef{Name: data.Name, Package: data.Package, Type: t, Uses: uses[t]}
+			report.Unresolved = append(report.Unresolved, ref)
+			name := data.Name
+			if t.TypeClass == NamedType {
+				name = ImportName(data.Package) + "." + name
+			}
+			for _, position := range ref.Uses {
+				report.Diagnostics.AddError(position, CodeUnresolvedType, "undefined type %s", name)
+			}
+			continue
+		}
+		report.Resolved[t] = resolved
+		if typeLibrary.GetType(data.Package, data.Name) == t {
+			typeLibrary.RemoveType(data.Package, data.Name)
+		}
+	}
+
+	replaceReferences(typeLibrary, report.Resolved)
+	for placeholder, resolved := range report.Resolved {
+		// for those still holding on to the placeholder
+		data := *placeholder.AsNamedType()
+		placeholder.TypeClass = AliasType
+		placeholder.TypeData = &AliasTypeData{NamedTypeData: data, TargetType: resolved, IsAlias: true}
+	}
+	report.Diagnostics.Sort()
+	return report
+}
+
+/**
+ * Returns the packages (dot imported by the files) that declare a type with
+ * the given name and whether any of these packages was not loaded (in which
+ * case the type may be declared there).
+ */
+func dotImportsDeclaring(typeLibrary TypeStore, name string, files []*ParsedFile, isLoaded func(string) bool) (out []string, opaque bool) {
+	seen := make(map[string]bool)
+	for _, parsedFile := range files {
+		for _, importPath := range parsedFile.DotImports {
+			if seen[importPath] {
+				continue
+			}
+			seen[importPath] = true
+			if !isLoaded(importPath) {
+				opaque = true
+				continue
+			}
+			t := typeLibrary.GetType(importPath, name)
+			if t != nil && t.TypeClass != NamedType && t.TypeClass != UnresolvedType {
+				out = append(out, importPath)
+			}
+		}
+	}
+	sort.Strings(out)
+	return
+}
+
+/**
+ * Replaces all references (in the types in the library and the types
+ * they are made of) to the keys of a mapping with their values.
+ */
+func replaceReferences(typeLibrary TypeStore, mapping map[*Type]*Type) {
+	if len(mapping) == 0 {
+		return
+	}
+	visited := make(map[*Type]bool)
+	var visit func(t *Type)
+	visit = func(t *Type) {
+		if t == nil || visited[t] {
+			return
+		}
+		visited[t] = true
+		for _, slot := range childSlots(t) {
+			if resolved, ok := mapping[*slot]; ok {
+				*slot = resolved
+			}
+			visit(*slot)
+		}
+	}
+	typeLibrary.ForEach(func(key string, t *Type, stop *bool) {
+		visit(t)
+	})
+}
@@ -0,0 +1,105 @@
+package bridge
+
+import (
+	. "gopkg.in/check.v1"
+	"path/filepath"
+)
+
+func (s *TestSuite) TestResolveTypes(c *C) {
+	root := c.MkDir()
+	writeTestFiles(c, root, map[string]string{
+		"go.mod": "module example.com/res\n",
+		"core/service.go": `package core
+
+import (
+	. "example.com/res/models"
+	"example.com/res/other"
+)
+
+type Request struct {
+	User    *User
+	Handle  uintptr
+	Filter  Filter
+	Filters []Filter
+	Other   other.Missing
+}
+`,
+		"core/more.go": `package core
+
+type Response struct {
+	Filter Filter
+}
+`,
+		"models/models.go": `package models
+
+type User struct {
+	Name string
+}
+`,
+		"other/other.go": `package other
+
+type Present struct{}
+`,
+	})
+	typeLibrary := NewTypeLibrary()
+	loader := NewLoader(typeLibrary)
+	_, err := loader.Load(filepath.Join(root, "core"))
+	c.Assert(err, IsNil)
+
+	request := typeLibrary.GetType("example.com/res/core", "Request").AsRecordType()
+
+	// dot imports
+	user := typeLibrary.GetType("example.com/res/models", "User")
+	c.Assert(user.TypeClass, Equals, RecordType)
+	c.Assert(request.Fields[0].Type.AsReferenceType().TargetType, Equals, user)
+	c.Assert(typeLibrary.GetType("example.com/res/core", "User"), IsNil)
+
+	// universe types
+	c.Assert(request.Fields[1].Type, Equals, typeLibrary.GetGlobalType("uintptr"))
+	c.Assert(typeLibrary.GetType("example.com/res/core", "uintptr"), Equals, typeLibrary.GetGlobalType("uintptr"))
+
+	// types that are not declared anywhere are reported with all their uses
+	c.Assert(len(loader.Unresolved), Equals, 2)
+	filter := loader.Unresolved[0]
+	c.Assert(filter.Name, Equals, "Filter")
+	c.Assert(filter.Type, Equals, request.Fields[2].Type)
+	c.Assert(len(filter.Uses), Equals, 3)
+	c.Assert(filepath.Base(filter.Uses[0].Filename), Equals, "more.go")
+	c.Assert(filter.Uses[1].Line, Equals, 11)
+	c.Assert(filter.Uses[2].Line, Equals, 12)
+	missing := loader.Unresolved[1]
+	c.Assert(missing.Name, Equals, "Missing")
+	c.Assert(missing.Package, Equals, "example.com/res/other")
+	c.Assert(len(loader.Diagnostics.Filter(SeverityError)), Equals, 4)
+	c.Assert(loader.Diagnostics[3].Message, Equals, "undefined type other.Missing")
+
+	// and are still safe to print
+	c.Assert(typeLibrary.Signature(request.Fields[3].Type), Equals, "[]example.com/res/core.Filter")
+	c.Assert(typeLibrary.Signature(request.Fields[4].Type), Equals, "example.com/res/other.Missing")
+}
+
+func (s *TestSuite) TestResolveAmbiguousDotImports(c *C) {
+	root := c.MkDir()
+	writeTestFiles(c, root, map[string]string{
+		"go.mod": "module example.com/amb\n",
+		"core/core.go": `package core
+
+import (
+	. "example.com/amb/a"
+	. "example.com/amb/b"
+)
+
+type Request struct {
+	Item Item
+}
+`,
+		"a/a.go": "package a\n\ntype Item struct{}\n",
+		"b/b.go": "package b\n\ntype Item struct{}\n",
+	})
+	loader := NewLoader(NewTypeLibrary())
+	_, err := loader.Load(filepath.Join(root, "core"))
+	c.Assert(err, IsNil)
+	c.Assert(len(loader.Diagnostics), Equals, 1)
+	c.Assert(loader.Diagnostics[0].Code, Equals, CodeDotImport)
+	c.Assert(loader.Diagnostics[0].Message, Equals, "ambiguous type Item (declared in example.com/amb/a and example.com/amb/b)")
+}
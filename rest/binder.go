@@ -1,13 +1,26 @@
 package rest
 
 import (
-	// "github.com/gorilla/mux"
-	// "github.com/panyam/bridge"
-	"log"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/panyam/bridge"
+	"io"
 	"net/http"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 )
 
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// Maximum memory used for parsing multipart forms
+const maxFormMemory = 32 << 20
+
 type HttpBinding struct {
 	/**
 	 * Methods required to match for this binding to get triggered.
@@ -41,21 +54,97 @@ type HttpBinding struct {
 	RequestType      reflect.Type
 	RequestTypeIsPtr bool
 
+	/**
+	 * Types of all the parameters of the operation (excluding the context).
+	 * The request type is derived from the first of these.  Operations with
+	 * more than one parameter read their parameters from a list in the body
+	 * and are addressed as "Arg0", "Arg1" etc in the mappings.
+	 */
+	ParamTypes []reflect.Type
+
+	/**
+	 * Whether the operation takes a context.Context as its first parameter.
+	 * The context of the http request is passed to such operations.
+	 */
+	HasContext bool
+
+	/**
+	 * Whether the last output of the operation is an error.
+	 */
+	ReturnsError bool
+
 	/**
 	 * The method corresponding to the operation within the service.
 	 */
 	Method reflect.Value
 }
 
-func NewHttpBinding(url string, methods []string, service interface{}, operation string) *HttpBinding {
+/**
+ * Creates a binding for an operation on a service.  The operation must be an
+ * exported method on the service whose parameters are an optional
+ * context.Context followed by zero or more request parameters and whose
+ * outputs can optionally end with an error, eg:
+ *
+ * 	GetUser(request *GetUserRequest) (*User, error)
+ * 	GetUser(ctx context.Context, request *GetUserRequest) (*User, error)
+ * 	AddMember(ctx context.Context, team *Team, user *User) error
+ */
+func NewHttpBinding(url string, methods []string, service interface{}, operation string) (*HttpBinding, error) {
 	out := HttpBinding{Url: url, Methods: methods, Service: service, Operation: operation}
-	//out.Method = utils.GetMethod(service, operation)
-	// out.RequestTypeIsPtr, out.RequestType = utils.GetParamType(out.Method, 0)
-	if out.RequestType != nil {
-		return &out
+	if service == nil {
+		return nil, fmt.Errorf("No service provided for operation '%s'", operation)
 	}
-	log.Println("Invalid operation on service: ", operation)
-	return nil
+	out.Method = reflect.ValueOf(service).MethodByName(operation)
+	if !out.Method.IsValid() {
+		return nil, fmt.Errorf("Service %T has no exported operation '%s'", service, operation)
+	}
+
+	methodType := out.Method.Type()
+	if methodType.IsVariadic() {
+		return nil, fmt.Errorf("Operation %T.%s cannot be variadic", service, operation)
+	}
+	for index := 0; index < methodType.NumIn(); index++ {
+		paramType := methodType.In(index)
+		if paramType == contextType && index == 0 {
+			out.HasContext = true
+			continue
+		}
+		if paramType == contextType || paramType.Kind() == reflect.Func || paramType.Kind() == reflect.Chan {
+			return nil, fmt.Errorf("Parameter %d of operation %T.%s has unsupported type %s", index, service, operation, paramType)
+		}
+		out.ParamTypes = append(out.ParamTypes, paramType)
+	}
+	for index := 0; index < methodType.NumOut(); index++ {
+		if methodType.Out(index) == errorType {
+			if index != methodType.NumOut()-1 {
+				return nil, fmt.Errorf("Error can only be the last output of operation %T.%s", service, operation)
+			}
+			out.ReturnsError = true
+		}
+	}
+
+	if len(out.ParamTypes) > 0 {
+		out.RequestType = out.ParamTypes[0]
+		if out.RequestType.Kind() == reflect.Ptr {
+			out.RequestType = out.RequestType.Elem()
+			out.RequestTypeIsPtr = true
+		}
+	}
+	return &out, nil
+}
+
+/**
+ * Returns the types of the parameters of the operation.  Bindings created
+ * without NewHttpBinding may only specify the RequestType.
+ */
+func (hb *HttpBinding) paramTypes() []reflect.Type {
+	if hb.ParamTypes == nil && hb.RequestType != nil {
+		if hb.RequestTypeIsPtr {
+			return []reflect.Type{reflect.PtrTo(hb.RequestType)}
+		}
+		return []reflect.Type{hb.RequestType}
+	}
+	return hb.ParamTypes
 }
 
 /**
@@ -74,70 +163,365 @@ func NewHttpBinding(url string, methods []string, service interface{}, operation
  * 	will also by default map directly to request field names.  However these can
  * 	be overridden by a mapping of the form:
  *
- * 	NameMappings = {
- * 		"FormParamName1" = "Request.Field1"
- * 		"FormParamName2" = "Request.Field1.ChildField"
+ * 	ParamMappings = {
+ * 		"FormParamName1" = ["Request.Field1"]
+ * 		"FormParamName2" = ["Request.Field1.ChildField"]
  * 	}
  *
  * 	With parameterized URL paths, URLs will be specified as:
  *
  * 	/path1/path2/{param1:Request.Field1}/path3/{param2:Request.Field2}/
+ *
+ * 	which populate the VarMappings of the binding.  Values from the query
+ * 	and form parameters override those in the body and values from the path
+ * 	override both.
  */
-/*
-func (hb *HttpBinding) ExtractRequest(request *http.Request) (*bridge.ServiceOperation, error) {
-	param := reflect.New(hb.RequestType)
-	out := bridge.ServiceOperation{Method: hb.Method, RequestParam: param}
+func (hb *HttpBinding) ExtractRequest(request *http.Request, variables map[string]string) (*bridge.ServiceOperation, error) {
+	if !hb.Method.IsValid() {
+		return nil, fmt.Errorf("Binding for operation '%s' has no method", hb.Operation)
+	}
+	paramTypes := hb.paramTypes()
+	params := make([]reflect.Value, len(paramTypes))
+	for index, paramType := range paramTypes {
+		if paramType.Kind() == reflect.Ptr {
+			paramType = paramType.Elem()
+		}
+		params[index] = reflect.New(paramType)
+	}
 
-	// variables = mux.Vars(request)
+	if isFormRequest(request) {
+		if err := parseForm(request); err != nil {
+			return nil, &HttpError{Code: http.StatusBadRequest, Message: "Invalid form data: " + err.Error()}
+		}
+	} else if request.Body != nil && request.ContentLength != 0 && len(params) > 0 {
+		if err := decodeParams(request.Body, params); err != nil {
+			return nil, &HttpError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()}
+		}
+	}
+
+	var errs BindingErrors
+	values := request.Form
+	if values == nil {
+		values = request.URL.Query()
+	}
+	for _, name := range sortedKeys(values) {
+		errs = hb.bindParam(params, name, hb.ParamMappings[name], values[name], errs)
+	}
+	varValues := make(map[string][]string)
+	for name, value := range variables {
+		varValues[name] = []string{value}
+	}
+	for _, name := range sortedKeys(varValues) {
+		errs = hb.bindParam(params, name, hb.VarMappings[name], varValues[name], errs)
+	}
+	if errs != nil {
+		return nil, errs
+	}
+
+	out := bridge.ServiceOperation{Method: hb.Method, Params: []reflect.Value{}}
+	if hb.HasContext {
+		out.Params = append(out.Params, reflect.ValueOf(request.Context()))
+	}
+	for index, param := range params {
+		if paramTypes[index].Kind() != reflect.Ptr {
+			param = param.Elem()
+		}
+		if index == 0 {
+			out.RequestParam = param
+		}
+		out.Params = append(out.Params, param)
+	}
 	return &out, nil
 }
-*/
+
+/**
+ * Decodes the body into the parameters.  A single parameter is decoded from
+ * the body as is where as multiple parameters are decoded from a list.
+ */
+func decodeParams(body io.Reader, params []reflect.Value) error {
+	decoder := json.NewDecoder(body)
+	if len(params) == 1 {
+		if err := decoder.Decode(params[0].Interface()); err != nil && err != io.EOF {
+			return err
+		}
+		return nil
+	}
+	var values []json.RawMessage
+	if err := decoder.Decode(&values); err != nil && err != io.EOF {
+		return err
+	}
+	if len(values) > len(params) {
+		return fmt.Errorf("Expected at most %d parameters, found %d", len(params), len(values))
+	}
+	for index, value := range values {
+		if err := json.Unmarshal(value, params[index].Interface()); err != nil {
+			return fmt.Errorf("Parameter %d: %s", index, err)
+		}
+	}
+	return nil
+}
+
+/**
+ * Binds the values of a parameter to each of the keys it is mapped to.  Un
+ * mapped parameters are bound to the field they name (eg "Name" in the
+ * request or "Arg1.Id" in the second parameter) if such a field exists and
+ * are ignored otherwise.
+ */
+func (hb *HttpBinding) bindParam(params []reflect.Value, name string, keys []string, values []string, errs BindingErrors) BindingErrors {
+	if keys == nil {
+		param, fieldKey, err := paramForKey(params, name)
+		if err != nil || fieldKey == "" || !HasField(param.Type(), fieldKey) {
+			return errs
+		}
+		keys = []string{name}
+	}
+	for _, key := range keys {
+		param, fieldKey, err := paramForKey(params, key)
+		if err == nil {
+			err = BindField(param, fieldKey, values)
+		}
+		if err != nil {
+			errs = append(errs, &FieldError{Param: name, Key: key, Value: strings.Join(values, ","), Err: err})
+		}
+	}
+	return errs
+}
+
+/**
+ * Finds the parameter a key refers to.  Keys starting with "ArgN" refer to
+ * the Nth parameter and all other keys refer to the first parameter.
+ */
+func paramForKey(params []reflect.Value, key string) (reflect.Value, string, error) {
+	root, rest := key, ""
+	if index := strings.Index(key, "."); index >= 0 {
+		root, rest = key[:index], key[index+1:]
+	}
+	if strings.HasPrefix(root, "Arg") {
+		if index, err := strconv.Atoi(root[3:]); err == nil {
+			if index >= len(params) {
+				return reflect.Value{}, "", fmt.Errorf("Operation has only %d parameters", len(params))
+			}
+			return params[index], rest, nil
+		}
+	}
+	if len(params) == 0 {
+		return reflect.Value{}, "", errors.New("Operation has no parameters")
+	}
+	return params[0], key, nil
+}
+
+func isFormRequest(request *http.Request) bool {
+	contentType := request.Header.Get("Content-Type")
+	return strings.HasPrefix(contentType, "application/x-www-form-urlencoded") ||
+		strings.HasPrefix(contentType, "multipart/form-data")
+}
+
+func parseForm(request *http.Request) error {
+	if strings.HasPrefix(request.Header.Get("Content-Type"), "multipart/form-data") {
+		return request.ParseMultipartForm(maxFormMemory)
+	}
+	return request.ParseForm()
+}
+
+func sortedKeys(values map[string][]string) []string {
+	out := make([]string, 0, len(values))
+	for key := range values {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+/**
+ * Writes the values returned by a service operation to a http response.
+ *
+ * If the operation returned a non nil error then the error is written out as
+ * an internal server error.  Otherwise a single output is written as is
+ * and multiple outputs are written as a list (with nil errors written as
+ * nulls) so that they line up with the outputs of the service operation.
+ * Operations without outputs (other than an error) result in a 204 (No
+ * Content) response without a body.
+ */
+func (hb *HttpBinding) WriteOutputs(writer http.ResponseWriter, outputs []reflect.Value) error {
+	values := make([]interface{}, len(outputs))
+	numValues := 0
+	for index, output := range outputs {
+		if output.Type() == errorType {
+			if !output.IsNil() {
+				http.Error(writer, output.Interface().(error).Error(), http.StatusInternalServerError)
+				return nil
+			}
+			continue
+		}
+		values[index] = output.Interface()
+		numValues++
+	}
+	if numValues == 0 {
+		writer.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(writer)
+	if len(values) == 1 {
+		return encoder.Encode(values[0])
+	}
+	return encoder.Encode(values)
+}
 
 type HttpInputBinder struct {
 	// Methods that are ok for this
 	Bindings []*HttpBinding
+
+	// Router over the bindings and the number of bindings added to it so far
+	// (guarded by mutex as bindings can be added while requests are served)
+	router       *UrlRouter
+	numRouted    int
+	routingError error
+	mutex        sync.RWMutex
 }
 
-/*
 func (h *HttpInputBinder) ExtractInput(transportRequest interface{}) (*bridge.ServiceOperation, error) {
 	request := transportRequest.(*http.Request)
-	binding := h.MatchBinding(request)
+	binding, variables, err := h.MatchBinding(request)
 	// then extract the operation items
 	if binding == nil {
 		// No binding found so return
-		return nil, nil
+		return nil, err
 	}
 
 	// extract request from binding
-	return binding.ExtractRequest(request)
-}
-*/
-
-func (h *HttpInputBinder) MatchBinding(request *http.Request) *HttpBinding {
-	// TODO: Use a Trie to store matches based on prefixes
-	for _, binding := range h.Bindings {
-		matched := binding.Methods == nil
-		if !matched {
-			for _, method := range binding.Methods {
-				if method == request.Method {
-					matched = true
-					break
-				}
-			}
+	return binding.ExtractRequest(request, variables)
+}
+
+/**
+ * Finds the binding that matches the method and url of a request along with
+ * the values of the path variables in the url.
+ *
+ * If no binding matches then a HttpError is returned whose code indicates
+ * whether the url did not match any binding (404) or if the url matched
+ * but the method did not (405).
+ */
+func (h *HttpInputBinder) MatchBinding(request *http.Request) (*HttpBinding, map[string]string, error) {
+	h.mutex.RLock()
+	if h.router == nil || h.numRouted < len(h.Bindings) {
+		h.mutex.RUnlock()
+		h.mutex.Lock()
+		h.updateRouter()
+		h.mutex.Unlock()
+		h.mutex.RLock()
+	}
+	defer h.mutex.RUnlock()
+	if h.routingError != nil {
+		return nil, nil, h.routingError
+	}
+	return h.router.Match(request.Method, request.URL.EscapedPath())
+}
+
+/**
+ * Adds a binding (this is safe to call while requests are being served).
+ */
+func (h *HttpInputBinder) AddBinding(binding *HttpBinding) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.Bindings = append(h.Bindings, binding)
+	return h.updateRouter()
+}
+
+/**
+ * Adds bindings that have not yet been added to the router (eg when
+ * Bindings was populated directly).  The mutex must be locked.
+ */
+func (h *HttpInputBinder) updateRouter() error {
+	if h.router == nil {
+		h.router = NewUrlRouter()
+	}
+	for h.numRouted < len(h.Bindings) && h.routingError == nil {
+		h.routingError = h.router.AddBinding(h.Bindings[h.numRouted])
+		h.numRouted++
+	}
+	return h.routingError
+}
+
+/**
+ * Dispatches a http request to the service operation bound to it and
+ * writes the outputs of the operation to the response.
+ */
+func (h *HttpInputBinder) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	binding, variables, err := h.MatchBinding(request)
+	if err == nil {
+		var operation *bridge.ServiceOperation
+		operation, err = binding.ExtractRequest(request, variables)
+		if err == nil {
+			err = binding.WriteOutputs(writer, operation.Invoke())
 		}
+	}
+	if err != nil {
+		WriteError(writer, err)
+	}
+}
 
-		if !matched {
-			return nil
+/**
+ * Maps a path variable to a key within the request.
+ */
+func (hb *HttpBinding) AddVarMapping(name string, key string) {
+	if hb.VarMappings == nil {
+		hb.VarMappings = make(map[string][]string)
+	}
+	for _, existing := range hb.VarMappings[name] {
+		if existing == key {
+			return
 		}
+	}
+	hb.VarMappings[name] = append(hb.VarMappings[name], key)
+}
 
-		// now see if URL matches
-		// variables = mux.Vars(request)
+/**
+ * Tells if the binding accepts a particular http method.  Bindings without
+ * any methods accept all methods.
+ */
+func (hb *HttpBinding) MatchesMethod(method string) bool {
+	if hb.Methods == nil {
+		return true
 	}
-	return nil
+	for _, m := range hb.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
 }
 
-func (h *HttpInputBinder) AddBinding(binding *HttpBinding) {
-	// TODO: store the bindings as Trie so we dont have to search every
-	// match each time
-	h.Bindings = append(h.Bindings, binding)
+/**
+ * Errors that carry the http status code to be returned to the client.
+ */
+type HttpError struct {
+	Code    int
+	Message string
+
+	// Methods allowed on the url when the method of a request did not match
+	Allowed []string
+}
+
+func (e *HttpError) Error() string {
+	if e.Message == "" {
+		return http.StatusText(e.Code)
+	}
+	return e.Message
+}
+
+/**
+ * Writes an error to the response with the status code of the error if it
+ * is a HttpError or as an internal server error otherwise.
+ */
+func WriteError(writer http.ResponseWriter, err error) {
+	if httpErr, ok := err.(*HttpError); ok {
+		if httpErr.Allowed != nil {
+			writer.Header().Set("Allow", strings.Join(httpErr.Allowed, ", "))
+		}
+		http.Error(writer, httpErr.Error(), httpErr.Code)
+	} else if _, ok := err.(BindingErrors); ok {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	} else {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+	}
 }
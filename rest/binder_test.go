@@ -0,0 +1,256 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type TestSuite struct {
+}
+
+var _ = Suite(&TestSuite{})
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type GetUserRequest struct {
+	UserId string
+	Detail bool
+}
+
+type User struct {
+	Id   string
+	Name string
+}
+
+type TestUserService struct {
+}
+
+func (s *TestUserService) GetUser(request *GetUserRequest) (*User, error) {
+	if request.UserId == "" {
+		return nil, errors.New("UserId required")
+	}
+	return &User{Id: request.UserId, Name: "User " + request.UserId}, nil
+}
+
+func NewTestBinding(c *C, url string, methods []string, service interface{}, operation string) *HttpBinding {
+	binding, err := NewHttpBinding(url, methods, service, operation)
+	c.Assert(err, IsNil)
+	return binding
+}
+
+func (s *TestSuite) TestServeHTTP(c *C) {
+	binder := &HttpInputBinder{}
+	binder.AddBinding(NewTestBinding(c, "/users/", []string{"POST"}, &TestUserService{}, "GetUser"))
+
+	request := httptest.NewRequest("POST", "/users/", bytes.NewBufferString(`{"UserId": "42"}`))
+	recorder := httptest.NewRecorder()
+	binder.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), Equals, `[{"Id":"42","Name":"User 42"},null]`+"\n")
+
+	request = httptest.NewRequest("POST", "/users/", bytes.NewBufferString(`{}`))
+	recorder = httptest.NewRecorder()
+	binder.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusInternalServerError)
+
+	// path variables are unescaped after the path is split
+	binder.AddBinding(NewTestBinding(c, "/users/{id:Request.UserId}", []string{"GET"}, &TestUserService{}, "GetUser"))
+	recorder = httptest.NewRecorder()
+	binder.ServeHTTP(recorder, httptest.NewRequest("GET", "/users/u%201%2F2", nil))
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), Equals, `[{"Id":"u 1/2","Name":"User u 1/2"},null]`+"\n")
+}
+
+func (s *TestSuite) TestServeHTTPNoMatch(c *C) {
+	binder := &HttpInputBinder{}
+	binder.AddBinding(NewTestBinding(c, "/users/", []string{"POST"}, &TestUserService{}, "GetUser"))
+
+	recorder := httptest.NewRecorder()
+	binder.ServeHTTP(recorder, httptest.NewRequest("GET", "/users/", nil))
+	c.Assert(recorder.Code, Equals, http.StatusMethodNotAllowed)
+
+	recorder = httptest.NewRecorder()
+	binder.ServeHTTP(recorder, httptest.NewRequest("GET", "/teams/", nil))
+	c.Assert(recorder.Code, Equals, http.StatusNotFound)
+}
+
+type SearchFilter struct {
+	Tags  []string
+	Limit int
+}
+
+type SearchRequest struct {
+	TeamId string
+	Query  string
+	Filter *SearchFilter
+}
+
+type TestSearchService struct {
+}
+
+func (s *TestSearchService) Search(request SearchRequest) (SearchRequest, error) {
+	return request, nil
+}
+
+func (s *TestSuite) TestParamAndVarMappings(c *C) {
+	binding := NewTestBinding(c, "/teams/{team:Request.TeamId}/search", []string{"GET", "POST"}, &TestSearchService{}, "Search")
+	binding.ParamMappings = map[string][]string{
+		"tag":   []string{"Request.Filter.Tags"},
+		"limit": []string{"Request.Filter.Limit"},
+	}
+	binder := &HttpInputBinder{}
+	c.Assert(binder.AddBinding(binding), IsNil)
+
+	recorder := httptest.NewRecorder()
+	binder.ServeHTTP(recorder, httptest.NewRequest("GET", "/teams/t1/search?query=hello&tag=a&tag=b&limit=10", nil))
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), Equals, `[{"TeamId":"t1","Query":"hello","Filter":{"Tags":["a","b"],"Limit":10}},null]`+"\n")
+
+	request := httptest.NewRequest("POST", "/teams/t2/search", bytes.NewBufferString("query=world&limit=5"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder = httptest.NewRecorder()
+	binder.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), Equals, `[{"TeamId":"t2","Query":"world","Filter":{"Tags":null,"Limit":5}},null]`+"\n")
+}
+
+func (s *TestSuite) TestParamConversionErrors(c *C) {
+	binding := NewTestBinding(c, "/teams/{team:Request.TeamId}/search", nil, &TestSearchService{}, "Search")
+	binding.ParamMappings = map[string][]string{"limit": []string{"Request.Filter.Limit"}}
+	binder := &HttpInputBinder{}
+	binder.AddBinding(binding)
+
+	request := httptest.NewRequest("GET", "/teams/t1/search?limit=ten", nil)
+	_, err := binder.ExtractInput(request)
+	errs, ok := err.(BindingErrors)
+	c.Assert(ok, Equals, true)
+	c.Assert(len(errs), Equals, 1)
+	c.Assert(errs[0].Param, Equals, "limit")
+	c.Assert(errs[0].Key, Equals, "Request.Filter.Limit")
+
+	recorder := httptest.NewRecorder()
+	binder.ServeHTTP(recorder, httptest.NewRequest("GET", "/teams/t1/search?limit=ten", nil))
+	c.Assert(recorder.Code, Equals, http.StatusBadRequest)
+}
+
+type TestTeamService struct {
+}
+
+func (s *TestTeamService) AddMember(ctx context.Context, teamId string, user *User) (int, error) {
+	if ctx == nil {
+		return 0, errors.New("Context required")
+	}
+	return len(teamId) + len(user.Name), nil
+}
+
+func (s *TestTeamService) RemoveMember(teamId string, userId string) error {
+	if userId == "" {
+		return errors.New("UserId required")
+	}
+	return nil
+}
+
+func (s *TestTeamService) Count() int {
+	return 3
+}
+
+func (s *TestTeamService) Broken() (error, int) {
+	return nil, 0
+}
+
+func (s *TestSuite) TestNewHttpBinding(c *C) {
+	binding := NewTestBinding(c, "/users/", nil, &TestUserService{}, "GetUser")
+	c.Assert(binding.RequestType.Name(), Equals, "GetUserRequest")
+	c.Assert(binding.RequestTypeIsPtr, Equals, true)
+	c.Assert(binding.HasContext, Equals, false)
+	c.Assert(binding.ReturnsError, Equals, true)
+
+	binding = NewTestBinding(c, "/teams/", nil, &TestTeamService{}, "AddMember")
+	c.Assert(binding.RequestType.Kind(), Equals, reflect.String)
+	c.Assert(binding.RequestTypeIsPtr, Equals, false)
+	c.Assert(len(binding.ParamTypes), Equals, 2)
+	c.Assert(binding.HasContext, Equals, true)
+
+	binding = NewTestBinding(c, "/count/", nil, &TestTeamService{}, "Count")
+	c.Assert(binding.RequestType, IsNil)
+	c.Assert(binding.ReturnsError, Equals, false)
+
+	_, err := NewHttpBinding("/users/", nil, &TestUserService{}, "DeleteUser")
+	c.Assert(err, ErrorMatches, ".*has no exported operation 'DeleteUser'")
+	_, err = NewHttpBinding("/broken/", nil, &TestTeamService{}, "Broken")
+	c.Assert(err, ErrorMatches, "Error can only be the last output.*")
+	_, err = NewHttpBinding("/users/", nil, nil, "GetUser")
+	c.Assert(err, Not(IsNil))
+}
+
+func (s *TestSuite) TestMultiParamOperation(c *C) {
+	binder := &HttpInputBinder{}
+	binder.AddBinding(NewTestBinding(c, "/teams/{team:Arg0}/members", []string{"POST"}, &TestTeamService{}, "AddMember"))
+	binder.AddBinding(NewTestBinding(c, "/count", nil, &TestTeamService{}, "Count"))
+
+	binder.AddBinding(NewTestBinding(c, "/teams/{team:Arg0}/members/{user:Arg1}", []string{"DELETE"}, &TestTeamService{}, "RemoveMember"))
+
+	// query parameters can be bound to any of the parameters
+	newRequest := func() *http.Request {
+		return httptest.NewRequest("POST", "/teams/abc/members?name=ignored&Arg1.Id=7", bytes.NewBufferString(`["", {"Name": "Bob"}]`))
+	}
+	operation, err := binder.ExtractInput(newRequest())
+	c.Assert(err, IsNil)
+	c.Assert(operation.Params[1].Interface(), Equals, "abc")
+	c.Assert(*operation.Params[2].Interface().(*User), Equals, User{Id: "7", Name: "Bob"})
+
+	recorder := httptest.NewRecorder()
+	binder.ServeHTTP(recorder, newRequest())
+	c.Assert(recorder.Code, Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), Equals, "[6,null]\n")
+
+	recorder = httptest.NewRecorder()
+	binder.ServeHTTP(recorder, httptest.NewRequest("GET", "/count", nil))
+	c.Assert(recorder.Body.String(), Equals, "3\n")
+
+	// operations that only return errors have no content
+	recorder = httptest.NewRecorder()
+	binder.ServeHTTP(recorder, httptest.NewRequest("DELETE", "/teams/abc/members/u1", nil))
+	c.Assert(recorder.Code, Equals, http.StatusNoContent)
+	c.Assert(recorder.Body.String(), Equals, "")
+}
+
+func (s *TestSuite) TestConcurrentRequests(c *C) {
+	binder := &HttpInputBinder{}
+	binder.Bindings = []*HttpBinding{NewTestBinding(c, "/users/{id:Request.UserId}", []string{"GET"}, &TestUserService{}, "GetUser")}
+
+	// requests are served while bindings are added
+	var wait sync.WaitGroup
+	codes := make([]int, 20)
+	for index := range codes {
+		wait.Add(1)
+		go func(index int) {
+			defer wait.Done()
+			if index%2 == 0 {
+				binder.AddBinding(NewTestBinding(c, fmt.Sprintf("/teams/%d", index), nil, &TestTeamService{}, "Count"))
+			}
+			recorder := httptest.NewRecorder()
+			binder.ServeHTTP(recorder, httptest.NewRequest("GET", fmt.Sprintf("/users/u%d", index), nil))
+			codes[index] = recorder.Code
+		}(index)
+	}
+	wait.Wait()
+	for _, code := range codes {
+		c.Assert(code, Equals, http.StatusOK)
+	}
+
+	recorder := httptest.NewRecorder()
+	binder.ServeHTTP(recorder, httptest.NewRequest("GET", "/teams/10", nil))
+	c.Assert(recorder.Body.String(), Equals, "3\n")
+}
@@ -0,0 +1,333 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/panyam/bridge"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+ * An argument of a service operation that is sent as part of a request.
+ */
+type OpArg struct {
+	// Name of the argument in the generated method
+	Name string
+	Type *bridge.Type
+}
+
+/**
+ * A query parameter sent in a request along with the expression (in the
+ * generated method) for its value.
+ */
+type QueryParam struct {
+	Name   string
+	Expr   string
+	IsList bool
+}
+
+/**
+ * Methods that do not send a request body.
+ */
+var bodilessMethods = map[string]bool{"GET": true, "HEAD": true, "DELETE": true, "OPTIONS": true}
+
+/**
+ * Names used by the generated methods (locals and imported packages) that
+ * arguments cannot be named as.
+ */
+var reservedArgNames = map[string]bool{
+	"svc": true, "resp": true, "trans_error": true, "body": true, "buffer": true,
+	"requestUrl": true, "query": true, "value": true, "httpreq": true, "reader": true, "err": true,
+	"http": true, "url": true, "bytes": true, "bufio": true, "fmt": true, "io": true, "strings": true,
+	"errors": true,
+}
+
+/**
+ * Returns the names used in the generated code (the client package, locals
+ * and imported packages) in sorted order.  Packages of the types in the
+ * generated code cannot be imported as any of these.
+ */
+func ReservedNames(clientPackageName string) []string {
+	var out []string
+	for name := range reservedArgNames {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return append([]string{clientPackageName}, out...)
+}
+
+/**
+ * Returns the name of an argument of the current operation in the
+ * generated methods.  This is the name of the parameter in the service
+ * unless it is unnamed or clashes with names used in the generated code in
+ * which case it is arg<index>.
+ */
+func (g *Generator) OpArgName(index int) string {
+	name := g.OpType.InputName(index)
+	if name == "" || name == "_" || reservedArgNames[name] || strings.HasPrefix(name, "outarg") || g.isPackageName(name) {
+		return fmt.Sprintf("arg%d", index)
+	}
+	return name
+}
+
+/**
+ * Tells if a name is the (short) name of a package referred to by the
+ * types of the current operation.
+ */
+func (g *Generator) isPackageName(name string) bool {
+	for _, types := range [][]*bridge.Type{g.OpType.InputTypes, g.OpType.OutputTypes} {
+		for _, t := range types {
+			if strings.Contains(g.TypeName(t), name+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/**
+ * Returns the parameter list of the generated methods for the current
+ * operation, eg "id string, tags ...string".
+ */
+func (g *Generator) OpParams() string {
+	var params []string
+	numInputs := g.OpType.NumInputs()
+	for index, argType := range g.OpType.InputTypes {
+		if index == numInputs-1 && g.OpType.IsVariadic {
+			params = append(params, g.OpArgName(index)+" ..."+g.TypeName(argType.AsListType().TargetType))
+		} else {
+			params = append(params, g.OpArgName(index)+" "+g.TypeName(argType))
+		}
+	}
+	return strings.Join(params, ", ")
+}
+
+/**
+ * Returns the arguments to pass on the parameters of the current operation
+ * to another generated method, eg "id, tags...".
+ */
+func (g *Generator) OpArgs() string {
+	var args []string
+	for index := range g.OpType.InputTypes {
+		args = append(args, g.OpArgName(index))
+	}
+	if len(args) > 0 && g.OpType.IsVariadic {
+		args[len(args)-1] += "..."
+	}
+	return strings.Join(args, ", ")
+}
+
+/**
+ * Returns the binding for the current operation.  Operations without a
+ * binding are sent as a POST to /<OpName>.
+ */
+func (g *Generator) OpBinding() *HttpBinding {
+	if binding, ok := g.Bindings[g.OpName]; ok && binding != nil {
+		return binding
+	}
+	return &HttpBinding{Url: "/" + g.OpName, Methods: []string{"POST"}, Operation: g.OpName}
+}
+
+/**
+ * Tells if the arguments of the current operation are sent in the body.
+ */
+func (g *Generator) OpHasBody() bool {
+	return !bodilessMethods[g.OpMethod] && len(g.OpRequestArgs()) > 0
+}
+
+/**
+ * Returns the arguments of the current operation that make up the request
+ * (ie all arguments except a leading context).
+ */
+func (g *Generator) OpRequestArgs() []*OpArg {
+	var out []*OpArg
+	for index, argType := range g.OpType.InputTypes {
+		if index == 0 && isContextType(argType) {
+			continue
+		}
+		out = append(out, &OpArg{Name: g.OpArgName(index), Type: argType})
+	}
+	return out
+}
+
+func isContextType(t *bridge.Type) bool {
+	leafType := t.LeafType()
+	return t.IsNamedType() && leafType.Package == "context" && leafType.Name == "Context"
+}
+
+/**
+ * Returns the expression for the path of the current operation with the
+ * path variables substituted from the arguments, eg:
+ *
+ * 	"/users/" + url.PathEscape(fmt.Sprint(arg0.UserId)) + "/posts"
+ */
+func (g *Generator) OpPathExpr() (string, error) {
+	binding := g.OpBinding()
+	segments, err := ParseUrlTemplate(binding.Url)
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	literal := ""
+	for _, segment := range segments {
+		literal += "/"
+		if !segment.IsVariable && !segment.IsWildcard {
+			literal += segment.Name
+			continue
+		}
+		expr, _, err := g.KeyExpr(varKey(binding, segment))
+		if err != nil {
+			return "", fmt.Errorf("Path variable '%s' of operation %s: %s", segment.Name, g.OpName, err)
+		}
+		parts = append(parts, strconv.Quote(literal))
+		literal = ""
+		if segment.IsWildcard {
+			parts = append(parts, "fmt.Sprint("+expr+")")
+		} else {
+			parts = append(parts, "url.PathEscape(fmt.Sprint("+expr+"))")
+		}
+	}
+	if strings.HasSuffix(binding.Url, "/") || len(segments) == 0 {
+		literal += "/"
+	}
+	if literal != "" {
+		parts = append(parts, strconv.Quote(literal))
+	}
+	return strings.Join(parts, " + "), nil
+}
+
+/**
+ * Returns the key a path variable maps to.
+ */
+func varKey(binding *HttpBinding, segment *UrlSegment) string {
+	if segment.Mapping != "" {
+		return segment.Mapping
+	}
+	if keys := binding.VarMappings[segment.Name]; len(keys) > 0 {
+		return keys[0]
+	}
+	return segment.Name
+}
+
+/**
+ * Returns the query parameters sent for the current operation.  These are
+ * the parameters in the ParamMappings of the binding and, for methods that
+ * do not send a body, the top level fields (of basic types) of the request
+ * that are not already mapped.
+ */
+func (g *Generator) OpQueryParams() ([]*QueryParam, error) {
+	binding := g.OpBinding()
+	var out []*QueryParam
+	mapped := make(map[string]bool)
+	for _, name := range sortedKeys(binding.ParamMappings) {
+		keys := binding.ParamMappings[name]
+		if len(keys) == 0 {
+			continue
+		}
+		expr, fieldType, err := g.KeyExpr(keys[0])
+		if err != nil {
+			return nil, fmt.Errorf("Param '%s' of operation %s: %s", name, g.OpName, err)
+		}
+		for _, key := range keys {
+			mapped[key] = true
+		}
+		out = append(out, &QueryParam{Name: name, Expr: expr, IsList: fieldType.IsListType()})
+	}
+	segments, err := ParseUrlTemplate(binding.Url)
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		if segment.IsVariable || segment.IsWildcard {
+			mapped[varKey(binding, segment)] = true
+		}
+	}
+
+	args := g.OpRequestArgs()
+	if bodilessMethods[g.OpMethod] && len(args) > 0 {
+		if record := recordTypeOf(args[0].Type); record != nil {
+			for _, field := range record.Fields {
+				if field.Name == "" || mapped["Request."+field.Name] || mapped[field.Name] ||
+					!isQueryType(field.Type) {
+					continue
+				}
+				out = append(out, &QueryParam{Name: field.Name, Expr: args[0].Name + "." + field.Name, IsList: field.Type.IsListType()})
+			}
+		}
+	}
+	return out, nil
+}
+
+/**
+ * Tells if values of a type can be sent as query parameters.
+ */
+func isQueryType(t *bridge.Type) bool {
+	if t.IsListType() {
+		t = t.AsListType().TargetType
+	}
+	return t.IsNamedType() && t.AsNamedType().Package == ""
+}
+
+/**
+ * Returns the expression (and type) in the generated method for a key
+ * (eg Request.Field1.ChildField or Arg1.Field) in a mapping.  Fields are
+ * matched by name and then by name ignoring case.
+ */
+func (g *Generator) KeyExpr(key string) (string, *bridge.Type, error) {
+	args := g.OpRequestArgs()
+	parts := strings.Split(key, ".")
+	argIndex := 0
+	if parts[0] == "Request" {
+		parts = parts[1:]
+	} else if strings.HasPrefix(parts[0], "Arg") {
+		if index, err := strconv.Atoi(parts[0][3:]); err == nil {
+			argIndex = index
+			parts = parts[1:]
+		}
+	}
+	if argIndex >= len(args) {
+		return "", nil, fmt.Errorf("Operation has only %d arguments", len(args))
+	}
+	expr, currType := args[argIndex].Name, args[argIndex].Type
+	for _, part := range parts {
+		record := recordTypeOf(currType)
+		if record == nil {
+			return "", nil, fmt.Errorf("'%s' is not a record", expr)
+		}
+		var found *bridge.Field
+		for _, field := range record.Fields {
+			if field.Name == part {
+				found = field
+				break
+			} else if found == nil && strings.EqualFold(field.Name, part) {
+				found = field
+			}
+		}
+		if found == nil {
+			return "", nil, fmt.Errorf("No field '%s' in %s", part, record.Name)
+		}
+		expr += "." + found.Name
+		currType = found.Type
+	}
+	return expr, currType, nil
+}
+
+/**
+ * Returns the record a type refers to (via references and aliases).
+ */
+func recordTypeOf(t *bridge.Type) *bridge.RecordTypeData {
+	for t != nil {
+		switch typeData := t.TypeData.(type) {
+		case *bridge.RecordTypeData:
+			return typeData
+		case *bridge.ReferenceTypeData:
+			t = typeData.TargetType
+		case *bridge.AliasTypeData:
+			t = typeData.TargetType
+		default:
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package rest
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Error raised when a parameter could not be bound to a field in the request.
+ */
+type FieldError struct {
+	// Name of the query/form parameter or path variable
+	Param string
+
+	// The key (eg Request.Field1.ChildField) the parameter was mapped to
+	Key string
+
+	// The value that could not be bound
+	Value string
+
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("Invalid value '%s' for '%s' (%s): %s", e.Value, e.Param, e.Key, e.Err)
+}
+
+/**
+ * All the errors encountered while binding parameters to a request.
+ */
+type BindingErrors []*FieldError
+
+func (errs BindingErrors) Error() string {
+	messages := make([]string, len(errs))
+	for index, err := range errs {
+		messages[index] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+/**
+ * Sets the values of a parameter into the field referred to by a key within
+ * the request.  Keys are dotted paths starting at the request, eg:
+ *
+ * 	Request.Field1.ChildField
+ *
+ * (the leading "Request." is optional and an empty key refers to the request
+ * itself).  Fields are looked up by their name, then by their json name and
+ * then by their name ignoring case.  Nil pointers along the path are
+ * allocated.  Slice fields receive all the values, other fields only get the
+ * first value.
+ */
+func BindField(request reflect.Value, key string, values []string) error {
+	var parts []string
+	if key != "" {
+		parts = strings.Split(key, ".")
+	}
+	if len(parts) > 0 && parts[0] == "Request" {
+		parts = parts[1:]
+	}
+	value := request
+	for _, part := range parts {
+		value = indirect(value)
+		if value.Kind() != reflect.Struct {
+			return fmt.Errorf("'%s' is not a struct", value.Type())
+		}
+		field, ok := findField(value.Type(), part)
+		if !ok {
+			return fmt.Errorf("No field '%s' in %s", part, value.Type())
+		}
+		value = value.FieldByIndex(field.Index)
+	}
+	return setValues(value, values)
+}
+
+/**
+ * Tells if a key refers to an existing field within a type.
+ */
+func HasField(requestType reflect.Type, key string) bool {
+	parts := strings.Split(key, ".")
+	if parts[0] == "Request" {
+		parts = parts[1:]
+	}
+	for _, part := range parts {
+		for requestType.Kind() == reflect.Ptr {
+			requestType = requestType.Elem()
+		}
+		if requestType.Kind() != reflect.Struct {
+			return false
+		}
+		field, ok := findField(requestType, part)
+		if !ok {
+			return false
+		}
+		requestType = field.Type
+	}
+	return true
+}
+
+func findField(structType reflect.Type, name string) (reflect.StructField, bool) {
+	if field, ok := structType.FieldByName(name); ok && field.PkgPath == "" {
+		return field, true
+	}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath == "" && jsonName == name {
+			return field, true
+		}
+	}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.PkgPath == "" && strings.EqualFold(field.Name, name) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+/**
+ * Follows (and allocates if required) pointers till a non pointer value.
+ */
+func indirect(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		value = value.Elem()
+	}
+	return value
+}
+
+func setValues(value reflect.Value, values []string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	if value.Kind() == reflect.Slice && !value.Type().Implements(textUnmarshalerType) &&
+		!reflect.PtrTo(value.Type()).Implements(textUnmarshalerType) {
+		out := reflect.MakeSlice(value.Type(), len(values), len(values))
+		for index, str := range values {
+			if err := setValue(out.Index(index), str); err != nil {
+				return err
+			}
+		}
+		value.Set(out)
+		return nil
+	}
+	return setValue(value, values[0])
+}
+
+/**
+ * Converts a string into the type of the value and sets it.
+ */
+func setValue(value reflect.Value, str string) error {
+	if value.CanAddr() && value.Addr().Type().Implements(textUnmarshalerType) {
+		return value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(str))
+	}
+	switch value.Kind() {
+	case reflect.Ptr:
+		return setValue(indirect(value), str)
+	case reflect.String:
+		value.SetString(str)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(str, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(str, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(str, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	default:
+		return fmt.Errorf("Cannot convert to %s", value.Type())
+	}
+	return nil
+}
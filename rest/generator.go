@@ -6,19 +6,24 @@ import (
 	"fmt"
 	"github.com/panyam/bridge"
 	"io"
-	"log"
-	"text/template"
+	"io/fs"
+	"strings"
 )
 
 /**
  * Responsible for generating the code for the client classes.
  */
 type Generator struct {
-	// where the templates are
-	Bindings     map[string]*HttpBinding
-	TypeLib      bridge.ITypeLibrary
+	Bindings map[string]*HttpBinding
+	TypeLib  bridge.ITypeLibrary
+
+	// Folder with templates overriding the default templates (if any)
 	TemplatesDir string
 
+	// The templates used for generating code
+	Templates fs.FS
+	registry  *bridge.TemplateRegistry
+
 	// Parameters to determine Generated output
 	Package           string
 	ClientPackageName string
@@ -61,6 +66,36 @@ func (g *Generator) ServiceTypeData() *bridge.RecordTypeData {
 	return g.ServiceType.TypeData.(*bridge.RecordTypeData)
 }
 
+/**
+ * Returns the doc comment of the service for the client class.
+ */
+func (g *Generator) ServiceComment() string {
+	return DocComment(g.ServiceTypeData().Doc)
+}
+
+/**
+ * Returns the doc comment of the current operation for its client method.
+ */
+func (g *Generator) OpComment() string {
+	return DocComment(g.OpType.Doc)
+}
+
+/**
+ * Returns a doc comment as // comments (ending with a new line) to be put
+ * before a generated declaration.
+ */
+func DocComment(doc string) string {
+	doc = strings.TrimSpace(doc)
+	if doc == "" {
+		return ""
+	}
+	out := ""
+	for _, line := range strings.Split(doc, "\n") {
+		out += strings.TrimRight("// "+line, " ") + "\n"
+	}
+	return out
+}
+
 func NewGenerator(bindings map[string]*HttpBinding, typeLib bridge.ITypeLibrary, templatesDir string) *Generator {
 	if bindings == nil {
 		bindings = make(map[string]*HttpBinding)
@@ -68,6 +103,7 @@ func NewGenerator(bindings map[string]*HttpBinding, typeLib bridge.ITypeLibrary,
 	out := Generator{Bindings: bindings,
 		TypeLib:           typeLib,
 		TemplatesDir:      templatesDir,
+		Templates:         NewTemplatesFS(templatesDir),
 		ClientPackageName: "restclient",
 		ClientSuffix:      "Client",
 		TransportRequest:  "*http.Request",
@@ -75,40 +111,126 @@ func NewGenerator(bindings map[string]*HttpBinding, typeLib bridge.ITypeLibrary,
 	return &out
 }
 
-func (g *Generator) IOMethodForType(t *bridge.Type) string {
-	switch typeData := t.TypeData.(type) {
-	case string:
-		return typeData
-	case *bridge.NamedTypeData:
-		if typeData.Package == "" {
-			return typeData.Name
-		} else {
-			return g.TypeLib.ShortNameForPackage(typeData.Package) + "_" + typeData.Name
-		}
-	case *bridge.AliasTypeData:
-		return g.IOMethodForType(typeData.TargetType)
-	case *bridge.ReferenceTypeData:
-		return "Ref_" + g.IOMethodForType(typeData.TargetType)
-	case *bridge.FunctionTypeData:
-		panic(errors.New("Function types cannot be serialized"))
-	case *bridge.TupleTypeData:
-		panic(errors.New("Warning: Tuple types not supported in GO"))
-		return "Tuple"
-	case *bridge.RecordTypeData:
-		if typeData.Name == "" {
-			return "interface"
-		}
-		if typeData.Package == "" {
-			return typeData.Name
+/**
+ * Returns the name of a type in the generated (Go) code, where packages are
+ * referred to by their short names.
+ */
+func (g *Generator) TypeName(t *bridge.Type) string {
+	return g.TypeLib.TypeString(t, g.packageName)
+}
+
+/**
+ * Returns the name a package is imported as in the generated code.
+ */
+func (g *Generator) packageName(pkg string) string {
+	if shortName := g.TypeLib.ShortNameForPackage(pkg); shortName != "" {
+		return shortName
+	}
+	return bridge.ImportName(pkg)
+}
+
+/**
+ * Returns the suffix of the Write_/Read_ methods for a type.
+ */
+func (g *Generator) IOMethodForType(t *bridge.Type) (string, error) {
+	// names of the types left so far and where the names of the children
+	// of each composite type being visited start
+	var names []string
+	var starts []int
+	var err error
+	fail := func(walker *bridge.TypeWalker, failure error) bool {
+		err = failure
+		walker.Stop()
+		return false
+	}
+	named := func(t *bridge.Type, walker *bridge.TypeWalker) bool {
+		leafType := t.LeafType()
+		if leafType.Name == "" {
+			names = append(names, "interface")
+		} else if leafType.Package == "" {
+			names = append(names, leafType.Name)
 		} else {
-			return g.TypeLib.ShortNameForPackage(typeData.Package) + "_" + typeData.Name
+			names = append(names, g.TypeLib.ShortNameForPackage(leafType.Package)+"_"+leafType.Name)
 		}
-	case *bridge.MapTypeData:
-		return "Map_" + g.IOMethodForType(typeData.KeyType) + "_" + g.IOMethodForType(typeData.ValueType)
-	case *bridge.ListTypeData:
-		return "List_" + g.IOMethodForType(typeData.TargetType)
+		return false
+	}
+	composite := func(t *bridge.Type, walker *bridge.TypeWalker) bool {
+		starts = append(starts, len(names))
+		return true
+	}
+	children := func() []string {
+		start := starts[len(starts)-1]
+		starts = starts[:len(starts)-1]
+		out := append([]string(nil), names[start:]...)
+		names = names[:start]
+		return out
+	}
+	walker := bridge.NewTypeWalker()
+	walker.Revisit = true
+	walker.Walk(t, &bridge.TypeHooks{
+		Enter: map[int]func(*bridge.Type, *bridge.TypeWalker) bool{
+			bridge.NamedType:      named,
+			bridge.UnresolvedType: named,
+			bridge.RecordType:     named,
+			bridge.AliasType: func(t *bridge.Type, walker *bridge.TypeWalker) bool {
+				if t.AsAliasType().IsAlias {
+					return composite(t, walker)
+				}
+				return named(t, walker)
+			},
+			bridge.ReferenceType: composite,
+			bridge.MapType:       composite,
+			bridge.ListType:      composite,
+			bridge.InstanceType:  composite,
+			bridge.FunctionType: func(t *bridge.Type, walker *bridge.TypeWalker) bool {
+				return fail(walker, errors.New("Function types cannot be serialized"))
+			},
+			bridge.TupleType: func(t *bridge.Type, walker *bridge.TypeWalker) bool {
+				return fail(walker, errors.New("Tuple types not supported in GO"))
+			},
+			bridge.ChannelType: func(t *bridge.Type, walker *bridge.TypeWalker) bool {
+				return fail(walker, errors.New("Channel types cannot be serialized"))
+			},
+			bridge.TypeParamType: func(t *bridge.Type, walker *bridge.TypeWalker) bool {
+				return fail(walker, fmt.Errorf("Type parameter %s must be instantiated to be serialized", t.AsTypeParamType().Name))
+			},
+			bridge.UnionType: func(t *bridge.Type, walker *bridge.TypeWalker) bool {
+				return fail(walker, errors.New("Union types can only be used as constraints"))
+			},
+		},
+		EnterAny: func(t *bridge.Type, walker *bridge.TypeWalker) bool {
+			return fail(walker, fmt.Errorf("No reader/writer for type class %s", t.TypeClassString()))
+		},
+		Leave: map[int]func(*bridge.Type, *bridge.TypeWalker){
+			bridge.AliasType: func(t *bridge.Type, walker *bridge.TypeWalker) {
+				if t.AsAliasType().IsAlias {
+					names = append(names, children()[0])
+				}
+			},
+			bridge.ReferenceType: func(t *bridge.Type, walker *bridge.TypeWalker) {
+				names = append(names, "Ref_"+children()[0])
+			},
+			bridge.MapType: func(t *bridge.Type, walker *bridge.TypeWalker) {
+				kv := children()
+				names = append(names, "Map_"+kv[0]+"_"+kv[1])
+			},
+			bridge.ListType: func(t *bridge.Type, walker *bridge.TypeWalker) {
+				listData := t.AsListType()
+				if listData.IsArray {
+					names = append(names, fmt.Sprintf("Array%d_", listData.Length)+children()[0])
+				} else {
+					names = append(names, "List_"+children()[0])
+				}
+			},
+			bridge.InstanceType: func(t *bridge.Type, walker *bridge.TypeWalker) {
+				names = append(names, strings.Join(children(), "_"))
+			},
+		},
+	})
+	if err != nil {
+		return "", err
 	}
-	return fmt.Sprintf("UnknownWriter, Type: %d", t.TypeClass)
+	return names[0], nil
 }
 
 /**
@@ -123,15 +245,19 @@ func (g *Generator) EmitClientClass(writer io.Writer, serviceType *bridge.Type)
 	g.ServiceType = serviceType
 	g.ServiceName = serviceTypeData.Name
 
-	tmpl, err := template.New("client.gen").ParseFiles(g.TemplatesDir + "client.gen")
-	if err != nil {
-		panic(err)
-	}
-	err = tmpl.Execute(writer, g)
-	if err != nil {
-		panic(err)
+	return g.RenderTemplate(writer, "client.gen", g)
+}
+
+/**
+ * Renders a template (by name) from the templates of the generator.  The
+ * templates are parsed once on first use so Templates must not be changed
+ * after generation has started.
+ */
+func (g *Generator) RenderTemplate(writer io.Writer, name string, context interface{}) error {
+	if g.registry == nil {
+		g.registry = bridge.NewTemplateRegistry(g.Templates, nil)
 	}
-	return err
+	return g.registry.Render(writer, name, context)
 }
 
 /**
@@ -144,20 +270,33 @@ func (g *Generator) EmitClientClass(writer io.Writer, serviceType *bridge.Type)
 func (g *Generator) EmitServiceCallMethod(writer io.Writer, opName string, opType *bridge.FunctionTypeData, argPrefix string) error {
 	g.OpName = opName
 	g.OpType = opType
-	g.OpMethod = "GET"
-	g.OpEndpoint = "http://hello.world/"
-	return bridge.RenderTemplate(writer, g.TemplatesDir+"/callmethod.gen", g)
+	binding := g.OpBinding()
+	g.OpMethod = "POST"
+	if len(binding.Methods) > 0 {
+		g.OpMethod = binding.Methods[0]
+	}
+	g.OpEndpoint = binding.Url
+	return g.RenderTemplate(writer, "callmethod.gen", g)
 }
 
 /**
  * Emits the writer for a particular type.
  */
 func (g *Generator) EmitTypeWriter(writer io.Writer, argType *bridge.Type) error {
+	if aliasType, ok := argType.TypeData.(*bridge.AliasTypeData); ok && aliasType.IsAlias {
+		// aliases are identical to their targets so share their writers
+		return g.EmitTypeWriter(writer, aliasType.TargetType)
+	}
+
 	// write the function header for the type
-	g.EmitTypeWriterHeader(writer, argType)
+	if err := g.EmitTypeWriterHeader(writer, argType); err != nil {
+		return err
+	}
 
 	// write the function body for the type
-	g.EmitTypeWriterBody(writer, argType)
+	if err := g.EmitTypeWriterBody(writer, argType); err != nil {
+		return err
+	}
 
 	// write the footer for the type
 	return g.EmitTypeWriterFooter(writer, argType)
@@ -165,20 +304,21 @@ func (g *Generator) EmitTypeWriter(writer io.Writer, argType *bridge.Type) error
 
 func (g *Generator) EmitTypeWriterHeader(writer io.Writer, argType *bridge.Type) error {
 	context := map[string]interface{}{"Gen": g, "Type": argType}
-	return bridge.RenderTemplate(writer, g.TemplatesDir+"/writer_header.gen", context)
+	return g.RenderTemplate(writer, "writer_header.gen", context)
 }
 
-func (g *Generator) TypeWriterBodyString(argType *bridge.Type) string {
+func (g *Generator) TypeWriterBodyString(argType *bridge.Type) (string, error) {
 	buffer := bytes.NewBuffer(nil)
 	err := g.EmitTypeWriterBody(buffer, argType)
-	if err != nil {
-		buffer = bytes.NewBuffer(nil)
-		buffer.Write([]byte(err.Error()))
-	}
-	return string(buffer.Bytes())
+	return buffer.String(), err
 }
 
 func (g *Generator) EmitTypeWriterBody(writer io.Writer, argType *bridge.Type) error {
+	if argType.TypeClass == bridge.InstanceType {
+		// instances are written as their generic type with the type
+		// arguments filled in
+		argType = argType.Expand()
+	}
 	context := map[string]interface{}{"Gen": g, "Type": argType}
 	tmplType := ""
 	switch argType.TypeClass {
@@ -197,24 +337,29 @@ func (g *Generator) EmitTypeWriterBody(writer io.Writer, argType *bridge.Type) e
 		return nil
 	}
 	if tmplType == "" {
-		log.Println("Unknown type: ", argType)
-		panic(nil)
+		return fmt.Errorf("Cannot write values of type class %s", argType.TypeClassString())
 	}
-	tmplPath := fmt.Sprintf("%s/writer_%s.gen", g.TemplatesDir, tmplType)
-	return bridge.RenderTemplate(writer, tmplPath, context)
+	return g.RenderTemplate(writer, "writer_"+tmplType+".gen", context)
 }
 
 func (g *Generator) EmitTypeWriterFooter(writer io.Writer, argType *bridge.Type) error {
 	context := map[string]interface{}{"Gen": g, "Type": argType}
-	return bridge.RenderTemplate(writer, g.TemplatesDir+"/writer_footer.gen", context)
+	return g.RenderTemplate(writer, "writer_footer.gen", context)
 }
 
 /**
  * Emits the reader for a particular type.
  */
 func (g *Generator) EmitTypeReader(writer io.Writer, argType *bridge.Type) error {
+	if aliasType, ok := argType.TypeData.(*bridge.AliasTypeData); ok && aliasType.IsAlias {
+		return g.EmitTypeReader(writer, aliasType.TargetType)
+	}
+	bodyType := argType
+	if argType.TypeClass == bridge.InstanceType {
+		bodyType = argType.Expand()
+	}
 	tmplType := ""
-	switch argType.TypeClass {
+	switch bodyType.TypeClass {
 	case bridge.ListType:
 		tmplType = "list"
 	case bridge.MapType:
@@ -230,14 +375,17 @@ func (g *Generator) EmitTypeReader(writer io.Writer, argType *bridge.Type) error
 		return nil
 	}
 	if tmplType == "" {
-		log.Println("Unknown type: ", argType)
-		panic(nil)
+		return fmt.Errorf("Cannot read values of type class %s", bodyType.TypeClassString())
 	}
-	tmplPath := fmt.Sprintf("%s/reader_%s.gen", g.TemplatesDir, tmplType)
 	context := map[string]interface{}{"Gen": g, "Type": argType}
-	bridge.RenderTemplate(writer, g.TemplatesDir+"/reader_header.gen", context)
-	bridge.RenderTemplate(writer, tmplPath, context)
-	return bridge.RenderTemplate(writer, g.TemplatesDir+"/reader_footer.gen", context)
+	if err := g.RenderTemplate(writer, "reader_header.gen", context); err != nil {
+		return err
+	}
+	bodyContext := map[string]interface{}{"Gen": g, "Type": bodyType}
+	if err := g.RenderTemplate(writer, "reader_"+tmplType+".gen", bodyContext); err != nil {
+		return err
+	}
+	return g.RenderTemplate(writer, "reader_footer.gen", context)
 }
 
 /**
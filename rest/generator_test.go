@@ -0,0 +1,199 @@
+package rest
+
+import (
+	"bytes"
+	"github.com/panyam/bridge"
+	. "gopkg.in/check.v1"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func newTestOp(typeLib *bridge.TypeLibrary) *bridge.FunctionTypeData {
+	stringType := typeLib.AddGlobalType("string")
+	intType := typeLib.AddGlobalType("int")
+	filterType := bridge.NewType(bridge.RecordType, &bridge.RecordTypeData{
+		NamedTypeData: bridge.NamedTypeData{Name: "Filter", Package: "core"},
+		Fields:        []*bridge.Field{&bridge.Field{Name: "Tags", Type: bridge.NewType(bridge.ListType, &bridge.ListTypeData{TargetType: stringType})}},
+	})
+	requestType := bridge.NewType(bridge.RecordType, &bridge.RecordTypeData{
+		NamedTypeData: bridge.NamedTypeData{Name: "ListPostsRequest", Package: "core"},
+		Fields: []*bridge.Field{
+			&bridge.Field{Name: "UserId", Type: stringType},
+			&bridge.Field{Name: "Limit", Type: intType},
+			&bridge.Field{Name: "Filter", Type: bridge.NewType(bridge.ReferenceType, &bridge.ReferenceTypeData{TargetType: filterType})},
+		},
+	})
+	return &bridge.FunctionTypeData{InputTypes: []*bridge.Type{
+		bridge.NewType(bridge.NamedType, &bridge.NamedTypeData{Name: "Context", Package: "context"}),
+		bridge.NewType(bridge.ReferenceType, &bridge.ReferenceTypeData{TargetType: requestType}),
+	}}
+}
+
+func (s *TestSuite) TestOpEndpoint(c *C) {
+	typeLib := bridge.NewTypeLibrary()
+	binding := &HttpBinding{Url: "/users/{id:Request.UserId}/posts/", Methods: []string{"GET"},
+		ParamMappings: map[string][]string{"tag": []string{"Request.Filter.Tags"}}}
+	g := NewGenerator(map[string]*HttpBinding{"ListPosts": binding}, typeLib, "")
+	g.OpName = "ListPosts"
+	g.OpType = newTestOp(typeLib)
+	g.OpMethod = "GET"
+
+	c.Assert(len(g.OpRequestArgs()), Equals, 1)
+	c.Assert(g.OpHasBody(), Equals, false)
+
+	path, err := g.OpPathExpr()
+	c.Assert(err, IsNil)
+	c.Assert(path, Equals, `"/users/" + url.PathEscape(fmt.Sprint(arg1.UserId)) + "/posts/"`)
+
+	params, err := g.OpQueryParams()
+	c.Assert(err, IsNil)
+	c.Assert(len(params), Equals, 2)
+	c.Assert(*params[0], Equals, QueryParam{Name: "tag", Expr: "arg1.Filter.Tags", IsList: true})
+	c.Assert(*params[1], Equals, QueryParam{Name: "Limit", Expr: "arg1.Limit"})
+
+	_, _, err = g.KeyExpr("Request.Missing")
+	c.Assert(err, ErrorMatches, "No field 'Missing' in ListPostsRequest")
+}
+
+func (s *TestSuite) TestDefaultOpBinding(c *C) {
+	g := NewGenerator(nil, bridge.NewTypeLibrary(), "")
+	g.OpName = "CreateTeam"
+	binding := g.OpBinding()
+	c.Assert(binding.Url, Equals, "/CreateTeam")
+	c.Assert(binding.Methods, DeepEquals, []string{"POST"})
+}
+
+func (s *TestSuite) TestTemplateOverrides(c *C) {
+	overrideDir := c.MkDir()
+	err := os.WriteFile(filepath.Join(overrideDir, "writer_footer.gen"), []byte("} // {{.Type.TypeClassString}}\n"), 0644)
+	c.Assert(err, IsNil)
+
+	g := NewGenerator(nil, bridge.NewTypeLibrary(), overrideDir)
+	buffer := bytes.NewBuffer(nil)
+	context := map[string]interface{}{"Gen": g, "Type": bridge.NewType(bridge.ListType, nil)}
+	c.Assert(g.RenderTemplate(buffer, "writer_footer.gen", context), IsNil)
+	c.Assert(buffer.String(), Equals, "} // ListType\n")
+
+	// templates not overridden come from the defaults
+	buffer.Reset()
+	c.Assert(g.RenderTemplate(buffer, "reader_footer.gen", context), IsNil)
+	c.Assert(buffer.String(), Equals, "}\n")
+
+	_, err = fs.Stat(NewTemplatesFS(""), "callmethod.gen")
+	c.Assert(err, IsNil)
+}
+
+func (s *TestSuite) TestInstanceReadersAndWriters(c *C) {
+	typeLib := bridge.NewTypeLibrary()
+	typeLib.AddPackage("example.com/core")
+	stringType := typeLib.AddGlobalType("string")
+	param := bridge.NewType(bridge.TypeParamType, &bridge.TypeParamData{Name: "T", Constraint: typeLib.AddGlobalType("any")})
+	page := bridge.NewType(bridge.RecordType, &bridge.RecordTypeData{
+		NamedTypeData: bridge.NamedTypeData{Name: "Page", Package: "example.com/core"},
+		Fields:        []*bridge.Field{&bridge.Field{Name: "Items", Type: bridge.NewType(bridge.ListType, &bridge.ListTypeData{TargetType: param})}},
+		TypeParams:    []*bridge.Type{param},
+	})
+	instance := bridge.NewType(bridge.InstanceType, &bridge.InstanceTypeData{GenericType: page, TypeArgs: []*bridge.Type{stringType}})
+
+	g := NewGenerator(nil, typeLib, "")
+	name, err := g.IOMethodForType(instance)
+	c.Assert(err, IsNil)
+	c.Assert(name, Equals, "core_Page_string")
+	_, err = g.IOMethodForType(param)
+	c.Assert(err, NotNil)
+
+	buffer := bytes.NewBuffer(nil)
+	c.Assert(g.EmitTypeWriter(buffer, instance), IsNil)
+	c.Assert(buffer.String(), Matches, `(?s)func Write_core_Page_string \(writer io.Writer, arg core.Page\[string\]\).*Write_List_string\(writer, arg.Items\).*`)
+	buffer.Reset()
+	c.Assert(g.EmitTypeReader(buffer, instance), IsNil)
+	c.Assert(buffer.String(), Matches, `(?s).*func Read_core_Page_string \(reader \*bufio.Reader, arg \*core.Page\[string\]\).*Read_List_string\(reader, &arg.Items\).*`)
+}
+
+func (s *TestSuite) TestOpArgNames(c *C) {
+	typeLib := bridge.NewTypeLibrary()
+	typeLib.AddPackage("core")
+	g := NewGenerator(nil, typeLib, "")
+	g.OpName = "ListPosts"
+	g.OpType = newTestOp(typeLib)
+	g.OpType.InputTypes = append(g.OpType.InputTypes, bridge.NewType(bridge.ListType, &bridge.ListTypeData{TargetType: typeLib.GetGlobalType("string")}))
+	g.OpType.InputNames = []string{"ctx", "url", "tags"}
+	g.OpType.IsVariadic = true
+
+	// names clashing with the generated code are replaced
+	c.Assert(g.OpParams(), Equals, "ctx context.Context, arg1 *core.ListPostsRequest, tags ...string")
+	c.Assert(g.OpArgs(), Equals, "ctx, arg1, tags...")
+	args := g.OpRequestArgs()
+	c.Assert(len(args), Equals, 2)
+	c.Assert(args[1].Name, Equals, "tags")
+
+	g.OpType.InputNames[1] = "context"
+	c.Assert(g.OpArgName(1), Equals, "arg1")
+	g.OpType.InputNames[1] = "request"
+	c.Assert(g.OpArgName(1), Equals, "request")
+}
+
+func (s *TestSuite) TestJsonFields(c *C) {
+	typeLib := bridge.NewTypeLibrary()
+	typeLib.AddPackage("core")
+	stringType := typeLib.AddGlobalType("string")
+	intType := typeLib.AddGlobalType("int")
+	record := func(name string, fields ...*bridge.Field) *bridge.Type {
+		return bridge.NewType(bridge.RecordType, &bridge.RecordTypeData{NamedTypeData: bridge.NamedTypeData{Name: name, Package: "core"}, Fields: fields})
+	}
+	base := record("Base",
+		&bridge.Field{Name: "Id", Type: stringType, Tag: `json:"id"`},
+		&bridge.Field{Name: "Created", Type: stringType})
+	audit := record("Audit",
+		&bridge.Field{Name: "By", Type: stringType},
+		&bridge.Field{Name: "Note", Type: stringType})
+	meta := record("meta",
+		&bridge.Field{Name: "Version", Type: intType},
+		&bridge.Field{Name: "Note", Type: stringType})
+	extra := record("Extra", &bridge.Field{Name: "Info", Type: stringType})
+	secret := record("secret", &bridge.Field{Name: "Key", Type: stringType})
+	user := record("User",
+		&bridge.Field{Type: base},
+		&bridge.Field{Type: bridge.NewType(bridge.ReferenceType, &bridge.ReferenceTypeData{TargetType: audit})},
+		&bridge.Field{Type: meta},
+		&bridge.Field{Type: extra, Tag: `json:"extra"`},
+		&bridge.Field{Type: bridge.NewType(bridge.ReferenceType, &bridge.ReferenceTypeData{TargetType: secret})},
+		&bridge.Field{Name: "Id", Type: stringType, Tag: `json:"id"`},
+		&bridge.Field{Name: "Age", Type: intType, Tag: `json:"age,omitempty"`},
+		&bridge.Field{Name: "Tags", Type: bridge.NewType(bridge.ListType, &bridge.ListTypeData{TargetType: stringType}), Tag: `json:",omitempty"`},
+		&bridge.Field{Name: "Password", Type: stringType, Tag: `json:"-"`},
+		&bridge.Field{Name: "cache", Type: stringType})
+	g := NewGenerator(nil, typeLib, "")
+	fields := g.JsonFields(user)
+	var names, exprs []string
+	for _, field := range fields {
+		names = append(names, field.Name)
+		exprs = append(exprs, field.Expr)
+	}
+	// fields of embedded structs are promoted (shadowed by shallower fields
+	// and dropped if ambiguous) unless the embedded struct is named by a tag
+	c.Assert(names, DeepEquals, []string{"Created", "By", "Version", "extra", "id", "age", "Tags"})
+	c.Assert(exprs, DeepEquals, []string{"Base.Created", "Audit.By", "Version", "Extra", "Id", "Age", "Tags"})
+	c.Assert(fields[1].WriteIf, Equals, "arg.Audit != nil")
+	c.Assert(fields[1].ReadInit, Matches, `if arg.Audit == nil \{\s*arg.Audit = new\(core.Audit\)\s*\}\s*`)
+	c.Assert(fields[3].Type, Equals, extra)
+	c.Assert(fields[4].WriteIf, Equals, "")
+	c.Assert(fields[5].WriteIf, Equals, "arg.Age != 0")
+	c.Assert(fields[6].WriteIf, Equals, "len(arg.Tags) > 0")
+
+	buffer := bytes.NewBuffer(nil)
+	c.Assert(g.EmitTypeWriter(buffer, user), IsNil)
+	c.Assert(buffer.String(), Matches, `(?s).*Write_string\(writer, "id"\).*if arg.Age != 0 \{.*Write_string\(writer, "age"\).*`)
+	c.Assert(strings.Contains(buffer.String(), "Password"), Equals, false)
+	buffer.Reset()
+	c.Assert(g.EmitTypeReader(buffer, user), IsNil)
+	c.Assert(buffer.String(), Matches, `(?s).*case "id":\s*if err := Read_string\(reader, &arg.Id\).*case "Tags":\s*if err := Read_List_string\(reader, &arg.Tags\).*`)
+	c.Assert(strings.Contains(buffer.String(), "cache"), Equals, false)
+}
+
+func (s *TestSuite) TestDocComment(c *C) {
+	c.Assert(DocComment(""), Equals, "")
+	c.Assert(DocComment("Gets a user.\n\nReturns an error if not found.\n"), Equals, "// Gets a user.\n//\n// Returns an error if not found.\n")
+}
@@ -0,0 +1,201 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/panyam/bridge"
+	"go/ast"
+	"strings"
+)
+
+/**
+ * A field of a record as it is written to (and read from) json.
+ */
+type JsonField struct {
+	// Key of the field in the json object
+	Name string
+
+	// Expression for the field relative to the record (eg UserId or
+	// Base.Id for fields promoted from embedded structs)
+	Expr string
+	Type *bridge.Type
+
+	// Condition (on arg) for writing the field if it is omitted when empty
+	// (eg len(arg.Tags) > 0) or promoted through an embedded pointer (eg
+	// arg.Base != nil), empty if it is always written
+	WriteIf string
+
+	// Statements allocating the embedded pointers the field is promoted
+	// through before it is read, empty if there are none
+	ReadInit string
+
+	// How deep the field is in embedded structs and whether it was named
+	// by its json tag (to pick between fields with the same name)
+	depth  int
+	tagged bool
+}
+
+/**
+ * Returns the fields of a record that are written to json as per their json
+ * tags.  Fields tagged with "-", unexported fields and fields that cannot
+ * be serialized (functions and channels) are skipped.
+ *
+ * As in encoding/json the fields of embedded structs (without a json name)
+ * are promoted into the record and fields with the same name are resolved
+ * in favour of the shallowest (and then the only tagged) one.  Embedded
+ * types that cannot be referred to outside their package are skipped
+ * unless their fields can be promoted.
+ */
+func (g *Generator) JsonFields(t *bridge.Type) []*JsonField {
+	fields := g.jsonFields(t, nil, nil, 0, map[*bridge.Type]bool{})
+	var out []*JsonField
+	for index, field := range fields {
+		dominant := field
+		for _, other := range fields {
+			if other == dominant || other.Name != field.Name {
+				continue
+			}
+			if other.depth < dominant.depth || (other.depth == dominant.depth && other.tagged && !dominant.tagged) {
+				dominant = other
+			} else if other.depth == dominant.depth && other.tagged == dominant.tagged {
+				dominant = nil
+				break
+			}
+		}
+		if dominant == field {
+			out = append(out, fields[index])
+		}
+	}
+	return out
+}
+
+/**
+ * Returns the json fields of a record (and the records embedded in it) in
+ * the order of their fields.  path is the expression of the embedded struct
+ * the record is promoted through and guards the embedded pointers on the
+ * way to it.
+ */
+func (g *Generator) jsonFields(t *bridge.Type, path []string, guards []string, depth int, visited map[*bridge.Type]bool) []*JsonField {
+	if visited[t] {
+		return nil
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	var out []*JsonField
+	for _, field := range t.AsRecordType().Fields {
+		if field.Type.IsFunctionType() || field.Type.IsChannelType() {
+			continue
+		}
+		if field.Name != "" && !ast.IsExported(field.Name) {
+			continue
+		}
+		name, omitEmpty := field.JsonName()
+		if name == "" {
+			continue
+		}
+		tagged := false
+		if value, _ := field.TagValue("json"); strings.Split(value, ",")[0] != "" {
+			tagged = true
+		}
+		goName := field.Name
+		if field.Name == "" {
+			goName = field.Type.LeafType().Name
+			if target, record, isPointer := embeddedStruct(field.Type); record != nil && !tagged {
+				// the fields of embedded structs are promoted (through the
+				// embedded field if it is exported and as is otherwise)
+				embeddedPath := path
+				embeddedGuards := guards
+				if ast.IsExported(goName) {
+					embeddedPath = append(append([]string(nil), path...), goName)
+					if isPointer {
+						embeddedGuards = append(append([]string(nil), guards...), strings.Join(embeddedPath, "."))
+					}
+				} else if isPointer {
+					// cannot be allocated outside its package
+					continue
+				}
+				for _, promoted := range g.jsonFields(record, embeddedPath, embeddedGuards, depth+1, visited) {
+					if isPointer && ast.IsExported(goName) {
+						embeddedExpr := strings.Join(embeddedPath, ".")
+						promoted.ReadInit = fmt.Sprintf("if arg.%s == nil {\n\t\t\t\targ.%s = new(%s)\n\t\t\t}\n\t\t\t", embeddedExpr, embeddedExpr, g.TypeName(target)) + promoted.ReadInit
+						g.MarkType(target)
+					}
+					out = append(out, promoted)
+				}
+				continue
+			}
+			if !ast.IsExported(goName) {
+				continue
+			}
+		}
+		expr := strings.Join(append(append([]string(nil), path...), goName), ".")
+		jsonField := &JsonField{Name: name, Expr: expr, Type: field.Type, depth: depth, tagged: tagged}
+		var conditions []string
+		for _, guard := range guards {
+			conditions = append(conditions, "arg."+guard+" != nil")
+		}
+		if omitEmpty {
+			if check := emptyCheck("arg."+expr, field.Type); check != "" {
+				conditions = append(conditions, check)
+			}
+		}
+		jsonField.WriteIf = strings.Join(conditions, " && ")
+		out = append(out, jsonField)
+	}
+	return out
+}
+
+/**
+ * Returns the type an embedded type refers to, its definition if it is a
+ * struct (nil otherwise or if it is not known) and whether it is embedded
+ * by pointer.
+ */
+func embeddedStruct(t *bridge.Type) (*bridge.Type, *bridge.Type, bool) {
+	target, isPointer := t, false
+	if t.IsReferenceType() {
+		target, isPointer = t.AsReferenceType().TargetType, true
+	}
+	record := target
+	if record.IsInstanceType() {
+		record = record.Expand()
+	}
+	if record.IsRecordType() && !record.AsRecordType().IsInterface {
+		return target, record, isPointer
+	}
+	return target, nil, false
+}
+
+var numericTypes = map[string]bool{
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"float32": true, "float64": true, "byte": true, "rune": true,
+}
+
+/**
+ * Returns the condition for a value (of a type) not being empty as per
+ * omitempty in encoding/json (or "" if values of the type are never
+ * considered empty, eg structs).
+ */
+func emptyCheck(expr string, t *bridge.Type) string {
+	switch typeData := t.TypeData.(type) {
+	case *bridge.ListTypeData, *bridge.MapTypeData:
+		return "len(" + expr + ") > 0"
+	case *bridge.ReferenceTypeData, *bridge.FunctionTypeData, *bridge.ChannelTypeData:
+		return expr + " != nil"
+	case *bridge.AliasTypeData:
+		return emptyCheck(expr, typeData.TargetType)
+	case *bridge.NamedTypeData:
+		if typeData.Package != "" {
+			return ""
+		} else if typeData.Name == "string" {
+			return expr + ` != ""`
+		} else if typeData.Name == "bool" {
+			return expr
+		} else if numericTypes[typeData.Name] {
+			return expr + " != 0"
+		} else if typeData.Name == "error" || typeData.Name == "any" {
+			return expr + " != nil"
+		}
+	}
+	return ""
+}
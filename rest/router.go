@@ -0,0 +1,237 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+/**
+ * A router that matches request paths against url templates of bindings.
+ *
+ * Templates are made up of segments separated by "/".  Each segment is one
+ * of:
+ *
+ * 	literal					Matches the segment exactly
+ * 	{name}					Matches any single segment
+ * 	{name:Request.Field}	Same as above but also maps the variable to a
+ * 							field within the request
+ * 	{name...} or *			Matches the rest of the path (only allowed as
+ * 							the last segment)
+ *
+ * Bindings are stored in a trie keyed by the segments so lookups only depend
+ * on the length of the path and not on the number of bindings.  When more
+ * than one template matches a path, literal segments take precedence over
+ * variables which in turn take precedence over wildcards.
+ */
+type UrlRouter struct {
+	root *routeNode
+}
+
+type routeNode struct {
+	literals map[string]*routeNode
+	variable *routeNode
+	wildcard *routeNode
+
+	// Routes that terminate at this node
+	routes []*route
+}
+
+type route struct {
+	binding *HttpBinding
+
+	// Names of the variables in the order in which they appear in the url
+	varNames []string
+}
+
+/**
+ * A parsed segment of a url template.
+ */
+type UrlSegment struct {
+	// The literal value or the name of the variable
+	Name string
+
+	// The field in the request that the variable maps to (if any)
+	Mapping string
+
+	IsVariable bool
+	IsWildcard bool
+}
+
+func NewUrlRouter() *UrlRouter {
+	return &UrlRouter{root: &routeNode{}}
+}
+
+func splitPath(path string) []string {
+	var out []string
+	for _, part := range strings.Split(path, "/") {
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+/**
+ * Parses a url template into its segments.
+ */
+func ParseUrlTemplate(template string) ([]*UrlSegment, error) {
+	parts := splitPath(template)
+	out := make([]*UrlSegment, 0, len(parts))
+	for index, part := range parts {
+		segment := &UrlSegment{Name: part}
+		if part == "*" {
+			segment.IsWildcard = true
+		} else if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			segment.IsVariable = true
+			nameAndMapping := strings.SplitN(part[1:len(part)-1], ":", 2)
+			segment.Name = strings.TrimSpace(nameAndMapping[0])
+			if len(nameAndMapping) > 1 {
+				segment.Mapping = strings.TrimSpace(nameAndMapping[1])
+			}
+			if strings.HasSuffix(segment.Name, "...") {
+				segment.Name = strings.TrimSuffix(segment.Name, "...")
+				segment.IsVariable = false
+				segment.IsWildcard = true
+			}
+			if segment.Name == "" {
+				return nil, fmt.Errorf("Variable without a name in url '%s'", template)
+			}
+		} else if strings.ContainsAny(part, "{}") {
+			return nil, fmt.Errorf("Invalid segment '%s' in url '%s'", part, template)
+		}
+		if segment.IsWildcard && index != len(parts)-1 {
+			return nil, fmt.Errorf("Wildcards can only appear at the end of url '%s'", template)
+		}
+		out = append(out, segment)
+	}
+	return out, nil
+}
+
+/**
+ * Adds a binding to the router.
+ */
+func (r *UrlRouter) AddBinding(binding *HttpBinding) error {
+	segments, err := ParseUrlTemplate(binding.Url)
+	if err != nil {
+		return err
+	}
+	node := r.root
+	rt := &route{binding: binding}
+	for _, segment := range segments {
+		if segment.IsWildcard {
+			if node.wildcard == nil {
+				node.wildcard = &routeNode{}
+			}
+			node = node.wildcard
+		} else if segment.IsVariable {
+			if node.variable == nil {
+				node.variable = &routeNode{}
+			}
+			node = node.variable
+		} else {
+			if node.literals == nil {
+				node.literals = make(map[string]*routeNode)
+			}
+			child := node.literals[segment.Name]
+			if child == nil {
+				child = &routeNode{}
+				node.literals[segment.Name] = child
+			}
+			node = child
+		}
+		if segment.IsVariable || segment.IsWildcard {
+			rt.varNames = append(rt.varNames, segment.Name)
+			if segment.Mapping != "" {
+				binding.AddVarMapping(segment.Name, segment.Mapping)
+			}
+		}
+	}
+	node.routes = append(node.routes, rt)
+	return nil
+}
+
+/**
+ * Finds the binding for a method and path along with the values of the
+ * variables in the path.  The path is the escaped path of the url (see
+ * url.URL.EscapedPath) so that escaped "/"s (%2F) within the values of
+ * variables do not split their segments.  Segments are unescaped after
+ * the path is split.
+ *
+ * If no binding matches then a HttpError is returned whose code indicates
+ * whether the path did not match any binding (404) or if the path matched
+ * but the method did not (405).
+ */
+func (r *UrlRouter) Match(method string, path string) (*HttpBinding, map[string]string, error) {
+	parts := splitPath(path)
+	for index, part := range parts {
+		if value, err := url.PathUnescape(part); err == nil {
+			parts[index] = value
+		}
+	}
+	allowed := make(map[string]bool)
+	rt, values := r.root.match(method, parts, nil, allowed)
+	if rt == nil {
+		if len(allowed) == 0 {
+			return nil, nil, &HttpError{Code: http.StatusNotFound}
+		}
+		out := &HttpError{Code: http.StatusMethodNotAllowed}
+		for m := range allowed {
+			out.Allowed = append(out.Allowed, m)
+		}
+		sort.Strings(out.Allowed)
+		return nil, nil, out
+	}
+	variables := make(map[string]string)
+	for index, name := range rt.varNames {
+		variables[name] = values[index]
+	}
+	return rt.binding, variables, nil
+}
+
+func (node *routeNode) match(method string, parts []string, values []string, allowed map[string]bool) (*route, []string) {
+	if len(parts) == 0 {
+		if rt := node.matchMethod(method, allowed); rt != nil {
+			return rt, values
+		}
+		// a wildcard can also match an empty remainder
+		if node.wildcard != nil {
+			if rt := node.wildcard.matchMethod(method, allowed); rt != nil {
+				return rt, append(values, "")
+			}
+		}
+		return nil, nil
+	}
+	if child := node.literals[parts[0]]; child != nil {
+		if rt, out := child.match(method, parts[1:], values, allowed); rt != nil {
+			return rt, out
+		}
+	}
+	if node.variable != nil {
+		if rt, out := node.variable.match(method, parts[1:], append(values, parts[0]), allowed); rt != nil {
+			return rt, out
+		}
+	}
+	if node.wildcard != nil {
+		if rt := node.wildcard.matchMethod(method, allowed); rt != nil {
+			return rt, append(values, strings.Join(parts, "/"))
+		}
+	}
+	return nil, nil
+}
+
+func (node *routeNode) matchMethod(method string, allowed map[string]bool) *route {
+	for _, rt := range node.routes {
+		if rt.binding.MatchesMethod(method) {
+			return rt
+		}
+	}
+	for _, rt := range node.routes {
+		for _, m := range rt.binding.Methods {
+			allowed[m] = true
+		}
+	}
+	return nil
+}
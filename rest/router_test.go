@@ -0,0 +1,72 @@
+package rest
+
+import (
+	. "gopkg.in/check.v1"
+	"net/http"
+)
+
+func (s *TestSuite) TestParseUrlTemplate(c *C) {
+	segments, err := ParseUrlTemplate("/users/{id:Request.UserId}/posts/{rest...}")
+	c.Assert(err, IsNil)
+	c.Assert(len(segments), Equals, 4)
+	c.Assert(segments[0].Name, Equals, "users")
+	c.Assert(segments[1].IsVariable, Equals, true)
+	c.Assert(segments[1].Name, Equals, "id")
+	c.Assert(segments[1].Mapping, Equals, "Request.UserId")
+	c.Assert(segments[3].IsWildcard, Equals, true)
+	c.Assert(segments[3].Name, Equals, "rest")
+
+	_, err = ParseUrlTemplate("/files/*/info")
+	c.Assert(err, Not(IsNil))
+	_, err = ParseUrlTemplate("/users/{}")
+	c.Assert(err, Not(IsNil))
+}
+
+func (s *TestSuite) TestRouterPrecedence(c *C) {
+	router := NewUrlRouter()
+	me := &HttpBinding{Url: "/users/me", Methods: []string{"GET"}}
+	byId := &HttpBinding{Url: "/users/{id:Request.UserId}", Methods: []string{"GET", "DELETE"}}
+	posts := &HttpBinding{Url: "/users/{userId}/posts/{postId}"}
+	files := &HttpBinding{Url: "/files/{path...}", Methods: []string{"GET"}}
+	for _, binding := range []*HttpBinding{me, byId, posts, files} {
+		c.Assert(router.AddBinding(binding), IsNil)
+	}
+	c.Assert(byId.VarMappings["id"], DeepEquals, []string{"Request.UserId"})
+
+	binding, vars, err := router.Match("GET", "/users/me/")
+	c.Assert(err, IsNil)
+	c.Assert(binding, Equals, me)
+
+	binding, vars, err = router.Match("DELETE", "/users/me")
+	c.Assert(err, IsNil)
+	c.Assert(binding, Equals, byId)
+	c.Assert(vars["id"], Equals, "me")
+
+	binding, vars, err = router.Match("PUT", "/users/1/posts/2")
+	c.Assert(err, IsNil)
+	c.Assert(binding, Equals, posts)
+	c.Assert(vars, DeepEquals, map[string]string{"userId": "1", "postId": "2"})
+
+	binding, vars, err = router.Match("GET", "/files/a/b/c.txt")
+	c.Assert(err, IsNil)
+	c.Assert(binding, Equals, files)
+	c.Assert(vars["path"], Equals, "a/b/c.txt")
+
+	// escaped "/"s do not split segments
+	binding, vars, err = router.Match("GET", "/users/u%201%2F2")
+	c.Assert(err, IsNil)
+	c.Assert(binding, Equals, byId)
+	c.Assert(vars["id"], Equals, "u 1/2")
+}
+
+func (s *TestSuite) TestRouterErrors(c *C) {
+	router := NewUrlRouter()
+	router.AddBinding(&HttpBinding{Url: "/users/{id}", Methods: []string{"GET", "DELETE"}})
+
+	_, _, err := router.Match("POST", "/users/1")
+	c.Assert(err.(*HttpError).Code, Equals, http.StatusMethodNotAllowed)
+	c.Assert(err.(*HttpError).Allowed, DeepEquals, []string{"DELETE", "GET"})
+
+	_, _, err = router.Match("GET", "/users/1/posts")
+	c.Assert(err.(*HttpError).Code, Equals, http.StatusNotFound)
+}
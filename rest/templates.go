@@ -0,0 +1,55 @@
+package rest
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// The default templates that are compiled into the binary.
+//
+//go:embed templates/*.gen
+var embeddedTemplates embed.FS
+
+/**
+ * Returns the default templates for generating rest clients.
+ */
+func DefaultTemplates() fs.FS {
+	out, err := fs.Sub(embeddedTemplates, "templates")
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+/**
+ * Returns the templates to be used by a generator.  Templates found in the
+ * override folder take precedence over the default templates so only the
+ * templates that need changing have to be provided.  An empty folder
+ * returns just the default templates.
+ */
+func NewTemplatesFS(overrideDir string) fs.FS {
+	if overrideDir == "" {
+		return DefaultTemplates()
+	}
+	return LayeredFS{os.DirFS(overrideDir), DefaultTemplates()}
+}
+
+/**
+ * A file system that looks up files in each of its layers in order and
+ * returns the first one found.
+ */
+type LayeredFS []fs.FS
+
+func (layers LayeredFS) Open(name string) (fs.File, error) {
+	for _, layer := range layers {
+		file, err := layer.Open(name)
+		if err == nil {
+			return file, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
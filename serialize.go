@@ -0,0 +1,411 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+)
+
+/**
+ * Version of the json schema type libraries are serialized with.  This is
+ * bumped whenever the schema changes in a way older readers cannot handle.
+ */
+const TypeLibraryVersion = 1
+
+/**
+ * A type library as it is serialized to json.  Types refer to each other
+ * by their ids (starting from 1) so that recursive types can be
+ * represented, eg:
+ *
+ * 	{
+ * 	  "version": 1,
+ * 	  "packages": [{"path": "example.com/app/models", "shortName": "models"}],
+ * 	  "entries": [{"package": "example.com/app/models", "name": "User", "type": 1}],
+ * 	  "types": [
+ * 	    {"id": 1, "class": "RecordType", "name": "User", "package": "example.com/app/models",
+ * 	     "fields": [{"name": "Friends", "type": 2}]},
+ * 	    {"id": 2, "class": "ListType", "target": 3},
+ * 	    {"id": 3, "class": "ReferenceType", "target": 1}
+ * 	  ]
+ * 	}
+ */
+type jsonTypeLibrary struct {
+	Version  int            `json:"version"`
+	Packages []*jsonPackage `json:"packages"`
+	Entries  []*jsonEntry   `json:"entries"`
+	Types    []*jsonType    `json:"types"`
+}
+
+type jsonPackage struct {
+	Path      string `json:"path"`
+	ShortName string `json:"shortName"`
+}
+
+/**
+ * A type registered in the library by its package and name.
+ */
+type jsonEntry struct {
+	Package string `json:"package,omitempty"`
+	Name    string `json:"name"`
+	Type    int    `json:"type"`
+}
+
+/**
+ * A type along with the data of its class (the other fields are empty).
+ */
+type jsonType struct {
+	Id    int    `json:"id"`
+	Class string `json:"class"`
+
+	// Named, unresolved, alias, record and type parameter types
+	Name       string        `json:"name,omitempty"`
+	Package    string        `json:"package,omitempty"`
+	TypeParams []int         `json:"typeParams,omitempty"`
+	Doc        string        `json:"doc,omitempty"`
+	Position   *jsonPosition `json:"position,omitempty"`
+
+	// Methods of records and (non alias) named types
+	Methods []*jsonMethod `json:"methods,omitempty"`
+
+	// Alias, reference and list types
+	Target  int  `json:"target,omitempty"`
+	IsAlias bool `json:"isAlias,omitempty"`
+	IsArray bool `json:"isArray,omitempty"`
+	Length  int  `json:"length,omitempty"`
+
+	// Map and channel types
+	Key     int    `json:"key,omitempty"`
+	Value   int    `json:"value,omitempty"`
+	Element int    `json:"element,omitempty"`
+	Dir     string `json:"dir,omitempty"`
+
+	// Tuple and record types
+	SubTypes    []int        `json:"subTypes,omitempty"`
+	IsInterface bool         `json:"isInterface,omitempty"`
+	Bases       []int        `json:"bases,omitempty"`
+	Fields      []*jsonField `json:"fields,omitempty"`
+
+	// Function types
+	Inputs      []int    `json:"inputs,omitempty"`
+	InputNames  []string `json:"inputNames,omitempty"`
+	Outputs     []int    `json:"outputs,omitempty"`
+	OutputNames []string `json:"outputNames,omitempty"`
+	Exceptions  []int    `json:"exceptions,omitempty"`
+	IsVariadic  bool     `json:"isVariadic,omitempty"`
+
+	// Type parameters, instances and unions
+	Index      int              `json:"index,omitempty"`
+	Constraint int              `json:"constraint,omitempty"`
+	Generic    int              `json:"generic,omitempty"`
+	TypeArgs   []int            `json:"typeArgs,omitempty"`
+	Terms      []*jsonUnionTerm `json:"terms,omitempty"`
+}
+
+type jsonField struct {
+	Name     string        `json:"name,omitempty"`
+	Type     int           `json:"type"`
+	Tag      string        `json:"tag,omitempty"`
+	Doc      string        `json:"doc,omitempty"`
+	Position *jsonPosition `json:"position,omitempty"`
+}
+
+type jsonMethod struct {
+	Name            string        `json:"name"`
+	Type            int           `json:"type"`
+	PointerReceiver bool          `json:"pointerReceiver,omitempty"`
+	Doc             string        `json:"doc,omitempty"`
+	Position        *jsonPosition `json:"position,omitempty"`
+}
+
+type jsonUnionTerm struct {
+	Tilde bool `json:"tilde,omitempty"`
+	Type  int  `json:"type"`
+}
+
+type jsonPosition struct {
+	File   string `json:"file,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+	Line   int    `json:"line"`
+	Column int    `json:"column,omitempty"`
+}
+
+var channelDirNames = map[int]string{BothDirs: "both", SendOnly: "send", RecvOnly: "recv"}
+
+/**
+ * Serializes the library (its types, packages and their short names) to
+ * json.  Types are numbered in a deterministic order so the same library
+ * is always serialized the same way.
+ */
+func (tl *TypeLibrary) MarshalJSON() ([]byte, error) {
+	out := &jsonTypeLibrary{Version: TypeLibraryVersion, Packages: []*jsonPackage{}, Entries: []*jsonEntry{}, Types: []*jsonType{}}
+	tl.mutex.RLock()
+	for pkg, shortName := range tl.shortNamesForPkg {
+		out.Packages = append(out.Packages, &jsonPackage{Path: pkg, ShortName: shortName})
+	}
+	tl.mutex.RUnlock()
+	sort.Slice(out.Packages, func(i, j int) bool { return out.Packages[i].Path < out.Packages[j].Path })
+
+	// number the types (depth first from the entries)
+	ids := make(map[*Type]int)
+	var ordered []*Type
+	var number func(t *Type)
+	number = func(t *Type) {
+		if t == nil || ids[t] != 0 {
+			return
+		}
+		ordered = append(ordered, t)
+		ids[t] = len(ordered)
+		for _, slot := range childSlots(t) {
+			number(*slot)
+		}
+	}
+	tl.ForEach(func(key string, t *Type, stop *bool) {
+		number(t)
+		index := strings.LastIndex(key, ".")
+		out.Entries = append(out.Entries, &jsonEntry{Package: key[:index], Name: key[index+1:], Type: ids[t]})
+	})
+
+	for _, t := range ordered {
+		serialized, err := typeToJson(t, ids)
+		if err != nil {
+			return nil, err
+		}
+		out.Types = append(out.Types, serialized)
+	}
+	return json.Marshal(out)
+}
+
+/**
+ * Replaces the contents of the library with a library serialized with
+ * MarshalJSON.
+ */
+func (tl *TypeLibrary) UnmarshalJSON(data []byte) error {
+	var in jsonTypeLibrary
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	if in.Version < 1 || in.Version > TypeLibraryVersion {
+		return fmt.Errorf("unsupported type library version %d (expected at most %d)", in.Version, TypeLibraryVersion)
+	}
+
+	// create all types first so they can refer to each other
+	types := make(map[int]*Type)
+	for _, serialized := range in.Types {
+		if _, ok := types[serialized.Id]; ok || serialized.Id < 1 {
+			return fmt.Errorf("invalid or duplicate type id %d", serialized.Id)
+		}
+		types[serialized.Id] = &Type{}
+	}
+	for _, serialized := range in.Types {
+		if err := jsonToType(serialized, types[serialized.Id], types); err != nil {
+			return err
+		}
+	}
+
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+	tl.types = make(map[string]*Type)
+	tl.shortNamesForPkg = make(map[string]string)
+	tl.pkgByShortName = make(map[string]string)
+	for _, pkg := range in.Packages {
+		tl.shortNamesForPkg[pkg.Path] = pkg.ShortName
+		tl.pkgByShortName[pkg.ShortName] = pkg.Path
+	}
+	for _, entry := range in.Entries {
+		t := types[entry.Type]
+		if t == nil {
+			return fmt.Errorf("unknown type id %d for %s.%s", entry.Type, entry.Package, entry.Name)
+		}
+		tl.types[entry.Package+"."+entry.Name] = t
+	}
+	tl.typeCounter = int64(len(tl.types))
+	return nil
+}
+
+/**
+ * Reads a type library serialized with MarshalJSON.
+ */
+func ReadTypeLibrary(reader io.Reader) (*TypeLibrary, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	out := &TypeLibrary{}
+	if err := json.Unmarshal(data, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func positionToJson(position token.Position) *jsonPosition {
+	if !position.IsValid() {
+		return nil
+	}
+	return &jsonPosition{File: position.Filename, Offset: position.Offset, Line: position.Line, Column: position.Column}
+}
+
+func jsonToPosition(position *jsonPosition) token.Position {
+	if position == nil {
+		return token.Position{}
+	}
+	return token.Position{Filename: position.File, Offset: position.Offset, Line: position.Line, Column: position.Column}
+}
+
+func methodsToJson(methods []*Method, ids map[*Type]int) []*jsonMethod {
+	var out []*jsonMethod
+	for _, method := range methods {
+		out = append(out, &jsonMethod{Name: method.Name, Type: ids[method.Type], PointerReceiver: method.PointerReceiver,
+			Doc: method.Doc, Position: positionToJson(method.Position)})
+	}
+	return out
+}
+
+func typesToIds(types []*Type, ids map[*Type]int) []int {
+	var out []int
+	for _, t := range types {
+		out = append(out, ids[t])
+	}
+	return out
+}
+
+func typeToJson(t *Type, ids map[*Type]int) (*jsonType, error) {
+	out := &jsonType{Id: ids[t], Class: t.TypeClassString()}
+	switch typeData := t.TypeData.(type) {
+	case nil:
+	case *NamedTypeData:
+		out.Name, out.Package = typeData.Name, typeData.Package
+	case *AliasTypeData:
+		out.Name, out.Package = typeData.Name, typeData.Package
+		out.Target, out.IsAlias = ids[typeData.TargetType], typeData.IsAlias
+		out.TypeParams = typesToIds(typeData.TypeParams, ids)
+		out.Methods = methodsToJson(typeData.Methods, ids)
+	case *ReferenceTypeData:
+		out.Target = ids[typeData.TargetType]
+	case *ListTypeData:
+		out.Target, out.IsArray, out.Length = ids[typeData.TargetType], typeData.IsArray, typeData.Length
+	case *MapTypeData:
+		out.Key, out.Value = ids[typeData.KeyType], ids[typeData.ValueType]
+	case *ChannelTypeData:
+		out.Element, out.Dir = ids[typeData.ElementType], channelDirNames[typeData.Dir]
+	case *TupleTypeData:
+		out.SubTypes = typesToIds(typeData.SubTypes, ids)
+	case *RecordTypeData:
+		out.Name, out.Package = typeData.Name, typeData.Package
+		out.TypeParams = typesToIds(typeData.TypeParams, ids)
+		out.IsInterface, out.Doc, out.Position = typeData.IsInterface, typeData.Doc, positionToJson(typeData.Position)
+		out.Bases = typesToIds(typeData.Bases, ids)
+		for _, field := range typeData.Fields {
+			out.Fields = append(out.Fields, &jsonField{Name: field.Name, Type: ids[field.Type], Tag: field.Tag,
+				Doc: field.Doc, Position: positionToJson(field.Position)})
+		}
+		out.Methods = methodsToJson(typeData.Methods, ids)
+	case *FunctionTypeData:
+		out.Inputs, out.InputNames = typesToIds(typeData.InputTypes, ids), typeData.InputNames
+		out.Outputs, out.OutputNames = typesToIds(typeData.OutputTypes, ids), typeData.OutputNames
+		out.Exceptions, out.IsVariadic = typesToIds(typeData.ExceptionTypes, ids), typeData.IsVariadic
+		out.Doc, out.Position = typeData.Doc, positionToJson(typeData.Position)
+	case *TypeParamData:
+		out.Name, out.Index, out.Constraint = typeData.Name, typeData.Index, ids[typeData.Constraint]
+	case *InstanceTypeData:
+		out.Generic, out.TypeArgs = ids[typeData.GenericType], typesToIds(typeData.TypeArgs, ids)
+	case *UnionTypeData:
+		for _, term := range typeData.Terms {
+			out.Terms = append(out.Terms, &jsonUnionTerm{Tilde: term.Tilde, Type: ids[term.Type]})
+		}
+	default:
+		return nil, fmt.Errorf("cannot serialize %s with data %T", out.Class, t.TypeData)
+	}
+	return out, nil
+}
+
+/**
+ * Fills in a (newly created) type from its json form.
+ */
+func jsonToType(in *jsonType, out *Type, types map[int]*Type) error {
+	var err error
+	lookup := func(id int) *Type {
+		if id == 0 {
+			return nil
+		}
+		t := types[id]
+		if t == nil && err == nil {
+			err = fmt.Errorf("unknown type id %d in type %d", id, in.Id)
+		}
+		return t
+	}
+	lookupAll := func(ids []int) []*Type {
+		var out []*Type
+		for _, id := range ids {
+			out = append(out, lookup(id))
+		}
+		return out
+	}
+	lookupMethods := func(methods []*jsonMethod) []*Method {
+		var out []*Method
+		for _, method := range methods {
+			out = append(out, &Method{Name: method.Name, Type: lookup(method.Type), PointerReceiver: method.PointerReceiver,
+				Doc: method.Doc, Position: jsonToPosition(method.Position)})
+		}
+		return out
+	}
+
+	out.TypeClass = -1
+	for class := NullType; class <= ChannelType; class++ {
+		if (&Type{TypeClass: class}).TypeClassString() == in.Class {
+			out.TypeClass = class
+		}
+	}
+	namedData := NamedTypeData{Name: in.Name, Package: in.Package}
+	switch out.TypeClass {
+	case NullType:
+	case UnresolvedType, NamedType:
+		out.TypeData = &namedData
+	case AliasType:
+		out.TypeData = &AliasTypeData{NamedTypeData: namedData, TargetType: lookup(in.Target), IsAlias: in.IsAlias,
+			TypeParams: lookupAll(in.TypeParams), Methods: lookupMethods(in.Methods)}
+	case ReferenceType:
+		out.TypeData = &ReferenceTypeData{TargetType: lookup(in.Target)}
+	case ListType:
+		out.TypeData = &ListTypeData{TargetType: lookup(in.Target), IsArray: in.IsArray, Length: in.Length}
+	case MapType:
+		out.TypeData = &MapTypeData{KeyType: lookup(in.Key), ValueType: lookup(in.Value)}
+	case ChannelType:
+		channelData := &ChannelTypeData{ElementType: lookup(in.Element)}
+		for dir, name := range channelDirNames {
+			if name == in.Dir {
+				channelData.Dir = dir
+			}
+		}
+		out.TypeData = channelData
+	case TupleType:
+		out.TypeData = &TupleTypeData{SubTypes: lookupAll(in.SubTypes)}
+	case RecordType:
+		recordData := &RecordTypeData{NamedTypeData: namedData, Bases: lookupAll(in.Bases), TypeParams: lookupAll(in.TypeParams),
+			IsInterface: in.IsInterface, Doc: in.Doc, Position: jsonToPosition(in.Position), Methods: lookupMethods(in.Methods)}
+		for _, field := range in.Fields {
+			recordData.Fields = append(recordData.Fields, &Field{Name: field.Name, Type: lookup(field.Type), Tag: field.Tag,
+				Doc: field.Doc, Position: jsonToPosition(field.Position)})
+		}
+		out.TypeData = recordData
+	case FunctionType:
+		out.TypeData = &FunctionTypeData{InputTypes: lookupAll(in.Inputs), InputNames: in.InputNames,
+			OutputTypes: lookupAll(in.Outputs), OutputNames: in.OutputNames, ExceptionTypes: lookupAll(in.Exceptions),
+			IsVariadic: in.IsVariadic, Doc: in.Doc, Position: jsonToPosition(in.Position)}
+	case TypeParamType:
+		out.TypeData = &TypeParamData{Name: in.Name, Index: in.Index, Constraint: lookup(in.Constraint)}
+	case InstanceType:
+		out.TypeData = &InstanceTypeData{GenericType: lookup(in.Generic), TypeArgs: lookupAll(in.TypeArgs)}
+	case UnionType:
+		unionData := &UnionTypeData{}
+		for _, term := range in.Terms {
+			unionData.Terms = append(unionData.Terms, &UnionTerm{Tilde: term.Tilde, Type: lookup(term.Type)})
+		}
+		out.TypeData = unionData
+	default:
+		return fmt.Errorf("unknown class %q of type %d", in.Class, in.Id)
+	}
+	return err
+}
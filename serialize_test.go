@@ -0,0 +1,76 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestTypeLibraryJson(c *C) {
+	_, typeLibrary := parseTestSource(c, `package test
+
+// A node in a tree
+type Node struct {
+	Name     string "json:\"name\""
+	Parent   *Node
+	Children []*Node
+	Labels   map[string][2]int
+}
+
+type Page[T any] struct {
+	Items []T
+}
+
+// Returns the first item
+func (p *Page[T]) First() T {
+	return p.Items[0]
+}
+
+type Number interface {
+	~int | ~float64
+}
+
+type Service interface {
+	Watch(id string, filters ...string) (<-chan Page[Node], error)
+}
+`)
+	data, err := json.Marshal(typeLibrary)
+	c.Assert(err, IsNil)
+
+	loaded, err := ReadTypeLibrary(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	typeLibrary.ForEach(func(key string, t *Type, stop *bool) {
+		c.Assert(loaded.types[key], NotNil, Commentf("%s", key))
+		c.Assert(loaded.Signature(loaded.types[key]), Equals, typeLibrary.Signature(t))
+	})
+	c.Assert(loaded.ShortNameForPackage("example.com/test"), Equals, typeLibrary.ShortNameForPackage("example.com/test"))
+
+	// cycles are kept
+	node := loaded.GetType("example.com/test", "Node").AsRecordType()
+	c.Assert(node.Fields[1].Type.AsReferenceType().TargetType.AsRecordType(), Equals, node)
+	c.Assert(node.Doc, Equals, "A node in a tree\n")
+	c.Assert(node.Fields[0].Tag, Equals, `json:"name"`)
+	c.Assert(node.Fields[0].Position.Line, Equals, 5)
+
+	page := loaded.GetType("example.com/test", "Page")
+	c.Assert(page.AsRecordType().Fields[0].Type.AsListType().TargetType, Equals, page.TypeParams()[0])
+	first := page.Methods()[0]
+	c.Assert(first.Name, Equals, "First")
+	c.Assert(first.PointerReceiver, Equals, true)
+	c.Assert(first.Doc, Equals, "Returns the first item\n")
+	c.Assert(first.Type.AsFunctionType().OutputTypes[0], Equals, page.TypeParams()[0])
+	watch := loaded.GetType("example.com/test", "Service").AsRecordType().Fields[0].Type.AsFunctionType()
+	c.Assert(watch.IsVariadic, Equals, true)
+	c.Assert(watch.InputNames, DeepEquals, []string{"id", "filters"})
+	c.Assert(watch.IsStreaming(), Equals, true)
+
+	// serializing is deterministic
+	again, err := json.Marshal(loaded)
+	c.Assert(err, IsNil)
+	c.Assert(string(again), Equals, string(data))
+
+	_, err = ReadTypeLibrary(bytes.NewReader([]byte(`{"version": 99}`)))
+	c.Assert(err, ErrorMatches, "unsupported type library version 99.*")
+	_, err = ReadTypeLibrary(bytes.NewReader([]byte(`{"version": 1, "types": [{"id": 1, "class": "ListType", "target": 2}]}`)))
+	c.Assert(err, ErrorMatches, "unknown type id 2 in type 1")
+}
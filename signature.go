@@ -0,0 +1,579 @@
+package bridge
+
+import (
+	"fmt"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Returns the string form of a type in (mostly) Go syntax with named types
+ * qualified by the qualifier.  The qualifier returns the name the package
+ * of a type is referred to with (or "" for types that are not to be
+ * qualified).  Without a qualifier types are qualified with the full import
+ * path of their package, which is the canonical form returned by Signature,
+ * eg:
+ *
+ * 	map[string][]*example.com/app/models.User
+ * 	func(int, ...string) (gopkg.in/yaml.v3.Node, error)
+ * 	struct{Id string "json:\"id\""; example.com/app/core.Base}
+ */
+func (tl *TypeLibrary) TypeString(t *Type, qualifier func(pkg string) string) string {
+	if t == nil {
+		return ""
+	}
+	qualify := func(data *NamedTypeData) string {
+		if data.Package == "" {
+			return data.Name
+		}
+		if qualifier == nil {
+			return data.Package + "." + data.Name
+		}
+		if prefix := qualifier(data.Package); prefix != "" {
+			return prefix + "." + data.Name
+		}
+		return data.Name
+	}
+	switch typeData := t.TypeData.(type) {
+	case *NamedTypeData:
+		// named types as well as placeholders for unresolved types
+		return qualify(typeData)
+	case *AliasTypeData:
+		if typeData.IsAlias || typeData.Name == "" {
+			return tl.TypeString(typeData.TargetType, qualifier)
+		}
+		return qualify(&typeData.NamedTypeData)
+	case *ReferenceTypeData:
+		return "*" + tl.TypeString(typeData.TargetType, qualifier)
+	case *RecordTypeData:
+		if typeData.Name != "" {
+			return qualify(&typeData.NamedTypeData)
+		}
+		out := "struct{"
+		if typeData.IsInterface {
+			out = "interface{"
+		}
+		for index, field := range typeData.Fields {
+			if index > 0 {
+				out += "; "
+			}
+			if field.Name == "" {
+				out += tl.TypeString(field.Type, qualifier)
+			} else if functionType, ok := field.Type.TypeData.(*FunctionTypeData); ok && typeData.IsInterface {
+				out += field.Name + tl.functionString(functionType, qualifier)
+			} else {
+				out += field.Name + " " + tl.TypeString(field.Type, qualifier)
+			}
+			if field.Tag != "" {
+				out += " " + strconv.Quote(field.Tag)
+			}
+		}
+		return out + "}"
+	case *TupleTypeData:
+		return "(" + tl.typeListString(typeData.SubTypes, qualifier) + ")"
+	case *FunctionTypeData:
+		return "func" + tl.functionString(typeData, qualifier)
+	case *ListTypeData:
+		if !typeData.IsArray {
+			return "[]" + tl.TypeString(typeData.TargetType, qualifier)
+		} else if typeData.Length < 0 {
+			return "[...]" + tl.TypeString(typeData.TargetType, qualifier)
+		}
+		return fmt.Sprintf("[%d]", typeData.Length) + tl.TypeString(typeData.TargetType, qualifier)
+	case *ChannelTypeData:
+		switch typeData.Dir {
+		case SendOnly:
+			return "chan<- " + tl.TypeString(typeData.ElementType, qualifier)
+		case RecvOnly:
+			return "<-chan " + tl.TypeString(typeData.ElementType, qualifier)
+		}
+		elementString := tl.TypeString(typeData.ElementType, qualifier)
+		if typeData.ElementType.IsChannelType() && typeData.ElementType.AsChannelType().Dir == RecvOnly {
+			// chan <-chan T would be read as chan<- chan T
+			elementString = "(" + elementString + ")"
+		}
+		return "chan " + elementString
+	case *MapTypeData:
+		return "map[" + tl.TypeString(typeData.KeyType, qualifier) + "]" + tl.TypeString(typeData.ValueType, qualifier)
+	case *TypeParamData:
+		return typeData.Name
+	case *InstanceTypeData:
+		return tl.TypeString(typeData.GenericType, qualifier) + "[" + tl.typeListString(typeData.TypeArgs, qualifier) + "]"
+	case *UnionTypeData:
+		out := ""
+		for index, term := range typeData.Terms {
+			if index > 0 {
+				out += " | "
+			}
+			if term.Tilde {
+				out += "~"
+			}
+			out += tl.TypeString(term.Type, qualifier)
+		}
+		return out
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(t.TypeData)
+}
+
+/**
+ * Returns the parameters and results of a function (ie its signature
+ * without the func keyword).
+ */
+func (tl *TypeLibrary) functionString(functionType *FunctionTypeData, qualifier func(pkg string) string) string {
+	inputTypes := functionType.InputTypes
+	out := "("
+	if numInputs := len(inputTypes); functionType.IsVariadic && numInputs > 0 {
+		if numInputs > 1 {
+			out += tl.typeListString(inputTypes[:numInputs-1], qualifier) + ", "
+		}
+		lastType := inputTypes[numInputs-1]
+		if listType, ok := lastType.TypeData.(*ListTypeData); ok {
+			lastType = listType.TargetType
+		}
+		out += "..." + tl.TypeString(lastType, qualifier)
+	} else {
+		out += tl.typeListString(inputTypes, qualifier)
+	}
+	out += ")"
+	if len(functionType.OutputTypes) == 1 {
+		out += " " + tl.TypeString(functionType.OutputTypes[0], qualifier)
+	} else if len(functionType.OutputTypes) > 1 {
+		out += " (" + tl.typeListString(functionType.OutputTypes, qualifier) + ")"
+	}
+	if len(functionType.ExceptionTypes) > 0 {
+		out += " throws (" + tl.typeListString(functionType.ExceptionTypes, qualifier) + ")"
+	}
+	return out
+}
+
+func (tl *TypeLibrary) typeListString(types []*Type, qualifier func(pkg string) string) string {
+	out := ""
+	for index, t := range types {
+		if index > 0 {
+			out += ", "
+		}
+		out += tl.TypeString(t, qualifier)
+	}
+	return out
+}
+
+/**
+ * Parses a signature (as returned by Signature) back into a type.  Named
+ * types are looked up in the library (packages can also be referred to by
+ * their short names) and unqualified names are global or predeclared types.
+ * Named types are returned as they are in the library while new types are
+ * created for everything else.
+ */
+func (tl *TypeLibrary) ParseSignature(sig string) (*Type, error) {
+	tokens, err := tokenizeSignature(sig)
+	if err != nil {
+		return nil, err
+	}
+	parser := &signatureParser{typeLibrary: tl, sig: sig, tokens: tokens}
+	out, err := parser.parseUnion()
+	if err != nil {
+		return nil, err
+	}
+	if parser.peek() != "" {
+		return nil, parser.errorf("unexpected %s", parser.peek())
+	}
+	return out, nil
+}
+
+/**
+ * Splits a signature into names (possibly qualified by import paths),
+ * numbers, tags and punctuation.
+ */
+func tokenizeSignature(sig string) ([]string, error) {
+	var out []string
+	for index := 0; index < len(sig); {
+		ch := sig[index]
+		switch {
+		case ch == ' ' || ch == '\t':
+			index++
+		case strings.HasPrefix(sig[index:], "..."):
+			out = append(out, "...")
+			index += 3
+		case strings.HasPrefix(sig[index:], "<-"):
+			out = append(out, "<-")
+			index += 2
+		case strings.IndexByte("*[](){},;|~", ch) >= 0:
+			out = append(out, sig[index:index+1])
+			index++
+		case ch == '"' || ch == '`':
+			literal, err := strconv.QuotedPrefix(sig[index:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid signature %q: bad tag at offset %d", sig, index)
+			}
+			out = append(out, literal)
+			index += len(literal)
+		case isSignatureNameChar(ch):
+			start := index
+			for index < len(sig) && isSignatureNameChar(sig[index]) {
+				index++
+			}
+			out = append(out, sig[start:index])
+		default:
+			return nil, fmt.Errorf("invalid signature %q: unexpected %q at offset %d", sig, ch, index)
+		}
+	}
+	return out, nil
+}
+
+/**
+ * Tells if a character can be part of a name (or an import path
+ * qualifying it).
+ */
+func isSignatureNameChar(ch byte) bool {
+	return ch == '_' || ch == '.' || ch == '/' || ch == '-' || ch >= 0x80 ||
+		(ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
+func isSignatureName(token string) bool {
+	return token != "" && token != "..." && isSignatureNameChar(token[0])
+}
+
+type signatureParser struct {
+	typeLibrary ITypeLibrary
+	sig         string
+	tokens      []string
+	pos         int
+}
+
+func (p *signatureParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid signature %q: %s", p.sig, fmt.Sprintf(format, args...))
+}
+
+/**
+ * Returns the token that is some way ahead (or "" past the end).
+ */
+func (p *signatureParser) peekAt(offset int) string {
+	if p.pos+offset < len(p.tokens) {
+		return p.tokens[p.pos+offset]
+	}
+	return ""
+}
+
+func (p *signatureParser) peek() string {
+	return p.peekAt(0)
+}
+
+func (p *signatureParser) next() string {
+	out := p.peek()
+	if out != "" {
+		p.pos++
+	}
+	return out
+}
+
+func (p *signatureParser) expect(token string) error {
+	if next := p.next(); next != token {
+		if next == "" {
+			return p.errorf("expected %s at end", token)
+		}
+		return p.errorf("expected %s instead of %s", token, next)
+	}
+	return nil
+}
+
+/**
+ * Parses a union of terms (returning the type itself if there is only
+ * one term without a tilde).
+ */
+func (p *signatureParser) parseUnion() (*Type, error) {
+	var terms []*UnionTerm
+	for {
+		term := &UnionTerm{Tilde: p.peek() == "~"}
+		if term.Tilde {
+			p.next()
+		}
+		t, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		term.Type = t
+		terms = append(terms, term)
+		if p.peek() != "|" {
+			break
+		}
+		p.next()
+	}
+	if len(terms) == 1 && !terms[0].Tilde {
+		return terms[0].Type, nil
+	}
+	return &Type{TypeClass: UnionType, TypeData: &UnionTypeData{Terms: terms}}, nil
+}
+
+func (p *signatureParser) parseType() (*Type, error) {
+	token := p.next()
+	switch token {
+	case "":
+		return nil, p.errorf("unexpected end")
+	case "*":
+		target, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		return &Type{TypeClass: ReferenceType, TypeData: &ReferenceTypeData{TargetType: target}}, nil
+	case "[":
+		listData := &ListTypeData{}
+		if p.peek() != "]" {
+			listData.IsArray, listData.Length = true, -1
+			if length := p.next(); length != "..." {
+				value, err := strconv.Atoi(length)
+				if err != nil {
+					return nil, p.errorf("invalid array length %s", length)
+				}
+				listData.Length = value
+			}
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		target, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		listData.TargetType = target
+		return &Type{TypeClass: ListType, TypeData: listData}, nil
+	case "map":
+		if err := p.expect("["); err != nil {
+			return nil, err
+		}
+		keyType, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		valueType, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		return &Type{TypeClass: MapType, TypeData: &MapTypeData{KeyType: keyType, ValueType: valueType}}, nil
+	case "chan", "<-":
+		channelData := &ChannelTypeData{Dir: BothDirs}
+		if token == "<-" {
+			if err := p.expect("chan"); err != nil {
+				return nil, err
+			}
+			channelData.Dir = RecvOnly
+		} else if p.peek() == "<-" {
+			p.next()
+			channelData.Dir = SendOnly
+		}
+		var elementType *Type
+		var err error
+		if p.peek() == "(" {
+			// parenthesized element, eg chan (<-chan T)
+			p.next()
+			if elementType, err = p.parseType(); err == nil {
+				err = p.expect(")")
+			}
+		} else {
+			elementType, err = p.parseType()
+		}
+		if err != nil {
+			return nil, err
+		}
+		channelData.ElementType = elementType
+		return &Type{TypeClass: ChannelType, TypeData: channelData}, nil
+	case "func":
+		functionData, err := p.parseFunction()
+		if err != nil {
+			return nil, err
+		}
+		return &Type{TypeClass: FunctionType, TypeData: functionData}, nil
+	case "struct", "interface":
+		return p.parseRecord(token == "interface")
+	case "(":
+		subTypes, err := p.parseTypeList(")")
+		if err != nil {
+			return nil, err
+		}
+		return &Type{TypeClass: TupleType, TypeData: &TupleTypeData{SubTypes: subTypes}}, nil
+	}
+	if !isSignatureName(token) {
+		return nil, p.errorf("unexpected %s", token)
+	}
+	return p.parseNamed(token)
+}
+
+/**
+ * Returns the type (from the library) with a name along with its type
+ * arguments if it is instantiated.
+ */
+func (p *signatureParser) parseNamed(name string) (*Type, error) {
+	var out *Type
+	if index := strings.LastIndex(name, "."); index > 0 {
+		out = p.typeLibrary.GetType(name[:index], name[index+1:])
+	} else if out = p.typeLibrary.GetGlobalType(name); out == nil {
+		if _, ok := types.Universe.Lookup(name).(*types.TypeName); ok {
+			out = p.typeLibrary.AddGlobalType(name)
+		}
+	}
+	if out == nil {
+		return nil, p.errorf("unknown type %s", name)
+	}
+	if p.peek() != "[" {
+		return out, nil
+	}
+	p.next()
+	typeArgs, err := p.parseTypeList("]")
+	if err != nil {
+		return nil, err
+	}
+	return &Type{TypeClass: InstanceType, TypeData: &InstanceTypeData{GenericType: out, TypeArgs: typeArgs}}, nil
+}
+
+/**
+ * Parses types separated by commas till the closing token.
+ */
+func (p *signatureParser) parseTypeList(closing string) ([]*Type, error) {
+	var out []*Type
+	for p.peek() != closing {
+		if len(out) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		t, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	p.next()
+	return out, nil
+}
+
+/**
+ * Parses the parameters and results of a function.
+ */
+func (p *signatureParser) parseFunction() (*FunctionTypeData, error) {
+	out := &FunctionTypeData{}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for p.peek() != ")" {
+		if len(out.InputTypes) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		if out.IsVariadic {
+			return nil, p.errorf("only the last parameter can be variadic")
+		}
+		out.IsVariadic = p.peek() == "..."
+		if out.IsVariadic {
+			p.next()
+		}
+		t, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if out.IsVariadic {
+			t = &Type{TypeClass: ListType, TypeData: &ListTypeData{TargetType: t}}
+		}
+		out.InputTypes = append(out.InputTypes, t)
+	}
+	p.next()
+
+	switch next := p.peek(); {
+	case next == "(":
+		p.next()
+		outputTypes, err := p.parseTypeList(")")
+		if err != nil {
+			return nil, err
+		}
+		out.OutputTypes = outputTypes
+	case next == "*" || next == "[" || next == "<-" || (isSignatureName(next) && next != "throws"):
+		outputType, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		out.OutputTypes = []*Type{outputType}
+	}
+	if p.peek() == "throws" {
+		p.next()
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		exceptionTypes, err := p.parseTypeList(")")
+		if err != nil {
+			return nil, err
+		}
+		out.ExceptionTypes = exceptionTypes
+	}
+	return out, nil
+}
+
+/**
+ * Parses the fields (or methods) of an anonymous struct (or interface).
+ */
+func (p *signatureParser) parseRecord(isInterface bool) (*Type, error) {
+	out := &RecordTypeData{IsInterface: isInterface}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for p.peek() != "}" {
+		if len(out.Fields) > 0 {
+			if err := p.expect(";"); err != nil {
+				return nil, err
+			}
+		}
+		field := &Field{}
+		var err error
+		if isInterface && isSignatureName(p.peek()) && p.peekAt(1) == "(" {
+			// a method
+			field.Name = p.next()
+			functionData, err := p.parseFunction()
+			if err != nil {
+				return nil, err
+			}
+			field.Type = &Type{TypeClass: FunctionType, TypeData: functionData}
+		} else if isInterface {
+			// an embedded interface or type set
+			field.Type, err = p.parseUnion()
+		} else if next := p.peekAt(1); isSignatureName(p.peek()) && next != ";" && next != "}" &&
+			next != "" && next[0] != '"' && next[0] != '`' && !p.isTypeArgs() {
+			field.Name = p.next()
+			field.Type, err = p.parseType()
+		} else {
+			// an embedded type
+			field.Type, err = p.parseType()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if next := p.peek(); next != "" && (next[0] == '"' || next[0] == '`') {
+			field.Tag, _ = strconv.Unquote(p.next())
+		}
+		if field.Name == "" {
+			out.Bases = append(out.Bases, field.Type)
+		}
+		out.Fields = append(out.Fields, field)
+	}
+	p.next()
+	return &Type{TypeClass: RecordType, TypeData: out}, nil
+}
+
+/**
+ * Tells if the name about to be parsed is followed by type arguments
+ * (instead of being a field name followed by a slice or array type).
+ */
+func (p *signatureParser) isTypeArgs() bool {
+	if p.peekAt(1) != "[" {
+		return false
+	}
+	next := p.peekAt(2)
+	if next == "]" || next == "..." {
+		return false
+	}
+	_, err := strconv.Atoi(next)
+	return err != nil
+}
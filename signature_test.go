@@ -0,0 +1,82 @@
+package bridge
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestSignatures(c *C) {
+	_, typeLibrary := parseTestSource(c, `package test
+
+type ID string
+
+type IDAlias = ID
+
+type Page[T any] struct {
+	Items []T
+}
+
+type Record struct {
+	Id       ID "json:\"id\""
+	Tuple    [4]IDAlias
+	Callback func(ID, ...int) (string, error)
+	Done     func() error
+	Anon     struct{ Name string }
+	Any      interface{}
+	Methods  interface{ Close() error }
+	Updates  chan<- map[string]*Page[ID]
+	Streams  chan (<-chan ID)
+	Sinks    chan<- chan ID
+}
+`)
+	record := typeLibrary.GetType("example.com/test", "Record").AsRecordType()
+	expected := []string{
+		"example.com/test.ID",
+		"[4]example.com/test.ID",
+		"func(example.com/test.ID, ...int) (string, error)",
+		"func() error",
+		"struct{Name string}",
+		"interface{}",
+		"interface{Close() error}",
+		"chan<- map[string]*example.com/test.Page[example.com/test.ID]",
+		"chan (<-chan example.com/test.ID)",
+		"chan<- chan example.com/test.ID",
+	}
+	for index, field := range record.Fields {
+		sig := typeLibrary.Signature(field.Type)
+		c.Assert(sig, Equals, expected[index])
+
+		// signatures can be parsed back into the same types
+		parsed, err := typeLibrary.ParseSignature(sig)
+		c.Assert(err, IsNil)
+		c.Assert(typeLibrary.Signature(parsed), Equals, sig)
+	}
+	c.Assert(typeLibrary.Signature(typeLibrary.GetType("example.com/test", "Record")), Equals, "example.com/test.Record")
+
+	// named types are those in the library (by import path or short name)
+	id, err := typeLibrary.ParseSignature("example.com/test.ID")
+	c.Assert(err, IsNil)
+	c.Assert(id, Equals, typeLibrary.GetType("example.com/test", "ID"))
+	ids, err := typeLibrary.ParseSignature("[] test.ID")
+	c.Assert(err, IsNil)
+	c.Assert(ids.AsListType().TargetType, Equals, id)
+	rune, err := typeLibrary.ParseSignature("rune")
+	c.Assert(err, IsNil)
+	c.Assert(rune, Equals, typeLibrary.GetGlobalType("rune"))
+
+	// anonymous records with tags and embedded fields
+	anon, err := typeLibrary.ParseSignature(`struct{Id string "json:\"id\""; *example.com/test.Record}`)
+	c.Assert(err, IsNil)
+	anonRecord := anon.AsRecordType()
+	c.Assert(anonRecord.IsInterface, Equals, false)
+	c.Assert(anonRecord.Fields[0].Tag, Equals, `json:"id"`)
+	c.Assert(anonRecord.Fields[1].Name, Equals, "")
+	c.Assert(len(anonRecord.Bases), Equals, 1)
+	constraint, err := typeLibrary.ParseSignature("interface{~int | ~string}")
+	c.Assert(err, IsNil)
+	c.Assert(len(constraint.AsRecordType().Bases[0].AsUnionType().Terms), Equals, 2)
+
+	for _, sig := range []string{"example.com/test.Missing", "Missing", "map[string", "[]", "func(...int, string)", "int int", "[x]int"} {
+		_, err := typeLibrary.ParseSignature(sig)
+		c.Assert(err, NotNil, Commentf("%s", sig))
+	}
+}
@@ -0,0 +1,160 @@
+package bridge
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"text/template"
+)
+
+/**
+ * Errors raised when loading or executing a template.
+ */
+type TemplateError struct {
+	// Name of the template
+	Name string
+
+	// Line (and column) within the template where the error occurred if
+	// known (0 otherwise)
+	Line   int
+	Column int
+
+	Err error
+}
+
+func (e *TemplateError) Error() string {
+	if e.Line > 0 && e.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", e.Name, e.Line, e.Column, e.Message())
+	} else if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.Name, e.Line, e.Message())
+	}
+	return fmt.Sprintf("%s: %s", e.Name, e.Message())
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// Errors from text/template look like:
+//
+//	template: name.gen:12: unexpected "}" in operand
+//	template: name.gen:12:5: executing "name.gen" at <.Foo>: can't evaluate field Foo
+var templateErrorRegex = regexp.MustCompile(`^template: ([^:]*):(\d+):(?:(\d+):)? (.*)$`)
+
+/**
+ * Returns the message of the underlying error without the location
+ * information already captured in the TemplateError.
+ */
+func (e *TemplateError) Message() string {
+	if matches := templateErrorRegex.FindStringSubmatch(e.Err.Error()); matches != nil {
+		return matches[4]
+	}
+	return e.Err.Error()
+}
+
+func NewTemplateError(name string, err error) *TemplateError {
+	if templateErr, ok := err.(*TemplateError); ok {
+		return templateErr
+	}
+	out := &TemplateError{Name: name, Err: err}
+	if matches := templateErrorRegex.FindStringSubmatch(err.Error()); matches != nil {
+		out.Name = matches[1]
+		out.Line, _ = strconv.Atoi(matches[2])
+		out.Column, _ = strconv.Atoi(matches[3])
+	}
+	return out
+}
+
+/**
+ * A registry of templates that parses each template only once.  Registries
+ * are safe to be used from multiple go routines.
+ */
+type TemplateRegistry struct {
+	// Where templates are loaded from.  If this is nil then template names
+	// are paths to the template files.
+	fsys fs.FS
+
+	// Functions available to the templates
+	funcs template.FuncMap
+
+	mutex     sync.Mutex
+	templates map[string]*templateEntry
+}
+
+type templateEntry struct {
+	once     sync.Once
+	template *template.Template
+	err      error
+}
+
+/**
+ * Creates a registry that loads templates from a file system.  If the file
+ * system is nil then templates are loaded from paths on disk.
+ */
+func NewTemplateRegistry(fsys fs.FS, funcs template.FuncMap) *TemplateRegistry {
+	return &TemplateRegistry{fsys: fsys, funcs: funcs, templates: make(map[string]*templateEntry)}
+}
+
+/**
+ * Returns the parsed template with the given name, parsing it on first use.
+ */
+func (r *TemplateRegistry) Lookup(name string) (*template.Template, error) {
+	r.mutex.Lock()
+	entry := r.templates[name]
+	if entry == nil {
+		entry = &templateEntry{}
+		r.templates[name] = entry
+	}
+	r.mutex.Unlock()
+
+	entry.once.Do(func() {
+		entry.template, entry.err = r.parse(name)
+	})
+	return entry.template, entry.err
+}
+
+func (r *TemplateRegistry) parse(name string) (*template.Template, error) {
+	templ := template.New(filepath.Base(name))
+	if r.funcs != nil {
+		templ = templ.Funcs(r.funcs)
+	}
+	var err error
+	if r.fsys == nil {
+		templ, err = templ.ParseFiles(name)
+	} else {
+		templ, err = templ.ParseFS(r.fsys, name)
+	}
+	if err != nil {
+		return nil, NewTemplateError(name, err)
+	}
+	return templ, nil
+}
+
+/**
+ * Renders the template with the given name.
+ */
+func (r *TemplateRegistry) Render(writer io.Writer, name string, context interface{}) error {
+	templ, err := r.Lookup(name)
+	if err != nil {
+		return err
+	}
+	if err = templ.Execute(writer, context); err != nil {
+		return NewTemplateError(name, err)
+	}
+	return nil
+}
+
+// Registry for templates loaded by their paths.
+var fileTemplates = NewTemplateRegistry(nil, nil)
+
+func LoadTemplate(templatePath string) (*template.Template, error) {
+	return fileTemplates.Lookup(templatePath)
+}
+
+func RenderTemplate(writer io.Writer, templatePath string, context interface{}) error {
+	return fileTemplates.Render(writer, templatePath, context)
+}
@@ -0,0 +1,61 @@
+package bridge
+
+import (
+	"bytes"
+	. "gopkg.in/check.v1"
+	"sync"
+	"testing/fstest"
+)
+
+var testTemplates = fstest.MapFS{
+	"hello.gen":      &fstest.MapFile{Data: []byte("Hello {{.Name}}!")},
+	"badparse.gen":   &fstest.MapFile{Data: []byte("line1\nline2 {{ if }}\n")},
+	"badexecute.gen": &fstest.MapFile{Data: []byte("line1\nline2\n  {{ .Missing.Field }}\n")},
+}
+
+func (s *TestSuite) TestTemplateRegistryCaches(c *C) {
+	registry := NewTemplateRegistry(testTemplates, nil)
+	t1, err := registry.Lookup("hello.gen")
+	c.Assert(err, IsNil)
+	t2, err := registry.Lookup("hello.gen")
+	c.Assert(err, IsNil)
+	c.Assert(t1, Equals, t2)
+}
+
+func (s *TestSuite) TestTemplateRegistryConcurrentRender(c *C) {
+	registry := NewTemplateRegistry(testTemplates, nil)
+	var wg sync.WaitGroup
+	outputs := make([]string, 20)
+	for i := range outputs {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			buffer := bytes.NewBuffer(nil)
+			registry.Render(buffer, "hello.gen", map[string]string{"Name": "World"})
+			outputs[index] = buffer.String()
+		}(i)
+	}
+	wg.Wait()
+	for _, output := range outputs {
+		c.Assert(output, Equals, "Hello World!")
+	}
+}
+
+func (s *TestSuite) TestTemplateErrors(c *C) {
+	registry := NewTemplateRegistry(testTemplates, nil)
+	err := registry.Render(bytes.NewBuffer(nil), "badparse.gen", nil)
+	templateErr, ok := err.(*TemplateError)
+	c.Assert(ok, Equals, true)
+	c.Assert(templateErr.Name, Equals, "badparse.gen")
+	c.Assert(templateErr.Line, Equals, 2)
+
+	err = registry.Render(bytes.NewBuffer(nil), "badexecute.gen", struct{}{})
+	templateErr, ok = err.(*TemplateError)
+	c.Assert(ok, Equals, true)
+	c.Assert(templateErr.Line, Equals, 3)
+	c.Assert(templateErr.Column, Equals, 13)
+	c.Assert(err, ErrorMatches, `badexecute.gen:3:13: executing "badexecute.gen" at <.Missing.Field>: can't evaluate field Missing in type struct {}`)
+
+	err = registry.Render(bytes.NewBuffer(nil), "missing.gen", nil)
+	c.Assert(err, ErrorMatches, "missing.gen: .*")
+}
@@ -2,39 +2,89 @@ package bridge
 
 import (
 	"fmt"
+	"go/token"
+	"go/types"
 	"log"
-	"path/filepath"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 )
 
-type ITypeLibrary interface {
+/**
+ * The types in a library by package and name.
+ */
+type TypeStore interface {
 	AddType(pkg string, name string, t *Type) (alt *Type)
 	GetType(pkg string, name string) *Type
+	RemoveType(pkg string, name string) *Type
 	AddGlobalType(name string) (alt *Type)
 	GetGlobalType(name string) (alt *Type)
+	ForEach(func(string, *Type, *bool))
+}
 
-	// Package related API
+/**
+ * The packages in a library and the (unique) short names they are
+ * imported as.
+ */
+type PackageRegistry interface {
 	AddPackage(name string) (shortName string)
-	ForEach(func(string, *Type, *bool))
+	SetShortName(pkg string, shortName string) error
+	ReserveShortNames(names ...string)
 	PackageByShortName(name string) string
 	ShortNameForPackage(pkg string) string
+	Packages() []string
+}
 
-	// Signature string creation
+/**
+ * Printing (and parsing) the signatures of types.
+ */
+type SignaturePrinter interface {
 	Signature(t *Type) string
+	TypeString(t *Type, qualifier func(pkg string) string) string
+	ParseSignature(sig string) (*Type, error)
 	TypeListSignature(types []*Type, argfmt string) string
+	TypeParamsSignature(t *Type) string
+}
 
-	// General visitors
-	// TODO: move this out of this fat interface
+/**
+ * Questions about the types in a library.
+ */
+type TypeQueries interface {
+	TypesInPackage(pkg string) []*Type
+	FindTypes(predicate func(key string, t *Type) bool) []*Type
+	MatchTypes(pattern string) ([]*Type, error)
+	ServiceTypes() []*Type
+	ReferencesTo(t *Type, transitive bool) []*Type
+	Implementations(iface *Type) []*Type
 	TransitiveClosureFrom(startType *Type, filter func(t *Type) bool) ([]*Type, []string)
 }
 
+type ITypeLibrary interface {
+	TypeStore
+	PackageRegistry
+	SignaturePrinter
+	TypeQueries
+}
+
+/**
+ * A TypeLibrary is safe for concurrent use (eg by files being processed in
+ * parallel).
+ */
 type TypeLibrary struct {
+	// Guards all the fields below
+	mutex sync.RWMutex
+
 	types       map[string]*Type
 	typeCounter int64
 
 	// Package related API
 	shortNamesForPkg map[string]string
 	pkgByShortName   map[string]string
-	pkgCounter       int
+
+	// Names that are not to be used as short names of packages
+	reservedShortNames map[string]bool
 }
 
 func NewTypeLibrary() *TypeLibrary {
@@ -42,6 +92,7 @@ func NewTypeLibrary() *TypeLibrary {
 	out := TypeLibrary{}
 	out.pkgByShortName = make(map[string]string)
 	out.shortNamesForPkg = make(map[string]string)
+	out.reservedShortNames = make(map[string]bool)
 
 	log.Println("Creating new type library... ")
 	out.types = make(map[string]*Type)
@@ -49,12 +100,31 @@ func NewTypeLibrary() *TypeLibrary {
 }
 
 /**
- * Returns all the types as a list.
+ * Calls a function with each type (and its key) in the library ordered by
+ * package and then by name.  The types are those in the library when
+ * ForEach is called so the function can add (or remove) types.
  */
 func (tl *TypeLibrary) ForEach(mapFunc func(string, *Type, *bool)) {
-	for k, v := range tl.types {
+	type entry struct {
+		pkg, name, key string
+		t              *Type
+	}
+	tl.mutex.RLock()
+	entries := make([]entry, 0, len(tl.types))
+	for key, t := range tl.types {
+		index := strings.LastIndex(key, ".")
+		entries = append(entries, entry{key[:index], key[index+1:], key, t})
+	}
+	tl.mutex.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].pkg != entries[j].pkg {
+			return entries[i].pkg < entries[j].pkg
+		}
+		return entries[i].name < entries[j].name
+	})
+	for _, entry := range entries {
 		stop := false
-		mapFunc(k, v, &stop)
+		mapFunc(entry.key, entry.t, &stop)
 		if stop {
 			return
 		}
@@ -72,10 +142,13 @@ func (tl *TypeLibrary) GetGlobalType(name string) (alt *Type) {
 /**
  * Adds a type to the type system.  If the type already exists then
  * the existing one is returned otherwise a new type is added and returned.
- * Also the type's ID will be set.
+ * Also the type's ID will be set.  Checking for and adding the type is
+ * atomic so concurrent callers adding the same type get the same one back.
  */
 func (tl *TypeLibrary) AddType(pkg string, name string, t *Type) (alt *Type) {
-	tl.AddPackage(pkg)
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+	tl.addPackage(pkg)
 	key := pkg + "." + name
 	if value, ok := tl.types[key]; ok {
 		return value
@@ -86,43 +159,137 @@ func (tl *TypeLibrary) AddType(pkg string, name string, t *Type) (alt *Type) {
 }
 
 func (tl *TypeLibrary) GetType(pkg string, name string) *Type {
+	tl.mutex.RLock()
+	defer tl.mutex.RUnlock()
 	key := pkg + "." + name
 	t := tl.types[key]
 	if t == nil {
 		// perhaps we are passing in the short name instead
-		key := tl.PackageByShortName(pkg) + "." + name
+		key := tl.pkgByShortName[pkg] + "." + name
 		t = tl.types[key]
 	}
 	return t
 }
 
+/**
+ * Removes a type from the library and returns it (or nil if there was no
+ * such type).
+ */
+func (tl *TypeLibrary) RemoveType(pkg string, name string) *Type {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+	key := pkg + "." + name
+	t := tl.types[key]
+	delete(tl.types, key)
+	return t
+}
+
+/**
+ * Adds a package and returns its short name, ie the name it is imported as
+ * in generated code.  Short names are unique valid identifiers that are
+ * neither keywords, predeclared identifiers nor reserved names.  The name
+ * the package is imported as by default is preferred (eg "d" for a/b/c/d)
+ * followed by it prefixed with its parent folders (eg "cd" then "bcd") and
+ * then numbered (eg "d2").
+ */
 func (tl *TypeLibrary) AddPackage(pkg string) (shortName string) {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+	return tl.addPackage(pkg)
+}
+
+func (tl *TypeLibrary) addPackage(pkg string) (shortName string) {
+	if pkg == "" {
+		// globals are not qualified
+		return ""
+	}
 	if value, ok := tl.shortNamesForPkg[pkg]; ok {
 		return value
 	}
 	log.Println("Adding Package: ", pkg)
 
-	// create a name and return it (and save it ofcourse)
-	name := ""
-	tmppkg := pkg
-	for tmppkg != "" {
-		name := filepath.Base(tmppkg) + name
-		if _, ok := tl.shortNamesForPkg[tmppkg]; !ok {
-			tl.shortNamesForPkg[tmppkg] = name
-			tl.pkgByShortName[name] = tmppkg
-			return name
-		}
-		tmppkg = filepath.Dir(tmppkg)
+	name := identifierFor(ImportName(pkg))
+	if name == "" {
+		name = "pkg"
+	}
+	shortName = name
+	for parent := path.Dir(pkg); !tl.isShortNameAvailable(shortName) && parent != "." && parent != "/"; parent = path.Dir(parent) {
+		shortName = identifierFor(path.Base(parent)) + shortName
+	}
+	for counter := 2; !tl.isShortNameAvailable(shortName); counter++ {
+		shortName = name + strconv.Itoa(counter)
+	}
+	tl.shortNamesForPkg[pkg] = shortName
+	tl.pkgByShortName[shortName] = pkg
+	return shortName
+}
+
+/**
+ * Pins the short name of a package.  This fails if the name is not a
+ * valid (non reserved) identifier or is the short name of another package.
+ */
+func (tl *TypeLibrary) SetShortName(pkg string, shortName string) error {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+	if existing, ok := tl.pkgByShortName[shortName]; ok && existing == pkg {
+		return nil
+	} else if ok {
+		return fmt.Errorf("short name %s of package %s is already used by %s", shortName, pkg, existing)
 	}
+	if !tl.isShortNameAvailable(shortName) {
+		return fmt.Errorf("invalid short name %s for package %s", shortName, pkg)
+	}
+	if existing, ok := tl.shortNamesForPkg[pkg]; ok {
+		delete(tl.pkgByShortName, existing)
+	}
+	tl.shortNamesForPkg[pkg] = shortName
+	tl.pkgByShortName[shortName] = pkg
+	return nil
+}
+
+/**
+ * Reserves names (eg those already used in the generated code) so that
+ * they are not used as short names of packages added after this.
+ */
+func (tl *TypeLibrary) ReserveShortNames(names ...string) {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+	if tl.reservedShortNames == nil {
+		tl.reservedShortNames = make(map[string]bool)
+	}
+	for _, name := range names {
+		tl.reservedShortNames[name] = true
+	}
+}
 
-	// return a random name!
-	name = fmt.Sprintf("pkg%d", tl.pkgCounter)
-	tl.shortNamesForPkg[pkg] = name
-	tl.pkgByShortName[name] = pkg
-	return name
+func (tl *TypeLibrary) isShortNameAvailable(name string) bool {
+	if !token.IsIdentifier(name) || name == "_" || types.Universe.Lookup(name) != nil || tl.reservedShortNames[name] {
+		return false
+	}
+	_, used := tl.pkgByShortName[name]
+	return !used
+}
+
+/**
+ * Returns an identifier made of the letters, digits and underscores in a
+ * string (prefixed with "p" if it would otherwise start with a digit).
+ */
+func identifierFor(value string) string {
+	out := strings.Map(func(ch rune) rune {
+		if ch == '_' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ('0' <= ch && ch <= '9') {
+			return ch
+		}
+		return -1
+	}, value)
+	if out != "" && out[0] >= '0' && out[0] <= '9' {
+		out = "p" + out
+	}
+	return out
 }
 
 func (tl *TypeLibrary) PackageByShortName(name string) string {
+	tl.mutex.RLock()
+	defer tl.mutex.RUnlock()
 	if value, ok := tl.pkgByShortName[name]; ok {
 		return value
 	}
@@ -130,65 +297,45 @@ func (tl *TypeLibrary) PackageByShortName(name string) string {
 }
 
 func (tl *TypeLibrary) ShortNameForPackage(pkg string) string {
+	tl.mutex.RLock()
+	defer tl.mutex.RUnlock()
 	if value, ok := tl.shortNamesForPkg[pkg]; ok {
 		return value
 	}
 	return ""
 }
 
+/**
+ * Returns the canonical signature of a type (see TypeString).  Signatures
+ * of different types are different (except for aliases which have the
+ * signatures of their targets) so they can be used as keys for types and
+ * can be parsed back with ParseSignature.
+ */
 func (tl *TypeLibrary) Signature(t *Type) string {
-	switch t.TypeClass {
-	case NullType:
+	return tl.TypeString(t, nil)
+}
+
+/**
+ * Returns the type parameters (with their constraints) of a generic type,
+ * eg "[K comparable, V any]" (or "" if the type is not generic).
+ */
+func (tl *TypeLibrary) TypeParamsSignature(t *Type) string {
+	params := t.TypeParams()
+	if len(params) == 0 {
 		return ""
-	case UnresolvedType:
-		return t.TypeData.(string)
-	case NamedType:
-		data := t.TypeData.(*NamedTypeData)
-		out := data.Name
-		if data.Package != "" {
-			out = data.Package + "." + out
-		}
-		return out
-	case AliasType:
-		return t.TypeData.(string)
-	case ReferenceType:
-		return "*" + tl.Signature(t.TypeData.(*ReferenceTypeData).TargetType)
-	case RecordType:
-		recordType := t.TypeData.(*RecordTypeData)
-		if recordType.Name == "" {
-			return "interface{}"
-		}
-		if recordType.Package == "" {
-			return recordType.Name
-		} else {
-			return tl.ShortNameForPackage(recordType.Package) + "." + recordType.Name
-		}
-	case TupleType:
-		out := "("
-		for index, childType := range t.TypeData.(*TupleTypeData).SubTypes {
-			if index > 0 {
-				out += ", "
-			}
-			out += tl.Signature(childType)
-		}
-		return out
-	case FunctionType:
-		funcTypeData := t.TypeData.(*FunctionTypeData)
-		out := "func (" + tl.TypeListSignature(funcTypeData.InputTypes, "") + ")"
-		if funcTypeData.OutputTypes != nil {
-			out += "(" + tl.TypeListSignature(funcTypeData.OutputTypes, "") + ")"
+	}
+	out := "["
+	for index, param := range params {
+		if index > 0 {
+			out += ", "
 		}
-		if funcTypeData.ExceptionTypes != nil {
-			out += " throws (" + tl.TypeListSignature(funcTypeData.ExceptionTypes, "") + ")"
+		paramData := param.TypeData.(*TypeParamData)
+		out += paramData.Name
+		if paramData.Constraint != nil {
+			out += " " + tl.Signature(paramData.Constraint)
 		}
-		return out
-	case ListType:
-		return "[]" + tl.Signature(t.TypeData.(*ListTypeData).TargetType)
-	case MapType:
-		mapTypeData := t.TypeData.(*MapTypeData)
-		return "map[" + tl.Signature(mapTypeData.KeyType) + "]" + tl.Signature(mapTypeData.ValueType)
 	}
-	return ""
+	return out + "]"
 }
 
 func (tl *TypeLibrary) TypeListSignature(types []*Type, argfmt string) string {
@@ -196,68 +343,37 @@ func (tl *TypeLibrary) TypeListSignature(types []*Type, argfmt string) string {
 	if types != nil {
 		for index, inType := range types {
 			if index > 0 {
-				out += ","
+				out += ", "
+			}
+			if argfmt != "" {
+				out += fmt.Sprintf(argfmt, index) + " "
 			}
-			out += fmt.Sprintf(argfmt, index) + " "
 			out += tl.Signature(inType)
 		}
 	}
 	return out
 }
 
+/**
+ * Returns the types (with unique signatures) reachable from a type for
+ * which a filter is true along with the packages of these types.
+ */
 func (tl *TypeLibrary) TransitiveClosureFrom(startType *Type, filter func(t *Type) bool) ([]*Type, []string) {
 	sigVisited := make(map[string]bool)
-	typeVisited := make(map[*Type]bool)
 	uniqueTypes := make([]*Type, 0, 100)
-	stack := []*Type{startType}
-	stackLen := len(stack)
-
-	addType := func(t *Type) {
-		if !typeVisited[t] {
-			typeVisited[t] = true
+	WalkType(startType, &TypeHooks{
+		EnterAny: func(t *Type, walker *TypeWalker) bool {
 			sig := tl.Signature(t)
-			if !sigVisited[sig] {
-				sigVisited[sig] = true
-				stack = append(stack, t)
+			if sigVisited[sig] {
+				return false
 			}
-		}
-	}
-
-	for stackLen > 0 {
-		currType := stack[stackLen-1]
-		stack = stack[:stackLen-1]
-		if filter(currType) {
-			uniqueTypes = append(uniqueTypes, currType)
-		}
-		// see if we have any child types to visit
-		switch typeData := currType.TypeData.(type) {
-		case *AliasTypeData:
-			addType(typeData.TargetType)
-		case *ReferenceTypeData:
-			addType(typeData.TargetType)
-		case *RecordTypeData:
-			for _, field := range typeData.Fields {
-				addType(field.Type)
+			sigVisited[sig] = true
+			if filter(t) {
+				uniqueTypes = append(uniqueTypes, t)
 			}
-		case *TupleTypeData:
-			for _, childType := range typeData.SubTypes {
-				addType(childType)
-			}
-		case *FunctionTypeData:
-			for _, childType := range typeData.InputTypes {
-				addType(childType)
-			}
-			for _, childType := range typeData.OutputTypes {
-				addType(childType)
-			}
-		case *ListTypeData:
-			addType(typeData.TargetType)
-		case *MapTypeData:
-			addType(typeData.KeyType)
-			addType(typeData.ValueType)
-		}
-		stackLen = len(stack)
-	}
+			return true
+		},
+	})
 
 	pkgVisited := make(map[string]bool)
 	uniquePackages := make([]string, 0, 100)
@@ -2,6 +2,9 @@ package bridge
 
 import (
 	"fmt"
+	"go/token"
+	"reflect"
+	"strings"
 )
 
 const (
@@ -15,6 +18,19 @@ const (
 	FunctionType
 	ListType
 	MapType
+	TypeParamType
+	InstanceType
+	UnionType
+	ChannelType
+)
+
+/**
+ * Directions of channel types.
+ */
+const (
+	BothDirs = iota
+	SendOnly
+	RecvOnly
 )
 
 type Type struct {
@@ -46,6 +62,14 @@ func (t *Type) TypeClassString() string {
 		return "ListType"
 	case MapType:
 		return "MapType"
+	case TypeParamType:
+		return "TypeParamType"
+	case InstanceType:
+		return "InstanceType"
+	case UnionType:
+		return "UnionType"
+	case ChannelType:
+		return "ChannelType"
 	}
 	return ""
 }
@@ -54,11 +78,17 @@ func (t *Type) TypeClassString() string {
  * Tells if the value will be passed by value or by reference.
  */
 func (t *Type) IsValueType() bool {
-	if t.TypeClass == ReferenceType || t.TypeClass == ListType ||
-		t.TypeClass == MapType || t.TypeClass == FunctionType {
+	if t.TypeClass == ListType {
+		// arrays are copied where as slices are not
+		listData, ok := t.TypeData.(*ListTypeData)
+		return ok && listData.IsArray
+	} else if t.TypeClass == ReferenceType || t.TypeClass == MapType ||
+		t.TypeClass == FunctionType || t.TypeClass == ChannelType {
 		return false
 	} else if t.TypeClass == AliasType {
 		return t.AsAliasType().TargetType.IsValueType()
+	} else if t.TypeClass == InstanceType {
+		return t.AsInstanceType().GenericType.IsValueType()
 	} else if t.TypeClass == NamedType || t.TypeClass == RecordType {
 		return true
 	}
@@ -75,6 +105,10 @@ func (t *Type) IsRecordType() bool     { return t.TypeClass == RecordType }
 func (t *Type) IsFunctionType() bool   { return t.TypeClass == FunctionType }
 func (t *Type) IsListType() bool       { return t.TypeClass == ListType }
 func (t *Type) IsMapType() bool        { return t.TypeClass == MapType }
+func (t *Type) IsTypeParamType() bool  { return t.TypeClass == TypeParamType }
+func (t *Type) IsInstanceType() bool   { return t.TypeClass == InstanceType }
+func (t *Type) IsUnionType() bool      { return t.TypeClass == UnionType }
+func (t *Type) IsChannelType() bool    { return t.TypeClass == ChannelType }
 
 func (t *Type) AsNamedType() *NamedTypeData         { return t.TypeData.(*NamedTypeData) }
 func (t *Type) AsAliasType() *AliasTypeData         { return t.TypeData.(*AliasTypeData) }
@@ -84,17 +118,26 @@ func (t *Type) AsRecordType() *RecordTypeData       { return t.TypeData.(*Record
 func (t *Type) AsFunctionType() *FunctionTypeData   { return t.TypeData.(*FunctionTypeData) }
 func (t *Type) AsListType() *ListTypeData           { return t.TypeData.(*ListTypeData) }
 func (t *Type) AsMapType() *MapTypeData             { return t.TypeData.(*MapTypeData) }
+func (t *Type) AsTypeParamType() *TypeParamData     { return t.TypeData.(*TypeParamData) }
+func (t *Type) AsInstanceType() *InstanceTypeData   { return t.TypeData.(*InstanceTypeData) }
+func (t *Type) AsUnionType() *UnionTypeData         { return t.TypeData.(*UnionTypeData) }
+func (t *Type) AsChannelType() *ChannelTypeData     { return t.TypeData.(*ChannelTypeData) }
 
 func (t *Type) LeafType() *NamedTypeData {
 	switch typeData := t.TypeData.(type) {
 	case *NamedTypeData:
 		return typeData
 	case *AliasTypeData:
-		return typeData.TargetType.LeafType()
+		if typeData.IsAlias {
+			return typeData.TargetType.LeafType()
+		}
+		return &typeData.NamedTypeData
 	case *ReferenceTypeData:
 		return typeData.TargetType.LeafType()
 	case *RecordTypeData:
 		return &typeData.NamedTypeData
+	case *InstanceTypeData:
+		return typeData.GenericType.LeafType()
 	}
 	return nil
 }
@@ -112,10 +155,26 @@ type NamedTypeData struct {
 	Package string
 }
 
+/**
+ * A named type declared in terms of another (non struct/interface) type.
+ * This covers both defined types (eg "type ID string") and aliases (eg
+ * "type A = B").
+ */
 type AliasTypeData struct {
+	NamedTypeData
+
 	// Type this is an alias/typedef for
-	Name       string
 	TargetType *Type
+
+	// Aliases are identical to their target type where as defined types
+	// are distinct types that only share the target's underlying type
+	IsAlias bool
+
+	// Type parameters (of TypeParamType) if this is a generic type
+	TypeParams []*Type
+
+	// Methods declared on the type (if it is not an alias)
+	Methods []*Method
 }
 
 type ReferenceTypeData struct {
@@ -132,6 +191,28 @@ type MapTypeData struct {
 type ListTypeData struct {
 	// The target type this is an array of
 	TargetType *Type
+
+	// Whether this is a fixed size array (eg [4]int) instead of a slice
+	IsArray bool
+
+	// Number of elements in an array (-1 if it could not be evaluated)
+	Length int
+}
+
+type ChannelTypeData struct {
+	// Type of the values sent over the channel
+	ElementType *Type
+
+	// One of BothDirs, SendOnly or RecvOnly
+	Dir int
+}
+
+func (td *ChannelTypeData) CanSend() bool {
+	return td.Dir != RecvOnly
+}
+
+func (td *ChannelTypeData) CanRecv() bool {
+	return td.Dir != SendOnly
 }
 
 type TupleTypeData struct {
@@ -144,6 +225,20 @@ type RecordTypeData struct {
 	// Type of each member in the struct
 	Bases  []*Type
 	Fields []*Field
+
+	// Type parameters (of TypeParamType) if this is a generic type
+	TypeParams []*Type
+
+	// Whether this is an interface (whose fields are its methods) instead
+	// of a struct
+	IsInterface bool
+
+	// Methods declared on the type (if it is a struct)
+	Methods []*Method
+
+	// Doc comment and location of the declaration (if known)
+	Doc      string
+	Position token.Position
 }
 
 func (td *RecordTypeData) NumFields() int {
@@ -157,6 +252,72 @@ func (td *RecordTypeData) NumBases() int {
 type Field struct {
 	Name string
 	Type *Type
+
+	// The (unquoted) tag of a struct field, eg json:"id,omitempty"
+	Tag string
+
+	// Doc comment and location of the field (if known)
+	Doc      string
+	Position token.Position
+}
+
+/**
+ * A method declared on a named type, eg:
+ *
+ * 	func (u *User) FullName() string
+ */
+type Method struct {
+	Name string
+
+	// The function type of the method (without the receiver)
+	Type *Type
+
+	// Whether the receiver is a pointer (so the method is only in the
+	// method set of pointers to the type)
+	PointerReceiver bool
+
+	// Doc comment and location of the method
+	Doc      string
+	Position token.Position
+}
+
+/**
+ * Returns the value of a key in the tag of the field (eg the value of json
+ * in json:"id,omitempty") and whether the key is present.
+ */
+func (f *Field) TagValue(key string) (string, bool) {
+	return reflect.StructTag(f.Tag).Lookup(key)
+}
+
+/**
+ * Returns the name of the field in json (as per its json tag) and whether
+ * it is to be omitted when empty.  The name is empty if the field is not
+ * to be serialized (ie it is tagged with json:"-").  Embedded fields are
+ * named after their types but encoding/json only writes them under that name
+ * if they are not structs (see rest.JsonFields for how structs are
+ * flattened).
+ */
+func (f *Field) JsonName() (string, bool) {
+	value, _ := f.TagValue("json")
+	if value == "-" {
+		return "", false
+	}
+	options := strings.Split(value, ",")
+	name := options[0]
+	omitEmpty := false
+	for _, option := range options[1:] {
+		omitEmpty = omitEmpty || option == "omitempty"
+	}
+	if name == "" {
+		name = f.Name
+		if name == "" {
+			// embedded fields are named after their types
+			if leafType := f.Type.LeafType(); leafType != nil {
+				name = leafType.Name
+			}
+		}
+	}
+	return name, omitEmpty
 }
 
 type FunctionTypeData struct {
@@ -168,6 +329,56 @@ type FunctionTypeData struct {
 
 	// Types of possible exceptions that can be thrown (not supported in all languages)
 	ExceptionTypes []*Type
+
+	// Names of the input and output parameters (empty for unnamed ones).
+	// These are either nil or have as many entries as the types.
+	InputNames  []string
+	OutputNames []string
+
+	// Whether the last input is variadic (eg ...string) in which case its
+	// type is a list of the element type
+	IsVariadic bool
+
+	// Doc comment and location of the method (or function type) declaring
+	// this function (if known)
+	Doc      string
+	Position token.Position
+}
+
+/**
+ * Returns the name of an input parameter (or "" if it is unnamed).
+ */
+func (td *FunctionTypeData) InputName(index int) string {
+	if index < len(td.InputNames) {
+		return td.InputNames[index]
+	}
+	return ""
+}
+
+/**
+ * Returns the name of an output parameter (or "" if it is unnamed).
+ */
+func (td *FunctionTypeData) OutputName(index int) string {
+	if index < len(td.OutputNames) {
+		return td.OutputNames[index]
+	}
+	return ""
+}
+
+/**
+ * Tells if the function streams its results, ie it returns a channel that
+ * values can be received from.
+ */
+func (td *FunctionTypeData) IsStreaming() bool {
+	for _, outType := range td.OutputTypes {
+		for outType.TypeClass == AliasType {
+			outType = outType.AsAliasType().TargetType
+		}
+		if outType.TypeClass == ChannelType && outType.AsChannelType().CanRecv() {
+			return true
+		}
+	}
+	return false
 }
 
 func (td *FunctionTypeData) NumInputs() int {
@@ -181,3 +392,199 @@ func (td *FunctionTypeData) NumOutputs() int {
 func (td *FunctionTypeData) NumExceptions() int {
 	return len(td.ExceptionTypes)
 }
+
+/**
+ * A type parameter of a generic type, eg T in:
+ *
+ * 	type Page[T any] struct { Items []T }
+ */
+type TypeParamData struct {
+	Name string
+
+	// Position of the parameter in the list of type parameters
+	Index int
+
+	// The constraint on the parameter (eg any, comparable or a union)
+	Constraint *Type
+}
+
+/**
+ * An instantiation of a generic type with type arguments, eg Page[User].
+ */
+type InstanceTypeData struct {
+	// The generic type (a record or alias with type parameters)
+	GenericType *Type
+	TypeArgs    []*Type
+}
+
+/**
+ * A union of types in a constraint, eg ~int | ~string.
+ */
+type UnionTypeData struct {
+	Terms []*UnionTerm
+}
+
+type UnionTerm struct {
+	// Whether the term is ~Type (ie all types with Type as the underlying
+	// type)
+	Tilde bool
+	Type  *Type
+}
+
+/**
+ * Returns the type parameters of a generic record or alias type.
+ */
+func (t *Type) TypeParams() []*Type {
+	switch typeData := t.TypeData.(type) {
+	case *RecordTypeData:
+		return typeData.TypeParams
+	case *AliasTypeData:
+		return typeData.TypeParams
+	}
+	return nil
+}
+
+/**
+ * Returns the methods declared on a record or (non alias) named type.
+ */
+func (t *Type) Methods() []*Method {
+	switch typeData := t.TypeData.(type) {
+	case *RecordTypeData:
+		return typeData.Methods
+	case *AliasTypeData:
+		return typeData.Methods
+	}
+	return nil
+}
+
+/**
+ * Adds a method to a record or (non alias) named type.
+ */
+func (t *Type) AddMethod(method *Method) {
+	switch typeData := t.TypeData.(type) {
+	case *RecordTypeData:
+		typeData.Methods = append(typeData.Methods, method)
+	case *AliasTypeData:
+		typeData.Methods = append(typeData.Methods, method)
+	}
+}
+
+/**
+ * Returns the definition of an instance with the type parameters of the
+ * generic type substituted by the type arguments, eg for Page[User]:
+ *
+ * 	struct { Items []User }
+ *
+ * The expanded type keeps the name (and package) of the generic type.
+ */
+func (t *Type) Expand() *Type {
+	instance := t.AsInstanceType()
+	generic := instance.GenericType
+	mapping := make(map[*Type]*Type)
+	for index, param := range generic.TypeParams() {
+		if index < len(instance.TypeArgs) {
+			mapping[param] = instance.TypeArgs[index]
+		}
+	}
+	switch typeData := generic.TypeData.(type) {
+	case *RecordTypeData:
+		out := &RecordTypeData{NamedTypeData: typeData.NamedTypeData, IsInterface: typeData.IsInterface, Doc: typeData.Doc, Position: typeData.Position}
+		for _, base := range typeData.Bases {
+			out.Bases = append(out.Bases, Substitute(base, mapping))
+		}
+		for _, field := range typeData.Fields {
+			out.Fields = append(out.Fields, substituteField(field, mapping))
+		}
+		out.Methods = substituteMethods(typeData.Methods, mapping)
+		return &Type{TypeClass: RecordType, TypeData: out}
+	case *AliasTypeData:
+		out := &AliasTypeData{NamedTypeData: typeData.NamedTypeData, IsAlias: typeData.IsAlias}
+		out.TargetType = Substitute(typeData.TargetType, mapping)
+		out.Methods = substituteMethods(typeData.Methods, mapping)
+		return &Type{TypeClass: AliasType, TypeData: out}
+	}
+	return generic
+}
+
+/**
+ * Returns a type with the type parameters in it replaced as per a mapping.
+ * Only the parts of the type that refer to the parameters are copied.
+ * Named types are not descended into as they can only refer to their own
+ * type parameters.
+ */
+func Substitute(t *Type, mapping map[*Type]*Type) *Type {
+	if t == nil {
+		return nil
+	}
+	switch typeData := t.TypeData.(type) {
+	case *TypeParamData:
+		if out, ok := mapping[t]; ok {
+			return out
+		}
+	case *ReferenceTypeData:
+		return &Type{TypeClass: ReferenceType, TypeData: &ReferenceTypeData{TargetType: Substitute(typeData.TargetType, mapping)}}
+	case *ListTypeData:
+		out := &ListTypeData{TargetType: Substitute(typeData.TargetType, mapping), IsArray: typeData.IsArray, Length: typeData.Length}
+		return &Type{TypeClass: ListType, TypeData: out}
+	case *ChannelTypeData:
+		out := &ChannelTypeData{ElementType: Substitute(typeData.ElementType, mapping), Dir: typeData.Dir}
+		return &Type{TypeClass: ChannelType, TypeData: out}
+	case *MapTypeData:
+		return &Type{TypeClass: MapType, TypeData: &MapTypeData{
+			KeyType:   Substitute(typeData.KeyType, mapping),
+			ValueType: Substitute(typeData.ValueType, mapping),
+		}}
+	case *FunctionTypeData:
+		out := &FunctionTypeData{InputNames: typeData.InputNames, OutputNames: typeData.OutputNames, IsVariadic: typeData.IsVariadic,
+			Doc: typeData.Doc, Position: typeData.Position}
+		for _, inType := range typeData.InputTypes {
+			out.InputTypes = append(out.InputTypes, Substitute(inType, mapping))
+		}
+		for _, outType := range typeData.OutputTypes {
+			out.OutputTypes = append(out.OutputTypes, Substitute(outType, mapping))
+		}
+		out.ExceptionTypes = typeData.ExceptionTypes
+		return &Type{TypeClass: FunctionType, TypeData: out}
+	case *TupleTypeData:
+		out := &TupleTypeData{}
+		for _, subType := range typeData.SubTypes {
+			out.SubTypes = append(out.SubTypes, Substitute(subType, mapping))
+		}
+		return &Type{TypeClass: TupleType, TypeData: out}
+	case *InstanceTypeData:
+		out := &InstanceTypeData{GenericType: typeData.GenericType}
+		for _, arg := range typeData.TypeArgs {
+			out.TypeArgs = append(out.TypeArgs, Substitute(arg, mapping))
+		}
+		return &Type{TypeClass: InstanceType, TypeData: out}
+	case *RecordTypeData:
+		if typeData.Name == "" {
+			// anonymous structs can refer to type parameters
+			out := &RecordTypeData{IsInterface: typeData.IsInterface}
+			for _, base := range typeData.Bases {
+				out.Bases = append(out.Bases, Substitute(base, mapping))
+			}
+			for _, field := range typeData.Fields {
+				out.Fields = append(out.Fields, substituteField(field, mapping))
+			}
+			return &Type{TypeClass: RecordType, TypeData: out}
+		}
+	}
+	return t
+}
+
+func substituteField(field *Field, mapping map[*Type]*Type) *Field {
+	out := *field
+	out.Type = Substitute(field.Type, mapping)
+	return &out
+}
+
+func substituteMethods(methods []*Method, mapping map[*Type]*Type) []*Method {
+	var out []*Method
+	for _, method := range methods {
+		copied := *method
+		copied.Type = Substitute(method.Type, mapping)
+		out = append(out, &copied)
+	}
+	return out
+}
@@ -1,7 +1,7 @@
 package bridge
 
 import (
-	// "fmt"
+	"fmt"
 	// "go/parser"
 	// "go/token"
 	. "gopkg.in/check.v1"
@@ -34,6 +34,23 @@ func (s *TestSuite) TestIsValueType(c *C) {
 	c.Assert(NewType(RecordType, nil).IsValueType(), Equals, true)
 }
 
+func (s *TestSuite) TestFieldJsonName(c *C) {
+	stringType := NewType(NamedType, &NamedTypeData{Name: "string"})
+	name, omitEmpty := (&Field{Name: "UserId", Type: stringType, Tag: `json:"user_id,omitempty" xml:"id"`}).JsonName()
+	c.Assert(name, Equals, "user_id")
+	c.Assert(omitEmpty, Equals, true)
+	name, omitEmpty = (&Field{Name: "Name", Type: stringType, Tag: `json:",omitempty"`}).JsonName()
+	c.Assert(name, Equals, "Name")
+	c.Assert(omitEmpty, Equals, true)
+	name, _ = (&Field{Name: "Secret", Type: stringType, Tag: `json:"-"`}).JsonName()
+	c.Assert(name, Equals, "")
+	name, _ = (&Field{Name: "Dash", Type: stringType, Tag: `json:"-,"`}).JsonName()
+	c.Assert(name, Equals, "-")
+	name, omitEmpty = (&Field{Type: NewType(NamedType, &NamedTypeData{Name: "Base", Package: "core"})}).JsonName()
+	c.Assert(name, Equals, "Base")
+	c.Assert(omitEmpty, Equals, false)
+}
+
 func (s *TestSuite) TestNewType(c *C) {
 	cls := 10
 	d := "Hello"
@@ -67,4 +84,62 @@ func (s *TestSuite) TestAddPackage(c *C) {
 	c.Assert(shortName, Equals, "d")
 	c.Assert(shortName, Equals, tl.ShortNameForPackage("a/b/c/d"))
 	c.Assert("a/b/c/d", Equals, tl.PackageByShortName(shortName))
+
+	// clashing names are prefixed with parent folders and then numbered
+	c.Assert(tl.AddPackage("x/c/d"), Equals, "cd")
+	c.Assert(tl.AddPackage("c/d"), Equals, "d2")
+	c.Assert(tl.AddPackage("a/b/c/d"), Equals, "d")
+
+	// names are valid identifiers that are not keywords or predeclared
+	c.Assert(tl.AddPackage("example.com/go-yaml"), Equals, "goyaml")
+	c.Assert(tl.AddPackage("example.com/3d"), Equals, "p3d")
+	c.Assert(tl.AddPackage("example.com/func"), Equals, "examplecomfunc")
+	c.Assert(tl.AddPackage("example.com/lib/string"), Equals, "libstring")
+	c.Assert(tl.AddPackage("gopkg.in/yaml.v3"), Equals, "yaml")
+	c.Assert(tl.AddPackage(""), Equals, "")
+
+	// reserved and pinned names
+	tl.ReserveShortNames("http")
+	c.Assert(tl.AddPackage("example.com/http"), Equals, "examplecomhttp")
+	c.Assert(tl.SetShortName("example.com/models", "models"), IsNil)
+	c.Assert(tl.AddPackage("example.com/models"), Equals, "models")
+	c.Assert(tl.AddPackage("other.com/models"), Equals, "othercommodels")
+	c.Assert(tl.SetShortName("example.com/x", "models"), ErrorMatches, ".*already used by example.com/models")
+	c.Assert(tl.SetShortName("example.com/x", "type"), ErrorMatches, "invalid short name.*")
+	c.Assert(tl.SetShortName("a/b/c/d", "abcd"), IsNil)
+	c.Assert(tl.PackageByShortName("d"), Equals, "")
+}
+
+func (s *TestSuite) TestConcurrentAddType(c *C) {
+	tl := NewTypeLibrary()
+	results := make(chan *Type, 20)
+	for i := 0; i < cap(results); i++ {
+		go func(i int) {
+			pkg := fmt.Sprintf("example.com/pkg%d", i%4)
+			tl.AddType(pkg, fmt.Sprintf("T%d", i), NewType(NamedType, &NamedTypeData{Name: "T", Package: pkg}))
+			results <- tl.AddType("example.com/shared", "Shared", NewType(NamedType, &NamedTypeData{Name: "Shared"}))
+		}(i)
+	}
+
+	// all adders of the same type get the one that was added first
+	first := <-results
+	for i := 1; i < cap(results); i++ {
+		c.Assert(<-results, Equals, first)
+	}
+	c.Assert(tl.GetType("example.com/shared", "Shared"), Equals, first)
+	c.Assert(tl.GetType("example.com/pkg3", "T19"), NotNil)
+}
+
+func (s *TestSuite) TestForEachOrder(c *C) {
+	tl := NewTypeLibrary()
+	for _, key := range [][2]string{{"b", "A"}, {"a-b", "Z"}, {"a", "Z"}, {"a", "B"}, {"", "int"}} {
+		tl.AddType(key[0], key[1], NewType(NamedType, &NamedTypeData{Name: key[1], Package: key[0]}))
+	}
+	var keys []string
+	tl.ForEach(func(key string, t *Type, stop *bool) {
+		keys = append(keys, key)
+		// types can be added while iterating
+		tl.AddType("c", key, NewType(NullType, nil))
+	})
+	c.Assert(keys, DeepEquals, []string{".int", "a.B", "a.Z", "a-b.Z", "b.A"})
 }
@@ -4,118 +4,414 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
-	"io"
-	"log"
-	"os"
 	"path/filepath"
 	"reflect"
-	"runtime"
+	"strconv"
 	"strings"
-	"text/template"
 )
 
 type ParsedFile struct {
 	FullPath    string
+	FileSet     *token.FileSet
 	FileNode    *ast.File
 	Package     string
 	PackagePath string
 	Imports     map[string]string
+
+	// Import paths of the packages imported with "." (whose types are
+	// resolved once all files are processed)
+	DotImports []string
+
+	// Problems found while parsing and processing the file
+	Diagnostics Diagnostics
+
+	// Type parameters in scope while a generic declaration is processed
+	typeParams map[string]*Type
+
+	// Where the types that are not yet declared (unresolved types and
+	// types from other packages) are referred to in the file
+	pendingUses map[*Type][]token.Pos
 }
 
-// Given a full path to a file or folder, finds the full name of the
-// package path in one of the GOPATH or GOROOT folders
-// For example, if GOPATH contained the following folders:
-// /home/user1/a
-// /home/user1/b
+// Given a full path to a folder, finds the import path of the package in it.
+// The import path is resolved from the nearest go.mod file (taking replace
+// directives and nested modules into account), vendor folders or, failing
+// those, the src folders in GOPATH or GOROOT.  For example given:
 //
-// and GOROOT was:
-// /user/local/go
+// /home/user1/repo/go.mod containing "module github.com/theuser/repo"
 //
-// and given the input full path of:
+// and the input full path of:
 //
-// /home/user1/a/src/github.com/theuser/repo
+// /home/user1/repo/core
 //
 // would return
 //
-// github.com/theuser/repo
+// github.com/theuser/repo/core
 //
-// as the full package path as it exists in the src folder of one of the folders
-// in GOPATH or GOROOT
+// Returns "" if the import path cannot be resolved.
 func PackagePathForFile(fullpath string) string {
-	gopath := strings.Split(os.Getenv("GOPATH"), ";")
-	folders := []string{runtime.GOROOT()}
-	folders = append(folders, gopath...)
-	for _, folder := range folders {
-		if strings.HasPrefix(fullpath, folder+"src/") {
-			return fullpath[len(folder+"src/"):]
-		}
+	out, err := defaultResolver.ImportPath(fullpath)
+	if err != nil {
+		return ""
 	}
-	return ""
+	return out
 }
 
 func NewParsedFile(srcFile string) (out *ParsedFile, err error) {
+	return NewParsedFileInPackage(srcFile, "")
+}
+
+/**
+ * Parses a file in the package with the given import path.  If the import
+ * path is empty then it is resolved from the folder containing the file.
+ */
+func NewParsedFileInPackage(srcFile string, packagePath string) (out *ParsedFile, err error) {
 	out = &ParsedFile{Imports: make(map[string]string)}
 	srcFile, err = filepath.Abs(srcFile)
 	if err != nil {
 		return nil, err
 	}
 	out.FullPath = srcFile
-	fset := token.NewFileSet() // positions are relative to fset
-	out.FileNode, err = parser.ParseFile(fset, srcFile, nil, parser.ParseComments|parser.AllErrors)
+	out.FileSet = token.NewFileSet() // positions are relative to fset
+	out.FileNode, err = parser.ParseFile(out.FileSet, srcFile, nil, parser.ParseComments|parser.AllErrors)
 	if err != nil {
 		return nil, err
 	}
 	out.Package = out.FileNode.Name.Name
-	out.PackagePath = PackagePathForFile(filepath.Dir(srcFile))
+	out.PackagePath = packagePath
+	if out.PackagePath == "" {
+		out.PackagePath = PackagePathForFile(filepath.Dir(srcFile))
+	}
 	out.Imports[out.Package] = out.PackagePath
 	for _, importSpec := range out.FileNode.Imports {
-		path := importSpec.Path.Value
+		path, err := strconv.Unquote(importSpec.Path.Value)
+		if err != nil {
+			return nil, err
+		}
 		name := ""
 		if importSpec.Name == nil {
-			name = filepath.Base(path)
+			name = ImportName(path)
 		} else {
 			name = importSpec.Name.Name
 		}
 
 		if name == "." {
-			log.Println("Not sure how to deal with . imports", path)
-		} else {
-			out.Imports[name] = strings.Replace(path, "\"", "", -1)
+			out.DotImports = append(out.DotImports, path)
+		} else if name != "_" {
+			out.Imports[name] = path
 		}
 	}
 	return out, err
 }
 
 /**
- * Parses a file and returns a map of types indexed by name.
+ * Returns the position of a node in the file.
  */
-func (parsedFile *ParsedFile) ProcessNode(typeLibrary ITypeLibrary) error {
+func (parsedFile *ParsedFile) Position(pos token.Pos) token.Position {
+	return parsedFile.FileSet.Position(pos)
+}
+
+/**
+ * Records a reference to a type that is not declared yet.
+ */
+func (parsedFile *ParsedFile) addPendingUse(t *Type, pos token.Pos) {
+	if parsedFile.pendingUses == nil {
+		parsedFile.pendingUses = make(map[*Type][]token.Pos)
+	}
+	parsedFile.pendingUses[t] = append(parsedFile.pendingUses[t], pos)
+}
+
+/**
+ * Returns the name a package is imported as by default.  This is the last
+ * element of the import path without any major version suffix (eg
+ * "example.com/lib/v2" and "gopkg.in/yaml.v3" are imported as "lib" and
+ * "yaml").
+ */
+func ImportName(importPath string) string {
+	parts := strings.Split(importPath, "/")
+	name := parts[len(parts)-1]
+	if len(parts) > 1 && isMajorVersion(name) {
+		name = parts[len(parts)-2]
+	}
+	if index := strings.LastIndex(name, "."); index > 0 && isMajorVersion(name[index+1:]) {
+		name = name[:index]
+	}
+	return name
+}
+
+func isMajorVersion(value string) bool {
+	if len(value) < 2 || value[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(value[1:])
+	return err == nil
+}
+
+/**
+ * Adds the types declared in the file to a type library and returns the
+ * diagnostics of the file (including those found while parsing it).
+ */
+func (parsedFile *ParsedFile) ProcessNode(typeLibrary ITypeLibrary) Diagnostics {
 	for _, decl := range parsedFile.FileNode.Decls {
 		gendecl, ok := decl.(*ast.GenDecl)
-		if ok && len(gendecl.Specs) > 0 {
-			typeSpec, ok := gendecl.Specs[0].(*ast.TypeSpec)
-			if ok {
-				parsedFile.NodeToType(typeSpec, typeLibrary)
+		if !ok || gendecl.Tok != token.TYPE {
+			continue
+		}
+		// grouped declarations (type ( A ...; B ... )) have several specs
+		for _, spec := range gendecl.Specs {
+			if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+				t := parsedFile.NodeToType(typeSpec, typeLibrary)
+				doc := declDoc(gendecl, typeSpec)
+				position := parsedFile.FileSet.Position(typeSpec.Name.Pos())
+				switch typeData := t.TypeData.(type) {
+				case *RecordTypeData:
+					if !typeData.Position.IsValid() {
+						// keep the first of redeclared types
+						typeData.Doc, typeData.Position = doc, position
+					}
+				case *AliasTypeData:
+					if typeData.TargetType.TypeClass == FunctionType {
+						functionData := typeData.TargetType.AsFunctionType()
+						functionData.Doc, functionData.Position = doc, position
+					}
+				}
 			}
 		}
 	}
-	return nil
+	return parsedFile.Diagnostics
 }
 
 /**
- * Finds a GenDecl node in a parsed file.
+ * Adds the methods declared in the file to their receiver types and returns
+ * the diagnostics of the file.  As methods can be declared in other files
+ * than their types this is done once all files of the package have been
+ * processed with ProcessNode.
+ */
+func (parsedFile *ParsedFile) ProcessMethods(typeLibrary ITypeLibrary) Diagnostics {
+	for _, decl := range parsedFile.FileNode.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl.Recv == nil || len(funcDecl.Recv.List) != 1 {
+			continue
+		}
+		method := &Method{Name: funcDecl.Name.Name, Doc: funcDecl.Doc.Text(), Position: parsedFile.Position(funcDecl.Name.Pos())}
+		recvExpr := funcDecl.Recv.List[0].Type
+		if paren, ok := recvExpr.(*ast.ParenExpr); ok {
+			recvExpr = paren.X
+		}
+		if star, ok := recvExpr.(*ast.StarExpr); ok {
+			method.PointerReceiver = true
+			recvExpr = star.X
+		}
+		// the receivers of methods of generic types name their type
+		// parameters, eg func (p *Page[T]) Items() []T
+		var paramNames []*ast.Ident
+		switch indexExpr := recvExpr.(type) {
+		case *ast.IndexExpr:
+			recvExpr = indexExpr.X
+			if name, ok := indexExpr.Index.(*ast.Ident); ok {
+				paramNames = []*ast.Ident{name}
+			}
+		case *ast.IndexListExpr:
+			recvExpr = indexExpr.X
+			for _, index := range indexExpr.Indices {
+				if name, ok := index.(*ast.Ident); ok {
+					paramNames = append(paramNames, name)
+				}
+			}
+		}
+		recvName, ok := recvExpr.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		recvType := typeLibrary.GetType(parsedFile.PackagePath, recvName.Name)
+		for recvType != nil && recvType.TypeClass == AliasType && recvType.AsAliasType().IsAlias {
+			recvType = recvType.AsAliasType().TargetType
+		}
+		if recvType == nil {
+			parsedFile.Diagnostics.AddError(parsedFile.Position(recvName.Pos()), CodeUnresolvedType,
+				"undefined receiver type %s of method %s", recvName.Name, method.Name)
+			continue
+		}
+		if recvType.TypeClass != RecordType && recvType.TypeClass != AliasType {
+			// types whose declarations could not be processed have been
+			// reported already
+			continue
+		}
+
+		typeParams := recvType.TypeParams()
+		if len(paramNames) > 0 {
+			parsedFile.typeParams = make(map[string]*Type)
+			for index, name := range paramNames {
+				if index < len(typeParams) && name.Name != "_" {
+					parsedFile.typeParams[name.Name] = typeParams[index]
+				}
+			}
+		}
+		method.Type = parsedFile.NodeToType(funcDecl.Type, typeLibrary)
+		parsedFile.typeParams = nil
+		recvType.AddMethod(method)
+	}
+	return parsedFile.Diagnostics
+}
+
+/**
+ * Finds the GenDecl node declaring a type in a parsed file.
  */
 func FindDecl(parsedFile *ast.File, declName string) *ast.GenDecl {
+	gendecl, _ := FindTypeSpec(parsedFile, declName)
+	return gendecl
+}
+
+/**
+ * Finds the declaration (and the spec within it) of a type in a parsed file.
+ */
+func FindTypeSpec(parsedFile *ast.File, declName string) (*ast.GenDecl, *ast.TypeSpec) {
 	for _, decl := range parsedFile.Decls {
 		gendecl, ok := decl.(*ast.GenDecl)
-		if ok && len(gendecl.Specs) > 0 {
-			typeSpec := gendecl.Specs[0].(*ast.TypeSpec)
-			if ok && typeSpec.Name.Name == declName {
-				return gendecl
+		if !ok || gendecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gendecl.Specs {
+			if typeSpec, ok := spec.(*ast.TypeSpec); ok && typeSpec.Name.Name == declName {
+				return gendecl, typeSpec
 			}
 		}
 	}
-	return nil
+	return nil, nil
+}
+
+/**
+ * Where and how a named type was declared.
+ */
+type DeclInfo struct {
+	Name    string
+	Package string
+
+	// The declaration and the spec (within it) for the type
+	Decl *ast.GenDecl
+	Spec *ast.TypeSpec
+
+	// Position of the type's name
+	Position token.Position
+
+	// The doc comment of the type (or of the declaration if the type is
+	// the only one in it)
+	Doc string
+}
+
+/**
+ * Returns the declaration of a type in the file (or nil if the type is
+ * not declared in it).
+ */
+func (parsedFile *ParsedFile) DeclInfo(name string) *DeclInfo {
+	return findDeclInfo(parsedFile.FileSet, parsedFile.FileNode, parsedFile.PackagePath, name)
+}
+
+func findDeclInfo(fset *token.FileSet, file *ast.File, pkg string, name string) *DeclInfo {
+	gendecl, typeSpec := FindTypeSpec(file, name)
+	if typeSpec == nil {
+		return nil
+	}
+	out := &DeclInfo{Name: name, Package: pkg, Decl: gendecl, Spec: typeSpec}
+	out.Position = fset.Position(typeSpec.Name.Pos())
+	out.Doc = declDoc(gendecl, typeSpec)
+	return out
+}
+
+/**
+ * Returns the doc comment of a type spec (or of its declaration if it is
+ * the only spec in it).
+ */
+func declDoc(gendecl *ast.GenDecl, typeSpec *ast.TypeSpec) string {
+	if typeSpec.Doc != nil {
+		return typeSpec.Doc.Text()
+	} else if gendecl.Doc != nil && len(gendecl.Specs) == 1 {
+		return gendecl.Doc.Text()
+	}
+	return ""
+}
+
+/**
+ * Returns the doc comment of a field (or its line comment if it has no doc
+ * comment).
+ */
+func fieldDoc(field *ast.Field) string {
+	if field.Doc != nil {
+		return field.Doc.Text()
+	} else if field.Comment != nil {
+		return field.Comment.Text()
+	}
+	return ""
+}
+
+/**
+ * Creates the type parameters of a generic declaration and puts them in
+ * scope (till the declaration is processed).  All parameters are in scope
+ * before their constraints are processed as constraints can refer to other
+ * parameters, eg [S ~[]E, E any].
+ */
+func (parsedFile *ParsedFile) processTypeParams(fieldList *ast.FieldList, typeLibrary ITypeLibrary) []*Type {
+	if fieldList == nil || len(fieldList.List) == 0 {
+		return nil
+	}
+	var out []*Type
+	parsedFile.typeParams = make(map[string]*Type)
+	for _, field := range fieldList.List {
+		for _, name := range field.Names {
+			param := &Type{TypeClass: TypeParamType, TypeData: &TypeParamData{Name: name.Name, Index: len(out)}}
+			parsedFile.typeParams[name.Name] = param
+			out = append(out, param)
+		}
+	}
+	index := 0
+	for _, field := range fieldList.List {
+		constraint := parsedFile.NodeToType(field.Type, typeLibrary)
+		for range field.Names {
+			out[index].AsTypeParamType().Constraint = constraint
+			index++
+		}
+	}
+	return out
+}
+
+/**
+ * Returns the types and names of the parameters (or results) of a function.
+ * Fields with several names (eg a, b int) result in a parameter for each
+ * name.  The names are nil if the parameters are unnamed.
+ */
+func (parsedFile *ParsedFile) processParams(fieldList *ast.FieldList, typeLibrary ITypeLibrary) ([]*Type, []string) {
+	if fieldList == nil {
+		return nil, nil
+	}
+	var types []*Type
+	var names []string
+	for _, field := range fieldList.List {
+		fieldType := parsedFile.NodeToType(field.Type, typeLibrary)
+		if len(field.Names) == 0 {
+			types = append(types, fieldType)
+			continue
+		}
+		for _, name := range field.Names {
+			types = append(types, fieldType)
+			names = append(names, name.Name)
+		}
+	}
+	return types, names
+}
+
+/**
+ * Returns the length of an array type.  Only integer literals can be
+ * evaluated without type checking, the length of other arrays is -1.
+ */
+func (parsedFile *ParsedFile) arrayLength(expr ast.Expr) int {
+	if lit, ok := expr.(*ast.BasicLit); ok && lit.Kind == token.INT {
+		if value, err := strconv.ParseInt(lit.Value, 0, 0); err == nil {
+			return int(value)
+		}
+	}
+	parsedFile.Diagnostics.AddWarning(parsedFile.Position(expr.Pos()), CodeArrayLength,
+		"cannot evaluate array length without type checking")
+	return -1
 }
 
 /**
@@ -133,17 +429,12 @@ func (parsedFile *ParsedFile) NodeToType(node ast.Node, typeLibrary ITypeLibrary
 			out := &Type{TypeClass: FunctionType}
 
 			// create a function type
-			functionType := &FunctionTypeData{}
+			functionType := &FunctionTypeData{Position: parsedFile.FileSet.Position(typeExpr.Pos())}
 			out.TypeData = functionType
-			for _, param := range typeExpr.Params.List {
-				paramType := parsedFile.NodeToType(param.Type, typeLibrary)
-				functionType.InputTypes = append(functionType.InputTypes, paramType)
-			}
-			if typeExpr.Results != nil && typeExpr.Results.List != nil {
-				for _, result := range typeExpr.Results.List {
-					resultType := parsedFile.NodeToType(result.Type, typeLibrary)
-					functionType.OutputTypes = append(functionType.OutputTypes, resultType)
-				}
+			functionType.InputTypes, functionType.InputNames = parsedFile.processParams(typeExpr.Params, typeLibrary)
+			functionType.OutputTypes, functionType.OutputNames = parsedFile.processParams(typeExpr.Results, typeLibrary)
+			if numParams := len(typeExpr.Params.List); numParams > 0 {
+				_, functionType.IsVariadic = typeExpr.Params.List[numParams-1].Type.(*ast.Ellipsis)
 			}
 			return out
 		}
@@ -153,9 +444,35 @@ func (parsedFile *ParsedFile) NodeToType(node ast.Node, typeLibrary ITypeLibrary
 		typeData.ValueType = parsedFile.NodeToType(typeExpr.Value, typeLibrary)
 		return &Type{TypeClass: MapType, TypeData: typeData}
 	case *ast.ArrayType:
+		typeData := &ListTypeData{TargetType: parsedFile.NodeToType(typeExpr.Elt, typeLibrary)}
+		if typeExpr.Len != nil {
+			typeData.IsArray = true
+			typeData.Length = parsedFile.arrayLength(typeExpr.Len)
+		}
+		return &Type{TypeClass: ListType, TypeData: typeData}
+	case *ast.Ellipsis:
+		// variadic parameters are lists of their element type
 		return &Type{TypeClass: ListType,
 			TypeData: &ListTypeData{TargetType: parsedFile.NodeToType(typeExpr.Elt, typeLibrary)}}
+	case *ast.ChanType:
+		typeData := &ChannelTypeData{ElementType: parsedFile.NodeToType(typeExpr.Value, typeLibrary)}
+		switch typeExpr.Dir {
+		case ast.SEND:
+			typeData.Dir = SendOnly
+		case ast.RECV:
+			typeData.Dir = RecvOnly
+		default:
+			typeData.Dir = BothDirs
+		}
+		return &Type{TypeClass: ChannelType, TypeData: typeData}
+	case *ast.ParenExpr:
+		return parsedFile.NodeToType(typeExpr.X, typeLibrary)
 	case *ast.Ident:
+		// Type parameters shadow all other types
+		if t, ok := parsedFile.typeParams[typeExpr.Name]; ok {
+			return t
+		}
+
 		// Here we are adding a type without a localname prefix.  This means
 		// the type could either be in this package itself or could be a
 		// basic type or could actually be imported implicitly (via ".").
@@ -171,11 +488,11 @@ func (parsedFile *ParsedFile) NodeToType(node ast.Node, typeLibrary ITypeLibrary
 		// implicitly.  So create a lazy type which will only get resolved if we
 		// encounter a type def
 		// Case 2: Not a basic type so see if we have a previous definition
-		t = typeLibrary.GetType(parsedFile.PackagePath, typeExpr.Name)
-		if t == nil {
-			// Case 3: No previous def, so create a lazy type
-			t = &Type{TypeClass: UnresolvedType, TypeData: &NamedTypeData{typeExpr.Name, parsedFile.PackagePath}}
-			typeLibrary.AddType(parsedFile.PackagePath, typeExpr.Name, t)
+		// Case 3: No previous def, so create a lazy type (both in one step)
+		t = typeLibrary.AddType(parsedFile.PackagePath, typeExpr.Name,
+			&Type{TypeClass: UnresolvedType, TypeData: &NamedTypeData{typeExpr.Name, parsedFile.PackagePath}})
+		if t.TypeClass == UnresolvedType {
+			parsedFile.addPendingUse(t, typeExpr.Pos())
 		}
 		return t
 	case *ast.SelectorExpr:
@@ -188,10 +505,46 @@ func (parsedFile *ParsedFile) NodeToType(node ast.Node, typeLibrary ITypeLibrary
 			if fullPkgName == "" {
 				fullPkgName = pkgName
 			}
-			t = &Type{TypeClass: NamedType, TypeData: &NamedTypeData{typeExpr.Sel.Name, fullPkgName}}
-			typeLibrary.AddType(fullPkgName, typeExpr.Sel.Name, t)
+			t = typeLibrary.AddType(fullPkgName, typeExpr.Sel.Name,
+				&Type{TypeClass: NamedType, TypeData: &NamedTypeData{typeExpr.Sel.Name, fullPkgName}})
+		}
+		if t.TypeClass == NamedType && t.AsNamedType().Package != "" {
+			parsedFile.addPendingUse(t, typeExpr.Pos())
 		}
 		return t
+	case *ast.IndexExpr:
+		// Instantiation of a generic type with one type argument
+		typeData := &InstanceTypeData{GenericType: parsedFile.NodeToType(typeExpr.X, typeLibrary)}
+		typeData.TypeArgs = []*Type{parsedFile.NodeToType(typeExpr.Index, typeLibrary)}
+		return &Type{TypeClass: InstanceType, TypeData: typeData}
+	case *ast.IndexListExpr:
+		typeData := &InstanceTypeData{GenericType: parsedFile.NodeToType(typeExpr.X, typeLibrary)}
+		for _, index := range typeExpr.Indices {
+			typeData.TypeArgs = append(typeData.TypeArgs, parsedFile.NodeToType(index, typeLibrary))
+		}
+		return &Type{TypeClass: InstanceType, TypeData: typeData}
+	case *ast.UnaryExpr:
+		// ~T in a constraint
+		if typeExpr.Op != token.TILDE {
+			break
+		}
+		term := &UnionTerm{Tilde: true, Type: parsedFile.NodeToType(typeExpr.X, typeLibrary)}
+		return &Type{TypeClass: UnionType, TypeData: &UnionTypeData{Terms: []*UnionTerm{term}}}
+	case *ast.BinaryExpr:
+		// A | B in a constraint
+		if typeExpr.Op != token.OR {
+			break
+		}
+		typeData := &UnionTypeData{}
+		for _, operand := range []ast.Expr{typeExpr.X, typeExpr.Y} {
+			operandType := parsedFile.NodeToType(operand, typeLibrary)
+			if operandType.TypeClass == UnionType {
+				typeData.Terms = append(typeData.Terms, operandType.AsUnionType().Terms...)
+			} else {
+				typeData.Terms = append(typeData.Terms, &UnionTerm{Type: operandType})
+			}
+		}
+		return &Type{TypeClass: UnionType, TypeData: typeData}
 	case *ast.StructType:
 		{
 			recordData := &RecordTypeData{}
@@ -199,11 +552,19 @@ func (parsedFile *ParsedFile) NodeToType(node ast.Node, typeLibrary ITypeLibrary
 			for _, field := range fieldList {
 				fieldType := parsedFile.NodeToType(field.Type, typeLibrary)
 				// log.Println("Processing field: ", index, field.Names, field.Type, reflect.TypeOf(field.Type))
-				if len(field.Names) == 0 {
-					field.Names = []*ast.Ident{&ast.Ident{}}
+				tag := ""
+				if field.Tag != nil {
+					tag, _ = strconv.Unquote(field.Tag.Value)
 				}
-				for _, fieldName := range field.Names {
-					field := &Field{Name: fieldName.Name, Type: fieldType}
+				names := field.Names
+				if len(names) == 0 {
+					// embedded fields are kept as unnamed fields
+					recordData.Bases = append(recordData.Bases, fieldType)
+					names = []*ast.Ident{{NamePos: field.Type.Pos()}}
+				}
+				for _, fieldName := range names {
+					field := &Field{Name: fieldName.Name, Type: fieldType, Tag: tag, Doc: fieldDoc(field),
+						Position: parsedFile.FileSet.Position(fieldName.Pos())}
 					recordData.Fields = append(recordData.Fields, field)
 				}
 			}
@@ -211,64 +572,74 @@ func (parsedFile *ParsedFile) NodeToType(node ast.Node, typeLibrary ITypeLibrary
 		}
 	case *ast.InterfaceType:
 		{
-			recordData := &RecordTypeData{}
+			recordData := &RecordTypeData{IsInterface: true}
 			fieldList := typeExpr.Methods.List
 			for _, field := range fieldList {
 				// log.Println("Processing method: ", index, field.Names[0], field.Type, reflect.TypeOf(field.Type))
 				fieldType := parsedFile.NodeToType(field.Type, typeLibrary)
-				if len(field.Names) == 0 {
-					field.Names = []*ast.Ident{&ast.Ident{}}
+				names := field.Names
+				if len(names) == 0 {
+					// embedded interfaces are kept as unnamed fields
+					recordData.Bases = append(recordData.Bases, fieldType)
+					names = []*ast.Ident{{NamePos: field.Type.Pos()}}
 				}
-				for _, fieldName := range field.Names {
-					field := &Field{Name: fieldName.Name, Type: fieldType}
+				for _, fieldName := range names {
+					field := &Field{Name: fieldName.Name, Type: fieldType, Doc: fieldDoc(field),
+						Position: parsedFile.FileSet.Position(fieldName.Pos())}
+					if fieldType.TypeClass == FunctionType {
+						fieldType.AsFunctionType().Doc = field.Doc
+						fieldType.AsFunctionType().Position = field.Position
+					}
 					recordData.Fields = append(recordData.Fields, field)
 				}
 			}
 			return &Type{TypeClass: RecordType, TypeData: recordData}
 		}
 	case *ast.TypeSpec:
-		recordData := &RecordTypeData{NamedTypeData: NamedTypeData{Name: typeExpr.Name.Name, Package: parsedFile.PackagePath}}
-		// Check if we have a "lazy" type for this package/name combo
-		out := typeLibrary.GetType(parsedFile.PackagePath, recordData.Name)
-		if out != nil {
-			if out.TypeClass != UnresolvedType {
-				// Redefinition of type
-				// TODO: throw errors
-				log.Println("ERROR: Redefinition of type: ", recordData.Name, out.TypeClass)
+		namedData := NamedTypeData{Name: typeExpr.Name.Name, Package: parsedFile.PackagePath}
+		// Add the type unless there is a "lazy" type for this package/name
+		// combo (in one step so files can be processed concurrently)
+		out := typeLibrary.AddType(parsedFile.PackagePath, namedData.Name, &Type{})
+		// Types referred to from other packages before their package was
+		// loaded are NamedType placeholders
+		if out.TypeClass != NullType && out.TypeClass != UnresolvedType && out.TypeClass != NamedType {
+			// Redefinitions are reported and the first definition is kept
+			parsedFile.Diagnostics.AddError(parsedFile.Position(typeExpr.Name.Pos()), CodeRedefinition,
+				"%s redeclared in package %s", namedData.Name, namedData.Package)
+			return out
+		}
+
+		typeParams := parsedFile.processTypeParams(typeExpr.TypeParams, typeLibrary)
+		childType := parsedFile.NodeToType(typeExpr.Type, typeLibrary)
+		parsedFile.typeParams = nil
+		if childType == nil {
+			// the unsupported part of the declaration has been reported
+			out.TypeClass = UnresolvedType
+			out.TypeData = &namedData
+			return out
+		}
+		switch typeExpr.Type.(type) {
+		case *ast.StructType, *ast.InterfaceType:
+			if !typeExpr.Assign.IsValid() {
+				childRecord := childType.TypeData.(*RecordTypeData)
+				out.TypeClass = RecordType
+				out.TypeData = &RecordTypeData{NamedTypeData: namedData, Bases: childRecord.Bases, Fields: childRecord.Fields, TypeParams: typeParams, IsInterface: childRecord.IsInterface}
+				return out
 			}
-		} else {
-			// Previous declaration neither exists nor is lazy so add it
-			// fearlessly
-			out = &Type{}
-			typeLibrary.AddType(parsedFile.PackagePath, recordData.Name, out)
-		}
-		out.TypeClass = RecordType
-		out.TypeData = recordData
-		childTypeData := parsedFile.NodeToType(typeExpr.Type, typeLibrary).TypeData
-		recordData.Fields = childTypeData.(*RecordTypeData).Fields
+		}
+
+		// Everything else (and all aliases) are named wrappers around the
+		// type they are declared with, eg:
+		//
+		// 	type ID string
+		// 	type Handler func()
+		// 	type IDs []ID
+		// 	type A = B
+		out.TypeClass = AliasType
+		out.TypeData = &AliasTypeData{NamedTypeData: namedData, TargetType: childType, IsAlias: typeExpr.Assign.IsValid(), TypeParams: typeParams}
 		return out
 	}
-	log.Println("Damn - the wrong type: ", node, reflect.TypeOf(node))
+	parsedFile.Diagnostics.AddError(parsedFile.Position(node.Pos()), CodeUnsupportedType,
+		"unsupported type expression %s", reflect.TypeOf(node))
 	return nil
 }
-
-func LoadTemplate(templatePath string) (*template.Template, error) {
-	templ, err := template.New(filepath.Base(templatePath)).ParseFiles(templatePath)
-	if err != nil {
-		panic(err)
-	}
-	return templ, nil
-}
-
-func RenderTemplate(writer io.Writer, templatePath string, context interface{}) error {
-	// TODO: Precompile and cache templates
-	templ, err := template.New(filepath.Base(templatePath)).ParseFiles(templatePath)
-	if err != nil {
-		panic(err)
-	}
-	err = templ.Execute(writer, context)
-	if err != nil {
-		panic(err)
-	}
-	return err
-}
@@ -0,0 +1,323 @@
+package bridge
+
+import (
+	"go/ast"
+	. "gopkg.in/check.v1"
+	"path/filepath"
+)
+
+/**
+ * Parses and processes a source file (in a folder of its own) into a new
+ * type library.
+ */
+func parseTestSource(c *C, source string) (*ParsedFile, *TypeLibrary) {
+	root := c.MkDir()
+	writeTestFiles(c, root, map[string]string{"go.mod": "module example.com/test\n", "test.go": source})
+	parsedFile, err := NewParsedFile(filepath.Join(root, "test.go"))
+	c.Assert(err, IsNil)
+	typeLibrary := NewTypeLibrary()
+	typeLibrary.AddGlobalType("string")
+	typeLibrary.AddGlobalType("int")
+	typeLibrary.AddGlobalType("float64")
+	typeLibrary.AddGlobalType("byte")
+	typeLibrary.AddGlobalType("error")
+	typeLibrary.AddGlobalType("any")
+	typeLibrary.AddGlobalType("comparable")
+	c.Assert(parsedFile.ProcessNode(typeLibrary), IsNil)
+	c.Assert(parsedFile.ProcessMethods(typeLibrary), IsNil)
+	return parsedFile, typeLibrary
+}
+
+func (s *TestSuite) TestParseTypeDeclarations(c *C) {
+	_, typeLibrary := parseTestSource(c, `package test
+
+type ID string
+
+type IDs []ID
+
+type Handler func(id ID) error
+
+type Lookup map[string]*Base
+
+type BaseAlias = Base
+
+type Base struct {
+	Id ID
+}
+`)
+	id := typeLibrary.GetType("example.com/test", "ID")
+	c.Assert(id.TypeClass, Equals, AliasType)
+	c.Assert(id.AsAliasType().NamedTypeData, Equals, NamedTypeData{"ID", "example.com/test"})
+	c.Assert(id.AsAliasType().TargetType, Equals, typeLibrary.GetGlobalType("string"))
+	c.Assert(id.AsAliasType().IsAlias, Equals, false)
+	c.Assert(typeLibrary.Signature(id), Equals, "example.com/test.ID")
+
+	ids := typeLibrary.GetType("example.com/test", "IDs").AsAliasType()
+	c.Assert(ids.TargetType.AsListType().TargetType, Equals, id)
+
+	handler := typeLibrary.GetType("example.com/test", "Handler").AsAliasType()
+	c.Assert(handler.TargetType.TypeClass, Equals, FunctionType)
+
+	lookup := typeLibrary.GetType("example.com/test", "Lookup").AsAliasType()
+	c.Assert(lookup.TargetType.TypeClass, Equals, MapType)
+
+	// aliases are told apart from defined types and resolve to their target
+	// even when it is declared later
+	base := typeLibrary.GetType("example.com/test", "Base")
+	c.Assert(base.TypeClass, Equals, RecordType)
+	baseAlias := typeLibrary.GetType("example.com/test", "BaseAlias")
+	c.Assert(baseAlias.AsAliasType().IsAlias, Equals, true)
+	c.Assert(baseAlias.AsAliasType().TargetType, Equals, base)
+	c.Assert(typeLibrary.Signature(baseAlias), Equals, "example.com/test.Base")
+}
+
+func (s *TestSuite) TestParseEmbeddedTypes(c *C) {
+	_, typeLibrary := parseTestSource(c, `package test
+
+type Base struct {
+	Id string
+}
+
+type Derived struct {
+	Base
+	*Other
+	Name string
+}
+
+type Other struct {
+}
+
+type IReader interface {
+	Read() string
+}
+
+type IReadWriter interface {
+	IReader
+	Write(value string)
+}
+`)
+	base := typeLibrary.GetType("example.com/test", "Base")
+	other := typeLibrary.GetType("example.com/test", "Other")
+	derived := typeLibrary.GetType("example.com/test", "Derived").AsRecordType()
+	c.Assert(derived.NumBases(), Equals, 2)
+	c.Assert(derived.Bases[0], Equals, base)
+	c.Assert(derived.Bases[1].AsReferenceType().TargetType, Equals, other)
+	c.Assert(derived.NumFields(), Equals, 3)
+	c.Assert(derived.Fields[0].Name, Equals, "")
+	c.Assert(derived.Fields[2].Name, Equals, "Name")
+
+	reader := typeLibrary.GetType("example.com/test", "IReader")
+	readWriter := typeLibrary.GetType("example.com/test", "IReadWriter").AsRecordType()
+	c.Assert(readWriter.Bases, DeepEquals, []*Type{reader})
+	c.Assert(readWriter.Fields[1].Name, Equals, "Write")
+}
+
+const groupedSource = `package test
+
+import "fmt"
+
+var _ = fmt.Sprint
+
+// A single type
+type Single struct{}
+
+// Grouped types
+type (
+	// The first type
+	First struct {
+		Name string
+	}
+
+	Second struct {
+		First First
+	}
+)
+`
+
+func (s *TestSuite) TestParseGroupedDeclarations(c *C) {
+	parsedFile, typeLibrary := parseTestSource(c, groupedSource)
+	first := typeLibrary.GetType("example.com/test", "First")
+	second := typeLibrary.GetType("example.com/test", "Second")
+	c.Assert(first.TypeClass, Equals, RecordType)
+	c.Assert(second.TypeClass, Equals, RecordType)
+	c.Assert(second.AsRecordType().Fields[0].Type, Equals, first)
+
+	// import and var declarations are skipped
+	c.Assert(FindDecl(parsedFile.FileNode, "Second"), NotNil)
+	c.Assert(FindDecl(parsedFile.FileNode, "Missing"), IsNil)
+}
+
+func (s *TestSuite) TestDeclInfo(c *C) {
+	parsedFile, _ := parseTestSource(c, groupedSource)
+	single := parsedFile.DeclInfo("Single")
+	c.Assert(single.Doc, Equals, "A single type\n")
+	c.Assert(single.Position.Line, Equals, 8)
+	c.Assert(single.Position.Column, Equals, 6)
+	c.Assert(single.Position.Filename, Equals, parsedFile.FullPath)
+
+	first := parsedFile.DeclInfo("First")
+	c.Assert(first.Package, Equals, "example.com/test")
+	c.Assert(first.Doc, Equals, "The first type\n")
+	c.Assert(first.Position.Line, Equals, 13)
+	c.Assert(len(first.Decl.Specs), Equals, 2)
+	c.Assert(first.Spec.Name.Name, Equals, "First")
+
+	// group docs do not apply to each type in the group
+	second := parsedFile.DeclInfo("Second")
+	c.Assert(second.Doc, Equals, "")
+	c.Assert(parsedFile.DeclInfo("Missing"), IsNil)
+
+	// processing the types leaves the declarations as they were parsed
+	parsedFile, _ = parseTestSource(c, `package test
+
+type Base struct{}
+
+type Derived struct {
+	Base
+	B int
+}
+
+type Reader interface {
+	Base
+}
+`)
+	derived := parsedFile.DeclInfo("Derived").Spec.Type.(*ast.StructType)
+	c.Assert(derived.Fields.List[0].Names, IsNil)
+	reader := parsedFile.DeclInfo("Reader").Spec.Type.(*ast.InterfaceType)
+	c.Assert(reader.Methods.List[0].Names, IsNil)
+}
+
+func (s *TestSuite) TestParseGenericTypes(c *C) {
+	_, typeLibrary := parseTestSource(c, `package test
+
+type Number interface {
+	~int | ~float64
+}
+
+type Page[T any] struct {
+	Items []T
+	Next  *Page[T]
+}
+
+type Pair[K comparable, V any] map[K]V
+
+type Users struct {
+	Current Page[string]
+	ByName  Pair[string, int]
+}
+`)
+	page := typeLibrary.GetType("example.com/test", "Page")
+	c.Assert(page.TypeClass, Equals, RecordType)
+	params := page.TypeParams()
+	c.Assert(len(params), Equals, 1)
+	c.Assert(params[0].AsTypeParamType().Name, Equals, "T")
+	items := page.AsRecordType().Fields[0].Type.AsListType()
+	c.Assert(items.TargetType, Equals, params[0])
+	next := page.AsRecordType().Fields[1].Type.AsReferenceType().TargetType.AsInstanceType()
+	c.Assert(next.GenericType, Equals, page)
+	c.Assert(next.TypeArgs, DeepEquals, []*Type{params[0]})
+
+	pair := typeLibrary.GetType("example.com/test", "Pair")
+	c.Assert(typeLibrary.TypeParamsSignature(pair), Equals, "[K comparable, V any]")
+
+	number := typeLibrary.GetType("example.com/test", "Number").AsRecordType()
+	c.Assert(number.Bases[0].TypeClass, Equals, UnionType)
+	c.Assert(typeLibrary.Signature(number.Bases[0]), Equals, "~int | ~float64")
+
+	// instances expand to their generic types with the arguments substituted
+	users := typeLibrary.GetType("example.com/test", "Users").AsRecordType()
+	current := users.Fields[0].Type
+	c.Assert(typeLibrary.Signature(current), Equals, "example.com/test.Page[string]")
+	expanded := current.Expand()
+	c.Assert(expanded.AsRecordType().NamedTypeData, Equals, NamedTypeData{"Page", "example.com/test"})
+	c.Assert(expanded.AsRecordType().Fields[0].Type.AsListType().TargetType, Equals, typeLibrary.GetGlobalType("string"))
+	c.Assert(typeLibrary.Signature(expanded.AsRecordType().Fields[1].Type), Equals, "*example.com/test.Page[string]")
+	byName := users.Fields[1].Type.Expand().AsAliasType()
+	c.Assert(typeLibrary.Signature(byName.TargetType), Equals, "map[string]int")
+}
+
+func (s *TestSuite) TestParseFunctionsChannelsAndArrays(c *C) {
+	_, typeLibrary := parseTestSource(c, `package test
+
+type Events struct {
+	Digest  [32]byte
+	Updates <-chan string
+	Acks    chan<- int
+	Both    chan (int)
+}
+
+type IService interface {
+	Watch(topic string, ids ...int) (<-chan string, error)
+	Rename(from, to string) (count int, err error)
+	Ping(string)
+}
+`)
+	events := typeLibrary.GetType("example.com/test", "Events").AsRecordType()
+	digest := events.Fields[0].Type.AsListType()
+	c.Assert(digest.IsArray, Equals, true)
+	c.Assert(digest.Length, Equals, 32)
+	c.Assert(typeLibrary.Signature(events.Fields[0].Type), Equals, "[32]byte")
+	c.Assert(events.Fields[0].Type.IsValueType(), Equals, true)
+	c.Assert(events.Fields[1].Type.AsChannelType().Dir, Equals, RecvOnly)
+	c.Assert(typeLibrary.Signature(events.Fields[1].Type), Equals, "<-chan string")
+	c.Assert(typeLibrary.Signature(events.Fields[2].Type), Equals, "chan<- int")
+	c.Assert(events.Fields[3].Type.AsChannelType().ElementType, Equals, typeLibrary.GetGlobalType("int"))
+	c.Assert(events.Fields[3].Type.AsChannelType().Dir, Equals, BothDirs)
+
+	service := typeLibrary.GetType("example.com/test", "IService").AsRecordType()
+	watch := service.Fields[0].Type.AsFunctionType()
+	c.Assert(watch.InputNames, DeepEquals, []string{"topic", "ids"})
+	c.Assert(watch.IsVariadic, Equals, true)
+	c.Assert(watch.InputTypes[1].AsListType().TargetType, Equals, typeLibrary.GetGlobalType("int"))
+	c.Assert(watch.IsStreaming(), Equals, true)
+	c.Assert(typeLibrary.Signature(service.Fields[0].Type), Equals, "func(string, ...int) (<-chan string, error)")
+
+	// fields with several names have a parameter for each name
+	rename := service.Fields[1].Type.AsFunctionType()
+	c.Assert(rename.NumInputs(), Equals, 2)
+	c.Assert(rename.InputNames, DeepEquals, []string{"from", "to"})
+	c.Assert(rename.OutputNames, DeepEquals, []string{"count", "err"})
+	c.Assert(rename.IsStreaming(), Equals, false)
+
+	ping := service.Fields[2].Type.AsFunctionType()
+	c.Assert(ping.InputNames, IsNil)
+	c.Assert(ping.InputName(0), Equals, "")
+}
+
+func (s *TestSuite) TestParseTagsAndDocs(c *C) {
+	parsedFile, typeLibrary := parseTestSource(c, `package test
+
+// A user of the system
+type User struct {
+	// Unique id of the user
+	Id   string "json:\"id\""
+	Name string // display name
+}
+
+type IUserService interface {
+	// Returns a user by id
+	GetUser(id string) (*User, error)
+}
+
+// Handles a user
+type Handler func(user *User)
+`)
+	user := typeLibrary.GetType("example.com/test", "User").AsRecordType()
+	c.Assert(user.Doc, Equals, "A user of the system\n")
+	c.Assert(user.Position.Filename, Equals, parsedFile.FullPath)
+	c.Assert(user.Position.Line, Equals, 4)
+	c.Assert(user.Fields[0].Tag, Equals, `json:"id"`)
+	c.Assert(user.Fields[0].Doc, Equals, "Unique id of the user\n")
+	c.Assert(user.Fields[0].Position.Line, Equals, 6)
+	c.Assert(user.Fields[1].Tag, Equals, "")
+	c.Assert(user.Fields[1].Doc, Equals, "display name\n")
+
+	service := typeLibrary.GetType("example.com/test", "IUserService").AsRecordType()
+	getUser := service.Fields[0]
+	c.Assert(getUser.Doc, Equals, "Returns a user by id\n")
+	c.Assert(getUser.Type.AsFunctionType().Doc, Equals, "Returns a user by id\n")
+	c.Assert(getUser.Type.AsFunctionType().Position.Line, Equals, 12)
+
+	handler := typeLibrary.GetType("example.com/test", "Handler").AsAliasType().TargetType.AsFunctionType()
+	c.Assert(handler.Doc, Equals, "Handles a user\n")
+}
@@ -0,0 +1,220 @@
+package bridge
+
+/**
+ * A TypeVisitor is called as a TypeWalker enters and leaves each type
+ * (children are visited in between).
+ */
+type TypeVisitor interface {
+	/**
+	 * Called before the children of a type are visited.  Returning false
+	 * skips its children (LeaveType is still called).
+	 */
+	EnterType(t *Type, walker *TypeWalker) bool
+
+	/**
+	 * Called after the children of a type have been visited.
+	 */
+	LeaveType(t *Type, walker *TypeWalker)
+}
+
+/**
+ * A TypeVisitor made up of functions for each type class.  Types of classes
+ * without a function are passed to EnterAny/LeaveAny (if set) and otherwise
+ * have their children visited.
+ */
+type TypeHooks struct {
+	Enter map[int]func(t *Type, walker *TypeWalker) bool
+	Leave map[int]func(t *Type, walker *TypeWalker)
+
+	EnterAny func(t *Type, walker *TypeWalker) bool
+	LeaveAny func(t *Type, walker *TypeWalker)
+}
+
+func (hooks *TypeHooks) EnterType(t *Type, walker *TypeWalker) bool {
+	if enter := hooks.Enter[t.TypeClass]; enter != nil {
+		return enter(t, walker)
+	}
+	if hooks.EnterAny != nil {
+		return hooks.EnterAny(t, walker)
+	}
+	return true
+}
+
+func (hooks *TypeHooks) LeaveType(t *Type, walker *TypeWalker) {
+	if leave := hooks.Leave[t.TypeClass]; leave != nil {
+		leave(t, walker)
+	} else if hooks.LeaveAny != nil {
+		hooks.LeaveAny(t, walker)
+	}
+}
+
+/**
+ * A TypeWalker visits types and the types they are made of (depth first
+ * and in the order of ChildTypes).  By default each type is visited once
+ * for the lifetime of the walker (so a walker can be shared across several
+ * walks to visit the types reachable from all of them once).  With Revisit
+ * set types are visited every time they are reached and only cycles (types
+ * that are being visited) are skipped.
+ */
+type TypeWalker struct {
+	Revisit bool
+
+	// Types that have been visited (or are being visited)
+	visited map[*Type]bool
+
+	// The types being visited from the root of the walk
+	path    []*Type
+	stopped bool
+}
+
+func NewTypeWalker() *TypeWalker {
+	return &TypeWalker{visited: make(map[*Type]bool)}
+}
+
+/**
+ * Walks the types reachable from a type with a new walker.
+ */
+func WalkType(t *Type, visitor TypeVisitor) {
+	NewTypeWalker().Walk(t, visitor)
+}
+
+/**
+ * Walks the types reachable from a type.  Returns false if the walk was
+ * stopped (by a visitor calling Stop).
+ */
+func (w *TypeWalker) Walk(t *Type, visitor TypeVisitor) bool {
+	w.stopped = false
+	w.walk(t, visitor)
+	return !w.stopped
+}
+
+func (w *TypeWalker) walk(t *Type, visitor TypeVisitor) {
+	if t == nil || w.stopped || w.visited[t] {
+		return
+	}
+	w.visited[t] = true
+	w.path = append(w.path, t)
+	if visitor.EnterType(t, w) {
+		for _, child := range ChildTypes(t) {
+			if w.stopped {
+				break
+			}
+			w.walk(child, visitor)
+		}
+	}
+	if !w.stopped {
+		visitor.LeaveType(t, w)
+	}
+	w.path = w.path[:len(w.path)-1]
+	if w.Revisit {
+		delete(w.visited, t)
+	}
+}
+
+/**
+ * Ends the current walk (without leaving the types being visited).
+ */
+func (w *TypeWalker) Stop() {
+	w.stopped = true
+}
+
+/**
+ * Returns whether a type has been visited (or is being visited).
+ */
+func (w *TypeWalker) Visited(t *Type) bool {
+	return w.visited[t]
+}
+
+/**
+ * Returns the type whose child is being visited (nil for the root).
+ */
+func (w *TypeWalker) Parent() *Type {
+	if len(w.path) < 2 {
+		return nil
+	}
+	return w.path[len(w.path)-2]
+}
+
+/**
+ * Returns the number of types being visited above the current type (0 for
+ * the root).
+ */
+func (w *TypeWalker) Depth() int {
+	return len(w.path) - 1
+}
+
+/**
+ * Returns the types a type refers to directly, eg the fields (and bases) of
+ * a record, the methods of a named type or the inputs, outputs and
+ * exceptions of a function.
+ */
+func ChildTypes(t *Type) []*Type {
+	slots := childSlots(t)
+	out := make([]*Type, 0, len(slots))
+	for _, slot := range slots {
+		if *slot != nil {
+			out = append(out, *slot)
+		}
+	}
+	return out
+}
+
+/**
+ * Returns pointers to the places in a type that refer to other types.
+ */
+func childSlots(t *Type) []**Type {
+	var out []**Type
+	switch typeData := t.TypeData.(type) {
+	case *AliasTypeData:
+		out = append(out, &typeData.TargetType)
+		for index := range typeData.TypeParams {
+			out = append(out, &typeData.TypeParams[index])
+		}
+		for _, method := range typeData.Methods {
+			out = append(out, &method.Type)
+		}
+	case *ReferenceTypeData:
+		out = append(out, &typeData.TargetType)
+	case *ListTypeData:
+		out = append(out, &typeData.TargetType)
+	case *MapTypeData:
+		out = append(out, &typeData.KeyType, &typeData.ValueType)
+	case *ChannelTypeData:
+		out = append(out, &typeData.ElementType)
+	case *TupleTypeData:
+		for index := range typeData.SubTypes {
+			out = append(out, &typeData.SubTypes[index])
+		}
+	case *RecordTypeData:
+		for index := range typeData.Bases {
+			out = append(out, &typeData.Bases[index])
+		}
+		for _, field := range typeData.Fields {
+			out = append(out, &field.Type)
+		}
+		for index := range typeData.TypeParams {
+			out = append(out, &typeData.TypeParams[index])
+		}
+		for _, method := range typeData.Methods {
+			out = append(out, &method.Type)
+		}
+	case *FunctionTypeData:
+		for _, list := range [][]*Type{typeData.InputTypes, typeData.OutputTypes, typeData.ExceptionTypes} {
+			for index := range list {
+				out = append(out, &list[index])
+			}
+		}
+	case *InstanceTypeData:
+		out = append(out, &typeData.GenericType)
+		for index := range typeData.TypeArgs {
+			out = append(out, &typeData.TypeArgs[index])
+		}
+	case *TypeParamData:
+		out = append(out, &typeData.Constraint)
+	case *UnionTypeData:
+		for _, term := range typeData.Terms {
+			out = append(out, &term.Type)
+		}
+	}
+	return out
+}
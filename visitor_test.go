@@ -0,0 +1,86 @@
+package bridge
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *TestSuite) TestTypeWalker(c *C) {
+	_, typeLibrary := parseTestSource(c, `package test
+
+type Node struct {
+	Name     string
+	Parent   *Node
+	Children map[string]*Node
+}
+`)
+	node := typeLibrary.GetType("example.com/test", "Node")
+	var events []string
+	hooks := &TypeHooks{
+		Enter: map[int]func(*Type, *TypeWalker) bool{
+			ReferenceType: func(t *Type, walker *TypeWalker) bool {
+				events = append(events, "enter "+typeLibrary.Signature(t))
+				c.Assert(walker.Parent().IsRecordType() || walker.Parent().IsMapType(), Equals, true)
+				return true
+			},
+		},
+		EnterAny: func(t *Type, walker *TypeWalker) bool {
+			events = append(events, "enter "+typeLibrary.Signature(t))
+			return true
+		},
+		LeaveAny: func(t *Type, walker *TypeWalker) {
+			events = append(events, "leave "+typeLibrary.Signature(t))
+		},
+	}
+
+	// each type is visited once (so cycles end)
+	WalkType(node, hooks)
+	c.Assert(events, DeepEquals, []string{
+		"enter example.com/test.Node",
+		"enter string",
+		"leave string",
+		"enter *example.com/test.Node",
+		"leave *example.com/test.Node",
+		"enter map[string]*example.com/test.Node",
+		"enter *example.com/test.Node",
+		"leave *example.com/test.Node",
+		"leave map[string]*example.com/test.Node",
+		"leave example.com/test.Node",
+	})
+
+	// with revisits only the types being visited are skipped
+	events = nil
+	walker := NewTypeWalker()
+	walker.Revisit = true
+	c.Assert(walker.Walk(node.AsRecordType().Fields[2].Type, hooks), Equals, true)
+	c.Assert(events, DeepEquals, []string{
+		"enter map[string]*example.com/test.Node",
+		"enter string",
+		"leave string",
+		"enter *example.com/test.Node",
+		"enter example.com/test.Node",
+		"enter string",
+		"leave string",
+		"enter *example.com/test.Node",
+		"leave *example.com/test.Node",
+		"leave example.com/test.Node",
+		"leave *example.com/test.Node",
+		"leave map[string]*example.com/test.Node",
+	})
+
+	// walks can be stopped
+	count := 0
+	c.Assert(NewTypeWalker().Walk(node, &TypeHooks{
+		EnterAny: func(t *Type, walker *TypeWalker) bool {
+			count++
+			if walker.Depth() == 1 {
+				walker.Stop()
+			}
+			return true
+		},
+	}), Equals, false)
+	c.Assert(count, Equals, 2)
+
+	closure, packages := typeLibrary.TransitiveClosureFrom(node, func(t *Type) bool { return t.IsRecordType() })
+	c.Assert(closure, DeepEquals, []*Type{node})
+	c.Assert(packages, DeepEquals, []string{"example.com/test"})
+}